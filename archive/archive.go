@@ -2,13 +2,14 @@ package archive
 
 import (
 	"compress/flate"
+	"errors"
+	"fmt"
 	"io"
 
 	"github.com/meltwater/drone-cache/archive/gzip"
 	"github.com/meltwater/drone-cache/archive/tar"
 
 	"github.com/go-kit/kit/log"
-	"github.com/go-kit/kit/log/level"
 )
 
 const (
@@ -30,8 +31,30 @@ type Archive interface {
 	Extract(dst string, r io.Reader) (int64, error)
 }
 
-// FromFormat determines which archive to use from given archive format.
-func FromFormat(logger log.Logger, root string, format string, opts ...Option) Archive {
+// Lister is implemented by archives that can list their entries without extracting them.
+type Lister interface {
+	// List reads the given archive reader, returns its entries without extracting them.
+	List(r io.Reader) ([]tar.Entry, error)
+}
+
+// ErrUnknownFormat is returned when the archive format is none of the known formats.
+var ErrUnknownFormat = errors.New("unknown archive format")
+
+// ErrNotListable is returned when the archive can not list its entries.
+var ErrNotListable = errors.New("archive can not list its entries")
+
+// List reads the given archive reader with the given archive, returns its entries without extracting them.
+func List(a Archive, r io.Reader) ([]tar.Entry, error) {
+	l, ok := a.(Lister)
+	if !ok {
+		return nil, ErrNotListable
+	}
+
+	return l.List(r)
+}
+
+// FromFormat determines which archive to use from given archive format, the default format if it is empty.
+func FromFormat(logger log.Logger, root string, format string, opts ...Option) (Archive, error) {
 	options := options{
 		compressionLevel: DefaultCompressionLevel,
 	}
@@ -40,13 +63,44 @@ func FromFormat(logger log.Logger, root string, format string, opts ...Option) A
 		o.apply(&options)
 	}
 
+	tarOpts := []tar.Option{
+		tar.WithExcludes(options.excludes),
+		tar.WithPreserveTimes(options.preserveTimes),
+		tar.WithPreserveOwner(options.preserveOwner),
+		tar.WithPreserveXattrs(options.preserveXattrs),
+		tar.WithReproducible(options.reproducible),
+		tar.WithSourceDateEpoch(options.sourceDateEpoch),
+	}
+
+	var a Archive
+
 	switch format {
 	case Gzip:
-		return gzip.New(logger, root, options.skipSymlinks, options.compressionLevel)
-	case Tar:
-		return tar.New(logger, root, options.skipSymlinks)
+		a = gzip.New(logger, root, options.skipSymlinks, options.compressionLevel, tarOpts...)
+	case Tar, "":
+		a = tar.New(logger, root, options.skipSymlinks, tarOpts...) // DefaultArchiveFormat
 	default:
-		level.Error(logger).Log("msg", "unknown archive format", "format", format)
-		return tar.New(logger, root, options.skipSymlinks) // DefaultArchiveFormat
+		return nil, fmt.Errorf("<%s>, %w", format, ErrUnknownFormat)
+	}
+
+	if options.concurrency > 0 {
+		return newBudgeted(a, options.concurrency), nil
+	}
+
+	return a, nil
+}
+
+// ValidCompressionLevel checks if the given compression level is in the range of the given archive format.
+// Formats without compression accept any level, as it is not used.
+func ValidCompressionLevel(format string, level int) error {
+	if format != Gzip {
+		return nil
 	}
+
+	if level < flate.HuffmanOnly || level > flate.BestCompression {
+		return fmt.Errorf("compression level <%d> of <%s>, must be between %d and %d",
+			level, format, flate.HuffmanOnly, flate.BestCompression)
+	}
+
+	return nil
 }
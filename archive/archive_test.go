@@ -0,0 +1,32 @@
+package archive
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/meltwater/drone-cache/test"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestFromFormat(t *testing.T) {
+	t.Parallel()
+
+	for _, format := range []string{Gzip, Tar, ""} {
+		a, err := FromFormat(log.NewNopLogger(), "", format)
+		test.Ok(t, err)
+		test.Assert(t, a != nil, "no archive for format <%s>", format)
+	}
+
+	_, err := FromFormat(log.NewNopLogger(), "", "zip")
+	test.Assert(t, errors.Is(err, ErrUnknownFormat), "unknown format is not an error, %v", err)
+}
+
+func TestValidCompressionLevel(t *testing.T) {
+	t.Parallel()
+
+	test.Ok(t, ValidCompressionLevel(Gzip, DefaultCompressionLevel))
+	test.Ok(t, ValidCompressionLevel(Tar, 42))
+	test.NotOk(t, ValidCompressionLevel(Gzip, 10))
+	test.NotOk(t, ValidCompressionLevel(Gzip, -3))
+}
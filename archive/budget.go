@@ -0,0 +1,72 @@
+package archive
+
+import (
+	"io"
+
+	"github.com/meltwater/drone-cache/archive/tar"
+)
+
+// budgeted limits the number of archives that are created or extracted concurrently, sharing a CPU budget.
+// NOTICE: Budget is released while waiting on the underlying reader or writer,
+// so archives blocked on storage do not hold the budget of the ones that can make progress.
+type budgeted struct {
+	a      Archive
+	tokens chan struct{}
+}
+
+func newBudgeted(a Archive, n int) *budgeted {
+	return &budgeted{a: a, tokens: make(chan struct{}, n)}
+}
+
+// Create writes content of the given source to an archive, returns written bytes.
+func (b *budgeted) Create(srcs []string, w io.Writer) (int64, error) {
+	b.acquire()
+	defer b.release()
+
+	return b.a.Create(srcs, &yieldWriter{w: w, b: b})
+}
+
+// Extract reads content from the given archive reader and restores it to the destination, returns written bytes.
+func (b *budgeted) Extract(dst string, r io.Reader) (int64, error) {
+	b.acquire()
+	defer b.release()
+
+	return b.a.Extract(dst, &yieldReader{r: r, b: b})
+}
+
+// List reads the given archive reader, returns its entries without extracting them.
+func (b *budgeted) List(r io.Reader) ([]tar.Entry, error) {
+	b.acquire()
+	defer b.release()
+
+	return List(b.a, &yieldReader{r: r, b: b})
+}
+
+func (b *budgeted) acquire() { b.tokens <- struct{}{} }
+func (b *budgeted) release() { <-b.tokens }
+
+// yieldWriter releases the budget while writing to the underlying writer.
+type yieldWriter struct {
+	w io.Writer
+	b *budgeted
+}
+
+func (y *yieldWriter) Write(p []byte) (int, error) {
+	y.b.release()
+	defer y.b.acquire()
+
+	return y.w.Write(p)
+}
+
+// yieldReader releases the budget while reading from the underlying reader.
+type yieldReader struct {
+	r io.Reader
+	b *budgeted
+}
+
+func (y *yieldReader) Read(p []byte) (int, error) {
+	y.b.release()
+	defer y.b.acquire()
+
+	return y.r.Read(p)
+}
@@ -0,0 +1,103 @@
+package archive
+
+import (
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/meltwater/drone-cache/test"
+)
+
+// busyArchive records the maximum number of archives working concurrently.
+type busyArchive struct {
+	mu          sync.Mutex
+	active, max int
+}
+
+func (a *busyArchive) Create(srcs []string, w io.Writer) (int64, error) {
+	a.work()
+	return int64(len(srcs)), nil
+}
+
+func (a *busyArchive) Extract(dst string, r io.Reader) (int64, error) {
+	a.work()
+	return 0, nil
+}
+
+func (a *busyArchive) work() {
+	a.mu.Lock()
+	a.active++
+
+	if a.active > a.max {
+		a.max = a.active
+	}
+	a.mu.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	a.mu.Lock()
+	a.active--
+	a.mu.Unlock()
+}
+
+func TestBudgetLimitsConcurrency(t *testing.T) {
+	t.Parallel()
+
+	var (
+		a  = &busyArchive{}
+		b  = newBudgeted(a, 2)
+		wg sync.WaitGroup
+	)
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			_, err := b.Create([]string{"src"}, ioutil.Discard)
+			test.Ok(t, err)
+		}()
+	}
+
+	wg.Wait()
+
+	test.Equals(t, 2, a.max)
+}
+
+// copyArchive copies the sources to the writer, and the reader to nowhere.
+type copyArchive struct{}
+
+func (copyArchive) Create(srcs []string, w io.Writer) (int64, error) {
+	n, err := w.Write([]byte(srcs[0]))
+	return int64(n), err
+}
+
+func (copyArchive) Extract(dst string, r io.Reader) (int64, error) {
+	return io.Copy(ioutil.Discard, r)
+}
+
+func TestBudgetReleasedWhileBlocked(t *testing.T) {
+	t.Parallel()
+
+	var (
+		b      = newBudgeted(copyArchive{}, 1)
+		pr, pw = io.Pipe()
+		done   = make(chan error, 1)
+	)
+
+	// Create blocks on the pipe until extract reads it, which needs the only budget.
+	go func() {
+		_, err := b.Create([]string{"data"}, pw)
+		done <- err
+
+		pw.Close()
+	}()
+
+	n, err := b.Extract("dst", pr)
+	test.Ok(t, err)
+	test.Equals(t, int64(4), n)
+	test.Ok(t, <-done)
+}
@@ -0,0 +1,135 @@
+// Package encrypt provides an archive that encrypts archives created by another archive,
+// and decrypts them before extracting, so caches are never stored unencrypted.
+package encrypt
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/meltwater/drone-cache/archive"
+	"github.com/meltwater/drone-cache/archive/tar"
+
+	"github.com/go-kit/kit/log"
+)
+
+const (
+	// KeySize is the size of the encryption keys in bytes.
+	KeySize = 32
+
+	keyIDSize = 8
+)
+
+// Key is a secret key used to encrypt and decrypt archives.
+type Key struct {
+	id     [keyIDSize]byte
+	secret [KeySize]byte
+}
+
+// ParseKey parses a base64 encoded 32 bytes key.
+func ParseKey(s string) (Key, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return Key{}, fmt.Errorf("decode key, %w", err)
+	}
+
+	if len(b) != KeySize {
+		return Key{}, fmt.Errorf("key must be %d bytes, got %d bytes", KeySize, len(b))
+	}
+
+	var k Key
+	copy(k.secret[:], b)
+
+	// NOTICE: Key id identifies the key an archive is encrypted with, without revealing the key.
+	sum := sha256.Sum256(append([]byte("drone-cache key id\x00"), b...))
+	copy(k.id[:], sum[:])
+
+	return k, nil
+}
+
+// ID returns the hex encoded identifier of the key.
+func (k Key) ID() string {
+	return fmt.Sprintf("%x", k.id)
+}
+
+// Archive encrypts and decrypts archives of the underlying archive.
+type Archive struct {
+	logger log.Logger
+
+	a    archive.Archive
+	keys []Key
+}
+
+// New creates an archive that encrypts with the first key, and decrypts with the key the archive is encrypted with.
+// Keys other than the first are only used for decryption, which allows rotating keys without losing caches.
+func New(logger log.Logger, a archive.Archive, keys ...Key) (*Archive, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("at least one encryption key is required")
+	}
+
+	return &Archive{logger: logger, a: a, keys: keys}, nil
+}
+
+// Create writes encrypted content of the given source to an archive, returns written bytes.
+func (a *Archive) Create(srcs []string, w io.Writer) (int64, error) {
+	ew, err := newWriter(w, a.keys[0])
+	if err != nil {
+		return 0, fmt.Errorf("create encryption writer, %w", err)
+	}
+
+	n, err := a.a.Create(srcs, ew)
+	if err != nil {
+		return n, err
+	}
+
+	// NOTICE: Final segment is only sealed when the archive is complete, so failed archives never authenticate.
+	if err := ew.Close(); err != nil {
+		return n, fmt.Errorf("close encryption writer, %w", err)
+	}
+
+	return n, nil
+}
+
+// Extract decrypts content from the given archive reader and restores it to the destination, returns written bytes.
+func (a *Archive) Extract(dst string, r io.Reader) (int64, error) {
+	dr, err := newReader(r, a.keys)
+	if err != nil {
+		return 0, fmt.Errorf("create decryption reader, %w", err)
+	}
+
+	n, err := a.a.Extract(dst, dr)
+	if err != nil {
+		return n, err
+	}
+
+	// NOTICE: Archive formats might not read until the end, read the rest to authenticate the whole stream.
+	if _, err := io.Copy(ioutil.Discard, dr); err != nil {
+		return n, fmt.Errorf("read rest of the archive, %w", err)
+	}
+
+	return n, nil
+}
+
+// List decrypts content from the given archive reader, returns entries of the underlying archive.
+func (a *Archive) List(r io.Reader) ([]tar.Entry, error) {
+	dr, err := newReader(r, a.keys)
+	if err != nil {
+		return nil, fmt.Errorf("create decryption reader, %w", err)
+	}
+
+	entries, err := archive.List(a.a, dr)
+	if err != nil {
+		return entries, err
+	}
+
+	// NOTICE: Entries are only trusted once the whole stream is authenticated.
+	if _, err := io.Copy(ioutil.Discard, dr); err != nil {
+		return nil, fmt.Errorf("read rest of the archive, %w", err)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,247 @@
+package encrypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/meltwater/drone-cache/archive/tar"
+	"github.com/meltwater/drone-cache/test"
+
+	"github.com/go-kit/kit/log"
+)
+
+var testRoot = "testdata"
+
+func TestRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	key := testKey(t)
+
+	for _, size := range []int{0, 1, segmentSize - 1, segmentSize, segmentSize + 1, 3*segmentSize + 42} {
+		content := randomBytes(t, size)
+
+		// Encrypt
+		var buf bytes.Buffer
+		w, err := newWriter(&buf, key)
+		test.Ok(t, err)
+
+		_, err = w.Write(content)
+		test.Ok(t, err)
+		test.Ok(t, w.Close())
+
+		test.Assert(t, !bytes.Contains(buf.Bytes(), content) || size == 0, "size %d: encrypted stream contains plaintext", size)
+
+		// Decrypt
+		r, err := newReader(&buf, []Key{key})
+		test.Ok(t, err)
+
+		got, err := ioutil.ReadAll(r)
+		test.Ok(t, err)
+		test.Assert(t, bytes.Equal(content, got), "size %d: decrypted content differs", size)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	t.Parallel()
+
+	var (
+		old     = testKey(t)
+		current = testKey(t)
+		content = randomBytes(t, segmentSize*2)
+	)
+
+	encrypted := encrypt(t, old, content)
+
+	// Test
+	r, err := newReader(bytes.NewReader(encrypted), []Key{current, old})
+	test.Ok(t, err)
+
+	got, err := ioutil.ReadAll(r)
+	test.Ok(t, err)
+	test.Assert(t, bytes.Equal(content, got), "decrypted content differs")
+
+	_, err = newReader(bytes.NewReader(encrypted), []Key{current})
+	test.Expected(t, err, ErrUnknownKey)
+
+	_, err = newReader(bytes.NewReader(content), []Key{current})
+	test.Expected(t, err, ErrNotEncrypted)
+}
+
+func TestTampering(t *testing.T) {
+	t.Parallel()
+
+	var (
+		key     = testKey(t)
+		content = randomBytes(t, segmentSize*3)
+	)
+
+	encrypted := encrypt(t, key, content)
+	overhead := 16
+
+	for _, tc := range []struct {
+		name   string
+		tamper func([]byte) []byte
+	}{
+		{
+			name: "flipped bit",
+			tamper: func(b []byte) []byte {
+				b[headerSize+segmentSize] ^= 1
+				return b
+			},
+		},
+		{
+			name: "truncated at segment boundary",
+			tamper: func(b []byte) []byte {
+				return b[:headerSize+2*(segmentSize+overhead)]
+			},
+		},
+		{
+			name: "truncated in segment",
+			tamper: func(b []byte) []byte {
+				return b[:len(b)-1]
+			},
+		},
+		{
+			name: "swapped segments",
+			tamper: func(b []byte) []byte {
+				s := segmentSize + overhead
+				first := append([]byte{}, b[headerSize:headerSize+s]...)
+				copy(b[headerSize:], b[headerSize+s:headerSize+2*s])
+				copy(b[headerSize+s:], first)
+				return b
+			},
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tampered := tc.tamper(append([]byte{}, encrypted...))
+
+			r, err := newReader(bytes.NewReader(tampered), []Key{key})
+			test.Ok(t, err)
+
+			_, err = ioutil.ReadAll(r)
+			test.Expected(t, err, ErrCorrupted)
+		})
+	}
+}
+
+func TestArchive(t *testing.T) {
+	t.Parallel()
+
+	// Setup
+	test.Ok(t, os.MkdirAll(testRoot, 0755))
+	t.Cleanup(func() { os.RemoveAll(testRoot) })
+
+	root, rootClean := test.CreateTempDir(t, "encrypt", testRoot)
+	t.Cleanup(rootClean)
+
+	src := filepath.Join(root, "mounted")
+	test.Ok(t, os.MkdirAll(src, 0755))
+	test.Ok(t, ioutil.WriteFile(filepath.Join(src, "file.txt"), []byte("hello\ndrone!\n"), 0644))
+
+	a, err := New(log.NewNopLogger(), tar.New(log.NewNopLogger(), root, false), testKey(t))
+	test.Ok(t, err)
+
+	// Run
+	var buf bytes.Buffer
+	_, err = a.Create([]string{src}, &buf)
+	test.Ok(t, err)
+
+	test.Assert(t, !bytes.Contains(buf.Bytes(), []byte("drone!")), "archive is not encrypted")
+
+	dst := filepath.Join(root, "extracted")
+	_, err = a.Extract(dst, &buf)
+	test.Ok(t, err)
+
+	// Test
+	b, err := ioutil.ReadFile(filepath.Join(dst, "mounted", "file.txt"))
+	test.Ok(t, err)
+	test.Equals(t, "hello\ndrone!\n", string(b))
+}
+
+func TestArchiveList(t *testing.T) {
+	t.Parallel()
+
+	// Setup
+	test.Ok(t, os.MkdirAll(testRoot, 0755))
+	t.Cleanup(func() { os.RemoveAll(testRoot) })
+
+	root, rootClean := test.CreateTempDir(t, "encrypt_list", testRoot)
+	t.Cleanup(rootClean)
+
+	src := filepath.Join(root, "mounted")
+	test.Ok(t, os.MkdirAll(src, 0755))
+	test.Ok(t, ioutil.WriteFile(filepath.Join(src, "file.txt"), []byte("hello\ndrone!\n"), 0644))
+
+	a, err := New(log.NewNopLogger(), tar.New(log.NewNopLogger(), root, false), testKey(t))
+	test.Ok(t, err)
+
+	var buf bytes.Buffer
+	_, err = a.Create([]string{src}, &buf)
+	test.Ok(t, err)
+
+	// Run
+	entries, err := a.List(&buf)
+	test.Ok(t, err)
+
+	// Test
+	test.Equals(t, 2, len(entries))
+	test.Equals(t, "mounted/file.txt", entries[1].Name)
+	test.Equals(t, int64(len("hello\ndrone!\n")), entries[1].Size)
+	test.Assert(t, entries[0].Mode.IsDir(), "first entry is not the mounted directory")
+}
+
+func TestParseKey(t *testing.T) {
+	t.Parallel()
+
+	_, err := ParseKey("not base64!")
+	test.NotOk(t, err)
+
+	_, err = ParseKey(base64.StdEncoding.EncodeToString([]byte("too short")))
+	test.NotOk(t, err)
+
+	k1, err := ParseKey(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, KeySize)))
+	test.Ok(t, err)
+
+	k2, err := ParseKey(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, KeySize)))
+	test.Ok(t, err)
+
+	test.Assert(t, k1.ID() != k2.ID(), "different keys have the same id")
+}
+
+// Helpers
+
+func testKey(t *testing.T) Key {
+	k, err := ParseKey(base64.StdEncoding.EncodeToString(randomBytes(t, KeySize)))
+	test.Ok(t, err)
+
+	return k
+}
+
+func encrypt(t *testing.T, k Key, content []byte) []byte {
+	var buf bytes.Buffer
+	w, err := newWriter(&buf, k)
+	test.Ok(t, err)
+
+	_, err = w.Write(content)
+	test.Ok(t, err)
+	test.Ok(t, w.Close())
+
+	return buf.Bytes()
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	b := make([]byte, n)
+
+	_, err := rand.Read(b)
+	test.Ok(t, err)
+
+	return b
+}
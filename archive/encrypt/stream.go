@@ -0,0 +1,240 @@
+package encrypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// NOTICE: The stream format follows the STREAM construction (https://eprint.iacr.org/2015/189.pdf).
+// Plaintext is split into fixed size segments, each sealed with AES-256-GCM using a key derived from a random salt,
+// and a nonce made of the segment counter and a flag marking the final segment.
+// Reordered, dropped or truncated segments fail authentication.
+//
+//	header  := magic (4) | key id (8) | salt (16)
+//	segment := ciphertext of up to segmentSize bytes | tag (16)
+
+const (
+	segmentSize = 64 << 10 // 64 KiB
+
+	saltSize   = 16
+	headerSize = len(magic) + keyIDSize + saltSize
+
+	lastSegment = 1
+)
+
+var magic = [4]byte{'D', 'C', 'E', 1}
+
+var (
+	// ErrNotEncrypted is returned when the stream does not start with the header of an encrypted stream.
+	ErrNotEncrypted = errors.New("not an encrypted stream")
+	// ErrUnknownKey is returned when none of the keys matches the key the stream is encrypted with.
+	ErrUnknownKey = errors.New("no matching decryption key")
+	// ErrCorrupted is returned when a segment of the stream fails authentication.
+	ErrCorrupted = errors.New("encrypted stream is corrupted or truncated")
+)
+
+// writer encrypts everything written to it, Close must be called to write the final segment.
+type writer struct {
+	w    io.Writer
+	aead cipher.AEAD
+
+	buf     []byte
+	counter uint64
+	closed  bool
+}
+
+func newWriter(w io.Writer, k Key) (*writer, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("generate salt, %w", err)
+	}
+
+	aead, err := newAEAD(k, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, headerSize)
+	header = append(header, magic[:]...)
+	header = append(header, k.id[:]...)
+	header = append(header, salt...)
+
+	if _, err := w.Write(header); err != nil {
+		return nil, fmt.Errorf("write header, %w", err)
+	}
+
+	return &writer{w: w, aead: aead, buf: make([]byte, 0, segmentSize)}, nil
+}
+
+func (e *writer) Write(p []byte) (int, error) {
+	if e.closed {
+		return 0, errors.New("write to closed encryption writer")
+	}
+
+	n := len(p)
+
+	for len(p) > 0 {
+		// NOTICE: Full segments are only sealed once more data arrives, so the final segment is never sealed early.
+		if len(e.buf) == segmentSize {
+			if err := e.seal(false); err != nil {
+				return n - len(p), err
+			}
+		}
+
+		c := copy(e.buf[len(e.buf):segmentSize], p)
+		e.buf = e.buf[:len(e.buf)+c]
+		p = p[c:]
+	}
+
+	return n, nil
+}
+
+// Close seals the final segment, it does not close the underlying writer.
+func (e *writer) Close() error {
+	if e.closed {
+		return nil
+	}
+
+	e.closed = true
+
+	return e.seal(true)
+}
+
+func (e *writer) seal(last bool) error {
+	out := e.aead.Seal(nil, nonce(e.counter, last), e.buf, nil)
+	if _, err := e.w.Write(out); err != nil {
+		return fmt.Errorf("write segment, %w", err)
+	}
+
+	e.counter++
+	e.buf = e.buf[:0]
+
+	return nil
+}
+
+// reader decrypts the stream read from the underlying reader.
+type reader struct {
+	r    *bufio.Reader
+	aead cipher.AEAD
+
+	in      []byte
+	out     []byte
+	counter uint64
+	done    bool
+}
+
+func newReader(r io.Reader, keys []Key) (*reader, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("read header, %v, %w", err, ErrNotEncrypted)
+	}
+
+	if !bytes.Equal(header[:len(magic)], magic[:]) {
+		return nil, ErrNotEncrypted
+	}
+
+	var (
+		id   = header[len(magic) : len(magic)+keyIDSize]
+		salt = header[len(magic)+keyIDSize:]
+	)
+
+	for _, k := range keys {
+		if !bytes.Equal(k.id[:], id) {
+			continue
+		}
+
+		aead, err := newAEAD(k, salt)
+		if err != nil {
+			return nil, err
+		}
+
+		return &reader{
+			r:    bufio.NewReaderSize(r, segmentSize+aead.Overhead()),
+			aead: aead,
+			in:   make([]byte, segmentSize+aead.Overhead()),
+		}, nil
+	}
+
+	return nil, fmt.Errorf("key id <%x>, %w", id, ErrUnknownKey)
+}
+
+func (d *reader) Read(p []byte) (int, error) {
+	for len(d.out) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+
+		if err := d.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, d.out)
+	d.out = d.out[n:]
+
+	return n, nil
+}
+
+func (d *reader) open() error {
+	n, err := io.ReadFull(d.r, d.in)
+
+	switch {
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		d.done = true
+	case err != nil:
+		return fmt.Errorf("read segment, %w", err)
+	default:
+		// NOTICE: A full segment is the final one only if nothing follows it.
+		if _, err := d.r.Peek(1); errors.Is(err, io.EOF) {
+			d.done = true
+		}
+	}
+
+	out, err := d.aead.Open(d.in[:0], nonce(d.counter, d.done), d.in[:n], nil)
+	if err != nil {
+		return fmt.Errorf("segment %d, %w", d.counter, ErrCorrupted)
+	}
+
+	d.counter++
+	d.out = out
+
+	return nil
+}
+
+// newAEAD derives the key of the stream from the given key and salt.
+func newAEAD(k Key, salt []byte) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, k.secret[:])
+	mac.Write(salt) //nolint:errcheck
+
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, fmt.Errorf("create cipher, %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("create gcm, %w", err)
+	}
+
+	return aead, nil
+}
+
+func nonce(counter uint64, last bool) []byte {
+	n := make([]byte, 12) //nolint:gomnd
+	binary.BigEndian.PutUint64(n, counter)
+
+	if last {
+		binary.BigEndian.PutUint32(n[8:], lastSegment)
+	}
+
+	return n
+}
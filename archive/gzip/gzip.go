@@ -18,11 +18,12 @@ type Archive struct {
 	root             string
 	compressionLevel int
 	skipSymlinks     bool
+	opts             []tar.Option
 }
 
 // New creates an archive that uses the .tar.gz file format.
-func New(logger log.Logger, root string, skipSymlinks bool, compressionLevel int) *Archive {
-	return &Archive{logger, root, compressionLevel, skipSymlinks}
+func New(logger log.Logger, root string, skipSymlinks bool, compressionLevel int, opts ...tar.Option) *Archive {
+	return &Archive{logger, root, compressionLevel, skipSymlinks, opts}
 }
 
 // Create writes content of the given source to an archive, returns written bytes.
@@ -34,7 +35,7 @@ func (a *Archive) Create(srcs []string, w io.Writer) (int64, error) {
 
 	defer internal.CloseWithErrLogf(a.logger, gw, "gzip writer")
 
-	return tar.New(a.logger, a.root, a.skipSymlinks).Create(srcs, gw)
+	return tar.New(a.logger, a.root, a.skipSymlinks, a.opts...).Create(srcs, gw)
 }
 
 // Extract reads content from the given archive reader and restores it to the destination, returns written bytes.
@@ -46,5 +47,17 @@ func (a *Archive) Extract(dst string, r io.Reader) (int64, error) {
 
 	defer internal.CloseWithErrLogf(a.logger, gr, "gzip reader")
 
-	return tar.New(a.logger, a.root, a.skipSymlinks).Extract(dst, gr)
+	return tar.New(a.logger, a.root, a.skipSymlinks, a.opts...).Extract(dst, gr)
+}
+
+// List reads the given archive reader, returns its entries without extracting them.
+func (a *Archive) List(r io.Reader) ([]tar.Entry, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	defer internal.CloseWithErrLogf(a.logger, gr, "gzip reader")
+
+	return tar.New(a.logger, a.root, a.skipSymlinks, a.opts...).List(gr)
 }
@@ -0,0 +1,165 @@
+// Package ignore provides gitignore style matching of paths to exclude from archives.
+package ignore
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/meltwater/drone-cache/internal"
+)
+
+// FileName is the name of the file to read exclude patterns from, in the workspace.
+const FileName = ".cacheignore"
+
+const doubleStar = "**"
+
+// Matcher matches slash separated paths, relative to archive root, against gitignore style patterns.
+// Like gitignore, the last matching pattern decides, and patterns prefixed with "!" re-include paths.
+type Matcher struct {
+	patterns []pattern
+}
+
+type pattern struct {
+	segments []string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// New creates a new Matcher from given patterns. Empty patterns and comments are ignored.
+func New(patterns ...string) (*Matcher, error) {
+	m := &Matcher{}
+
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if p == "" || strings.HasPrefix(p, "#") {
+			continue
+		}
+
+		pt := pattern{}
+
+		if strings.HasPrefix(p, "!") {
+			pt.negate = true
+			p = p[1:]
+		}
+
+		if strings.HasSuffix(p, "/") {
+			pt.dirOnly = true
+			p = strings.TrimRight(p, "/")
+		}
+
+		// NOTICE: Like gitignore, a pattern with a separator at the beginning or the middle is relative to the root,
+		// otherwise it matches at any level.
+		pt.anchored = strings.Contains(p, "/")
+		p = strings.TrimPrefix(p, "/")
+
+		if p == "" {
+			continue
+		}
+
+		pt.segments = strings.Split(p, "/")
+		for _, s := range pt.segments {
+			if s == doubleStar {
+				continue
+			}
+
+			if _, err := path.Match(s, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern <%s>, %w", p, err)
+			}
+		}
+
+		m.patterns = append(m.patterns, pt)
+	}
+
+	return m, nil
+}
+
+// ReadFile reads patterns from the given file, one per line. A missing file yields no patterns.
+func ReadFile(name string) (patterns []string, err error) {
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("open ignore file <%s>, %w", name, err)
+	}
+
+	defer internal.CloseWithErrCapturef(&err, f, "read ignore file <%s>", name)
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		patterns = append(patterns, s.Text())
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("read ignore file <%s>, %w", name, err)
+	}
+
+	return patterns, nil
+}
+
+// Match reports whether given slash separated path, relative to archive root, should be excluded.
+func (m *Matcher) Match(p string, isDir bool) bool {
+	if m == nil {
+		return false
+	}
+
+	segments := strings.Split(strings.Trim(path.Clean(p), "/"), "/")
+	excluded := false
+
+	for _, pt := range m.patterns {
+		if pt.dirOnly && !isDir {
+			continue
+		}
+
+		if pt.match(segments) {
+			excluded = !pt.negate
+		}
+	}
+
+	return excluded
+}
+
+func (pt pattern) match(segments []string) bool {
+	if !pt.anchored {
+		return matchSegments(pt.segments, segments[len(segments)-1:])
+	}
+
+	return matchSegments(pt.segments, segments)
+}
+
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == doubleStar {
+			rest := pattern[1:]
+			if len(rest) == 0 {
+				// NOTICE: A trailing "**" matches everything inside, but not the directory itself.
+				return len(segments) > 0
+			}
+
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(rest, segments[i:]) {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		if len(segments) == 0 {
+			return false
+		}
+
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+
+		pattern, segments = pattern[1:], segments[1:]
+	}
+
+	return len(segments) == 0
+}
@@ -0,0 +1,86 @@
+package ignore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/meltwater/drone-cache/test"
+)
+
+func TestMatch(t *testing.T) {
+	t.Parallel()
+
+	m, err := New(
+		"# comment",
+		"",
+		"*.lock",
+		"daemon/",
+		"/node_modules/.cache",
+		".gradle/**/*.log",
+		"build/**",
+		"!build/keep.txt",
+	)
+	test.Ok(t, err)
+
+	for _, tt := range []struct {
+		path     string
+		isDir    bool
+		excluded bool
+	}{
+		{"yarn.lock", false, true},
+		{".gradle/caches/journal.lock", false, true},
+		{".gradle/daemon", true, true},
+		{".gradle/daemon", false, false},
+		{"node_modules/.cache", true, true},
+		{"node_modules/pkg/.cache", true, false},
+		{".gradle/daemon.log", false, true},
+		{".gradle/a/b/daemon.log", false, true},
+		{".gradle/a/b/daemon.txt", false, false},
+		{"build", true, false},
+		{"build/out.bin", false, true},
+		{"build/keep.txt", false, false},
+		{"src/main.go", false, false},
+	} {
+		tt := tt
+		t.Run(tt.path, func(t *testing.T) {
+			t.Parallel()
+			test.Equals(t, tt.excluded, m.Match(tt.path, tt.isDir))
+		})
+	}
+}
+
+func TestNilMatcher(t *testing.T) {
+	t.Parallel()
+
+	var m *Matcher
+	test.Assert(t, !m.Match("anything", false), "nil matcher should not exclude anything")
+}
+
+func TestInvalidPattern(t *testing.T) {
+	t.Parallel()
+
+	_, err := New("[")
+	test.NotOk(t, err)
+}
+
+func TestReadFile(t *testing.T) {
+	t.Parallel()
+
+	dir, cleanup := test.CreateTempDir(t, "ignore")
+	t.Cleanup(cleanup)
+
+	patterns, err := ReadFile(filepath.Join(dir, "idonotexist"))
+	test.Ok(t, err)
+	test.Equals(t, 0, len(patterns))
+
+	name := filepath.Join(dir, FileName)
+	test.Ok(t, ioutil.WriteFile(name, []byte("# comment\n*.lock\n!keep.lock\n"), 0644))
+
+	patterns, err = ReadFile(name)
+	test.Ok(t, err)
+	test.Equals(t, []string{"# comment", "*.lock", "!keep.lock"}, patterns)
+
+	test.Ok(t, os.Remove(name))
+}
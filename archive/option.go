@@ -1,8 +1,21 @@
 package archive
 
+import (
+	"time"
+
+	"github.com/meltwater/drone-cache/archive/ignore"
+)
+
 type options struct {
 	compressionLevel int
 	skipSymlinks     bool
+	excludes         *ignore.Matcher
+	preserveTimes    bool
+	preserveOwner    bool
+	preserveXattrs   bool
+	reproducible     bool
+	sourceDateEpoch  time.Time
+	concurrency      int
 }
 
 // Option overrides behavior of Archive.
@@ -29,3 +42,53 @@ func WithSkipSymlinks(b bool) Option {
 		o.skipSymlinks = b
 	})
 }
+
+// WithExcludes sets matcher of the paths to exclude from archives.
+func WithExcludes(m *ignore.Matcher) Option {
+	return optionFunc(func(o *options) {
+		o.excludes = m
+	})
+}
+
+// WithPreserveTimes sets modification and access times of files should be restored on extract.
+func WithPreserveTimes(b bool) Option {
+	return optionFunc(func(o *options) {
+		o.preserveTimes = b
+	})
+}
+
+// WithPreserveOwner sets owner and group of files should be restored on extract, only effective when running as root.
+func WithPreserveOwner(b bool) Option {
+	return optionFunc(func(o *options) {
+		o.preserveOwner = b
+	})
+}
+
+// WithPreserveXattrs sets extended attributes of files should be archived and restored.
+func WithPreserveXattrs(b bool) Option {
+	return optionFunc(func(o *options) {
+		o.preserveXattrs = b
+	})
+}
+
+// WithReproducible sets archives should be created reproducibly, so identical sources produce identical archives.
+func WithReproducible(b bool) Option {
+	return optionFunc(func(o *options) {
+		o.reproducible = b
+	})
+}
+
+// WithSourceDateEpoch sets the time that modification times of files are clamped to in reproducible archives.
+func WithSourceDateEpoch(t time.Time) Option {
+	return optionFunc(func(o *options) {
+		o.sourceDateEpoch = t
+	})
+}
+
+// WithConcurrency sets the maximum number of archives compressed or decompressed concurrently,
+// shared by every mount that uses the archive. Zero means unlimited.
+func WithConcurrency(n int) Option {
+	return optionFunc(func(o *options) {
+		o.concurrency = n
+	})
+}
@@ -0,0 +1,28 @@
+// +build !windows
+
+package tar
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileID identifies a file by its device and inode numbers.
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// hardLinkID returns the identity of the given regular file, if it has more than one hard link.
+func hardLinkID(fi os.FileInfo) (fileID, bool) {
+	if !fi.Mode().IsRegular() {
+		return fileID{}, false
+	}
+
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok || st.Nlink < 2 {
+		return fileID{}, false
+	}
+
+	return fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true //nolint:unconvert
+}
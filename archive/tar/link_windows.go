@@ -0,0 +1,14 @@
+package tar
+
+import "os"
+
+// fileID identifies a file by its device and inode numbers.
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// hardLinkID always reports false, hard links are archived as regular files on windows.
+func hardLinkID(fi os.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
@@ -0,0 +1,70 @@
+package tar
+
+import (
+	"time"
+
+	"github.com/meltwater/drone-cache/archive/ignore"
+)
+
+type options struct {
+	excludes       *ignore.Matcher
+	preserveTimes  bool
+	preserveOwner  bool
+	preserveXattrs bool
+	reproducible   bool
+
+	sourceDateEpoch time.Time
+}
+
+// Option overrides behavior of Archive.
+type Option interface {
+	apply(*options)
+}
+
+type optionFunc func(*options)
+
+func (f optionFunc) apply(o *options) {
+	f(o)
+}
+
+// WithExcludes sets matcher of the paths to exclude from the archive.
+func WithExcludes(m *ignore.Matcher) Option {
+	return optionFunc(func(o *options) {
+		o.excludes = m
+	})
+}
+
+// WithPreserveTimes sets modification and access times of files should be restored on extract.
+func WithPreserveTimes(b bool) Option {
+	return optionFunc(func(o *options) {
+		o.preserveTimes = b
+	})
+}
+
+// WithPreserveOwner sets owner and group of files should be restored on extract, only effective when running as root.
+func WithPreserveOwner(b bool) Option {
+	return optionFunc(func(o *options) {
+		o.preserveOwner = b
+	})
+}
+
+// WithPreserveXattrs sets extended attributes of files should be archived on create and restored on extract.
+func WithPreserveXattrs(b bool) Option {
+	return optionFunc(func(o *options) {
+		o.preserveXattrs = b
+	})
+}
+
+// WithReproducible sets archives should be created reproducibly, so identical sources produce identical archives.
+func WithReproducible(b bool) Option {
+	return optionFunc(func(o *options) {
+		o.reproducible = b
+	})
+}
+
+// WithSourceDateEpoch sets the time that modification times of files are clamped to in reproducible archives.
+func WithSourceDateEpoch(t time.Time) Option {
+	return optionFunc(func(o *options) {
+		o.sourceDateEpoch = t
+	})
+}
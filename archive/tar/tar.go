@@ -7,13 +7,20 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/go-kit/kit/log"
+	"github.com/meltwater/drone-cache/archive/ignore"
 	"github.com/meltwater/drone-cache/internal"
 )
 
-const defaultDirPermission = 0755
+const (
+	defaultDirPermission = 0755
+
+	paxXattrPrefix = "SCHILY.xattr."
+)
 
 var (
 	// ErrSourceNotReachable TODO
@@ -22,17 +29,52 @@ var (
 	ErrArchiveNotReadable = errors.New("archive not readable")
 )
 
+// Entry describes a file in an archive.
+type Entry struct {
+	Name    string
+	Size    int64
+	Mode    os.FileMode
+	ModTime time.Time
+	// Link is the target of symbolic and hard links.
+	Link string
+}
+
 // Archive TODO
 type Archive struct {
 	logger log.Logger
 
 	root         string
 	skipSymlinks bool
+
+	excludes       *ignore.Matcher
+	preserveTimes  bool
+	preserveOwner  bool
+	preserveXattrs bool
+
+	reproducible    bool
+	sourceDateEpoch time.Time
 }
 
 // New creates an archive that uses the .tar file format.
-func New(logger log.Logger, root string, skipSymlinks bool) *Archive {
-	return &Archive{logger, root, skipSymlinks}
+func New(logger log.Logger, root string, skipSymlinks bool, opts ...Option) *Archive {
+	options := options{}
+
+	for _, o := range opts {
+		o.apply(&options)
+	}
+
+	return &Archive{
+		logger:         logger,
+		root:           root,
+		skipSymlinks:   skipSymlinks,
+		excludes:       options.excludes,
+		preserveTimes:  options.preserveTimes,
+		preserveOwner:  options.preserveOwner,
+		preserveXattrs: options.preserveXattrs,
+
+		reproducible:    options.reproducible,
+		sourceDateEpoch: options.sourceDateEpoch,
+	}
 }
 
 // Create writes content of the given source to an archive, returns written bytes.
@@ -40,7 +82,16 @@ func (a *Archive) Create(srcs []string, w io.Writer) (int64, error) {
 	tw := tar.NewWriter(w)
 	defer internal.CloseWithErrLogf(a.logger, tw, "tar writer")
 
-	var written int64
+	var (
+		written int64
+		links   = map[fileID]string{}
+	)
+
+	if a.reproducible {
+		// NOTICE: filepath.Walk visits files in lexical order, only order of the sources has to be fixed.
+		srcs = append([]string(nil), srcs...)
+		sort.Strings(srcs)
+	}
 
 	for _, src := range srcs {
 		_, err := os.Lstat(src)
@@ -48,7 +99,7 @@ func (a *Archive) Create(srcs []string, w io.Writer) (int64, error) {
 			return written, fmt.Errorf("make sure file or directory readable <%s>: %v,, %w", src, err, ErrSourceNotReachable)
 		}
 
-		if err := filepath.Walk(src, writeToArchive(tw, a.root, a.skipSymlinks, &written)); err != nil {
+		if err := filepath.Walk(src, a.writeToArchive(tw, &written, links)); err != nil {
 			return written, fmt.Errorf("walk, add all files to archive, %w", err)
 		}
 	}
@@ -56,8 +107,9 @@ func (a *Archive) Create(srcs []string, w io.Writer) (int64, error) {
 	return written, nil
 }
 
-//nolint: lll
-func writeToArchive(tw *tar.Writer, root string, skipSymlinks bool, written *int64) func(string, os.FileInfo, error) error {
+// writeToArchive returns a walk function that writes visited files to the archive.
+// Regular files sharing an inode with an already written file are added as hard links to its name in links.
+func (a *Archive) writeToArchive(tw *tar.Writer, written *int64, links map[fileID]string) filepath.WalkFunc {
 	return func(path string, fi os.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -67,6 +119,19 @@ func writeToArchive(tw *tar.Writer, root string, skipSymlinks bool, written *int
 			return errors.New("no file info")
 		}
 
+		name, err := relative(a.root, path)
+		if err != nil {
+			return fmt.Errorf("relative name <%s>: <%s>, %w", path, a.root, err)
+		}
+
+		if a.excludes.Match(name, fi.IsDir()) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
 		// Create header for Regular files and Directories
 		h, err := tar.FileInfoHeader(fi, fi.Name())
 		if err != nil {
@@ -74,7 +139,7 @@ func writeToArchive(tw *tar.Writer, root string, skipSymlinks bool, written *int
 		}
 
 		if fi.Mode()&os.ModeSymlink != 0 { // isSymbolic
-			if skipSymlinks {
+			if a.skipSymlinks {
 				return nil
 			}
 
@@ -84,18 +149,32 @@ func writeToArchive(tw *tar.Writer, root string, skipSymlinks bool, written *int
 			}
 		}
 
-		name, err := relative(root, path)
-		if err != nil {
-			return fmt.Errorf("relative name <%s>: <%s>, %w", path, root, err)
+		h.Name = name
+
+		id, linked := hardLinkID(fi)
+		if linked {
+			if first, ok := links[id]; ok {
+				h.Typeflag = tar.TypeLink
+				h.Linkname = first
+				h.Size = 0
+			} else {
+				links[id] = name
+			}
 		}
 
-		h.Name = name
+		if err := a.addMetadata(h, path); err != nil {
+			return fmt.Errorf("add metadata for <%s>, %w", path, err)
+		}
+
+		if a.reproducible {
+			a.normalize(h)
+		}
 
 		if err := tw.WriteHeader(h); err != nil {
 			return fmt.Errorf("write header for <%s>, %w", path, err)
 		}
 
-		if !fi.Mode().IsRegular() {
+		if !fi.Mode().IsRegular() || h.Typeflag == tar.TypeLink {
 			return nil
 		}
 
@@ -113,6 +192,53 @@ func writeToArchive(tw *tar.Writer, root string, skipSymlinks bool, written *int
 	}
 }
 
+// addMetadata adds metadata of the file to the header, that is only recorded in PAX format.
+func (a *Archive) addMetadata(h *tar.Header, path string) error {
+	if a.preserveTimes {
+		// NOTICE: Access time and sub-second precision of modification time are only recorded in PAX format.
+		h.Format = tar.FormatPAX
+	}
+
+	if !a.preserveXattrs {
+		return nil
+	}
+
+	xattrs, err := readXattrs(path)
+	if err != nil {
+		return err
+	}
+
+	if len(xattrs) == 0 {
+		return nil
+	}
+
+	if h.PAXRecords == nil {
+		h.PAXRecords = map[string]string{}
+	}
+
+	for k, v := range xattrs {
+		h.PAXRecords[paxXattrPrefix+k] = v
+	}
+
+	h.Format = tar.FormatPAX
+
+	return nil
+}
+
+// normalize removes metadata of the header that differs between identical sources.
+func (a *Archive) normalize(h *tar.Header) {
+	h.Uid, h.Gid = 0, 0
+	h.Uname, h.Gname = "", ""
+
+	// NOTICE: Same as SOURCE_DATE_EPOCH, modification times newer than the epoch are clamped to it.
+	if h.ModTime.After(a.sourceDateEpoch) {
+		h.ModTime = a.sourceDateEpoch
+	}
+
+	h.AccessTime = time.Time{}
+	h.ChangeTime = time.Time{}
+}
+
 func relative(parent string, path string) (string, error) {
 	name := filepath.Base(path)
 
@@ -125,6 +251,12 @@ func relative(parent string, path string) (string, error) {
 	for strings.HasPrefix(rel, "../") {
 		rel = strings.TrimPrefix(rel, "../")
 	}
+
+	// NOTICE: filepath.Rel gives ".." without a trailing slash when path is right under a sibling of parent.
+	if rel == ".." {
+		rel = "."
+	}
+
 	rel = filepath.ToSlash(rel)
 	return strings.TrimPrefix(filepath.Join(rel, name), "/"), nil
 }
@@ -164,6 +296,7 @@ func (a *Archive) Extract(dst string, r io.Reader) (int64, error) {
 	var (
 		written int64
 		tr      = tar.NewReader(r)
+		dirs    = map[string]*tar.Header{}
 	)
 
 	for {
@@ -171,6 +304,13 @@ func (a *Archive) Extract(dst string, r io.Reader) (int64, error) {
 
 		switch {
 		case err == io.EOF: // if no more files are found return
+			// NOTICE: Metadata of directories restored last, since extracting their contents modifies them.
+			for target, h := range dirs {
+				if err := a.restoreMetadata(h, target); err != nil {
+					return written, fmt.Errorf("restore metadata of directory, %w", err)
+				}
+			}
+
 			return written, nil
 		case err != nil: // return any other error
 			return written, fmt.Errorf("tar reader <%v>, %w", err, ErrArchiveNotReadable)
@@ -178,16 +318,9 @@ func (a *Archive) Extract(dst string, r io.Reader) (int64, error) {
 			continue
 		}
 
-		var target string
-		if dst == h.Name {
-			target = h.Name
-		} else {
-			name, err := relative(dst, h.Name)
-			if err != nil {
-				return 0, fmt.Errorf("relative name, %w", err)
-			}
-
-			target = filepath.Join(dst, name)
+		target, err := targetPath(dst, h.Name)
+		if err != nil {
+			return written, err
 		}
 
 		if err := os.MkdirAll(filepath.Dir(target), defaultDirPermission); err != nil {
@@ -200,6 +333,8 @@ func (a *Archive) Extract(dst string, r io.Reader) (int64, error) {
 				return written, err
 			}
 
+			dirs[target] = h
+
 			continue
 		case tar.TypeReg, tar.TypeRegA, tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
 			n, err := extractRegular(h, tr, target)
@@ -209,15 +344,29 @@ func (a *Archive) Extract(dst string, r io.Reader) (int64, error) {
 				return written, fmt.Errorf("extract regular file, %w", err)
 			}
 
+			if err := a.restoreMetadata(h, target); err != nil {
+				return written, fmt.Errorf("restore metadata of regular file, %w", err)
+			}
+
 			continue
 		case tar.TypeSymlink:
 			if err := extractSymlink(h, target); err != nil {
 				return written, fmt.Errorf("extract symbolic link, %w", err)
 			}
 
+			if err := a.restoreMetadata(h, target); err != nil {
+				return written, fmt.Errorf("restore metadata of symbolic link, %w", err)
+			}
+
 			continue
 		case tar.TypeLink:
-			if err := extractLink(h, target); err != nil {
+			// NOTICE: Link names are relative to the archive root, same as the entry names.
+			linkTarget, err := targetPath(dst, h.Linkname)
+			if err != nil {
+				return written, err
+			}
+
+			if err := extractLink(linkTarget, target); err != nil {
 				return written, fmt.Errorf("extract link, %w", err)
 			}
 
@@ -230,6 +379,49 @@ func (a *Archive) Extract(dst string, r io.Reader) (int64, error) {
 	}
 }
 
+// List reads the given archive reader, returns its entries without extracting them.
+func (a *Archive) List(r io.Reader) ([]Entry, error) {
+	var (
+		entries []Entry
+		tr      = tar.NewReader(r)
+	)
+
+	for {
+		h, err := tr.Next()
+
+		switch {
+		case err == io.EOF:
+			return entries, nil
+		case err != nil:
+			return entries, fmt.Errorf("tar reader <%v>, %w", err, ErrArchiveNotReadable)
+		case h == nil || h.Typeflag == tar.TypeXGlobalHeader:
+			continue
+		}
+
+		entries = append(entries, Entry{
+			Name:    h.Name,
+			Size:    h.Size,
+			Mode:    h.FileInfo().Mode(),
+			ModTime: h.ModTime,
+			Link:    h.Linkname,
+		})
+	}
+}
+
+// targetPath resolves the given archive entry name under the destination.
+func targetPath(dst, name string) (string, error) {
+	if dst == name {
+		return name, nil
+	}
+
+	rel, err := relative(dst, name)
+	if err != nil {
+		return "", fmt.Errorf("relative name, %w", err)
+	}
+
+	return filepath.Join(dst, rel), nil
+}
+
 func extractDir(h *tar.Header, target string) error {
 	if err := os.MkdirAll(target, os.FileMode(h.Mode)); err != nil {
 		return fmt.Errorf("create directory <%s>, %w", target, err)
@@ -238,8 +430,49 @@ func extractDir(h *tar.Header, target string) error {
 	return nil
 }
 
+// restoreMetadata restores owner, extended attributes and times of the extracted file, if enabled.
+func (a *Archive) restoreMetadata(h *tar.Header, target string) error {
+	isSymlink := h.Typeflag == tar.TypeSymlink
+
+	// NOTICE: Only root can change owner of files.
+	if a.preserveOwner && os.Geteuid() == 0 {
+		if err := os.Lchown(target, h.Uid, h.Gid); err != nil {
+			return fmt.Errorf("change owner <%s>, %w", target, err)
+		}
+	}
+
+	// NOTICE: Linux does not allow user extended attributes on symbolic links.
+	if a.preserveXattrs && !isSymlink {
+		xattrs := map[string]string{}
+
+		for k, v := range h.PAXRecords {
+			if strings.HasPrefix(k, paxXattrPrefix) {
+				xattrs[strings.TrimPrefix(k, paxXattrPrefix)] = v
+			}
+		}
+
+		if err := writeXattrs(target, xattrs); err != nil {
+			return err
+		}
+	}
+
+	// NOTICE: os.Chtimes follows symbolic links, so times of the links themselves are not restored.
+	if a.preserveTimes && !isSymlink {
+		atime := h.AccessTime
+		if atime.IsZero() {
+			atime = h.ModTime
+		}
+
+		if err := os.Chtimes(target, atime, h.ModTime); err != nil {
+			return fmt.Errorf("change times <%s>, %w", target, err)
+		}
+	}
+
+	return nil
+}
+
 func extractRegular(h *tar.Header, tr io.Reader, target string) (n int64, err error) {
-	f, err := os.OpenFile(target, os.O_CREATE|os.O_RDWR, os.FileMode(h.Mode))
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_RDWR|os.O_TRUNC, os.FileMode(h.Mode))
 	if err != nil {
 		return 0, fmt.Errorf("open extracted file for writing <%s>, %w", target, err)
 	}
@@ -266,13 +499,13 @@ func extractSymlink(h *tar.Header, target string) error {
 	return nil
 }
 
-func extractLink(h *tar.Header, target string) error {
+func extractLink(linkTarget, target string) error {
 	if err := unlink(target); err != nil {
 		return fmt.Errorf("unlink <%s>, %w", target, err)
 	}
 
-	if err := os.Link(h.Linkname, target); err != nil {
-		return fmt.Errorf("create hard link <%s>, %w", h.Linkname, err)
+	if err := os.Link(linkTarget, target); err != nil {
+		return fmt.Errorf("create hard link <%s>, %w", linkTarget, err)
 	}
 
 	return nil
@@ -1,12 +1,16 @@
 package tar
 
 import (
+	"archive/tar"
+	"bytes"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/meltwater/drone-cache/archive/ignore"
 	"github.com/meltwater/drone-cache/test"
 
 	"github.com/go-kit/kit/log"
@@ -232,6 +236,204 @@ func TestExtract(t *testing.T) {
 	}
 }
 
+func TestCreateWithExcludes(t *testing.T) {
+	test.Ok(t, os.MkdirAll(testRootMounted, 0755))
+	test.Ok(t, os.MkdirAll(testRootExtracted, 0755))
+	t.Cleanup(func() { os.RemoveAll(testRoot) })
+
+	// Setup
+	dir, dirClean := test.CreateTempDir(t, "tar_create_excludes", testRootMounted)
+	t.Cleanup(dirClean)
+
+	test.Ok(t, os.MkdirAll(filepath.Join(dir, "daemon"), 0755))
+	test.Ok(t, os.MkdirAll(filepath.Join(dir, "caches"), 0755))
+	test.Ok(t, ioutil.WriteFile(filepath.Join(dir, "daemon", "daemon.log"), []byte("hello\n"), 0644))
+	test.Ok(t, ioutil.WriteFile(filepath.Join(dir, "caches", "journal.lock"), []byte("hello\n"), 0644))
+	test.Ok(t, ioutil.WriteFile(filepath.Join(dir, "caches", "keep.lock"), []byte("hello\n"), 0644))
+	test.Ok(t, ioutil.WriteFile(filepath.Join(dir, "caches", "module.jar"), []byte("hello\ndrone!\n"), 0644))
+
+	excludes, err := ignore.New("daemon/", "*.lock", "!keep.lock")
+	test.Ok(t, err)
+
+	ta := New(log.NewNopLogger(), testRootMounted, true, WithExcludes(excludes))
+
+	arcDir, arcDirClean := test.CreateTempDir(t, "tar_create_excludes_archives", testRootMounted)
+	t.Cleanup(arcDirClean)
+
+	extDir, extDirClean := test.CreateTempDir(t, "tar_create_excludes_extracted", testRootExtracted)
+	t.Cleanup(extDirClean)
+
+	// Run
+	archivePath := filepath.Join(arcDir, "excludes.tar")
+	written, err := create(ta, []string{dir}, archivePath)
+	test.Ok(t, err)
+
+	_, err = extract(ta, archivePath, extDir)
+	test.Ok(t, err)
+
+	// Test
+	test.Equals(t, int64(19), written) // keep.lock (6 bytes) and module.jar (13 bytes)
+
+	extracted := filepath.Join(extDir, filepath.Base(dir))
+	test.Exists(t, filepath.Join(extracted, "caches", "module.jar"))
+	test.Exists(t, filepath.Join(extracted, "caches", "keep.lock"))
+
+	for _, p := range []string{"daemon", filepath.Join("caches", "journal.lock")} {
+		_, err := os.Lstat(filepath.Join(extracted, p))
+		test.Assert(t, os.IsNotExist(err), "excluded path %s should not exist", p)
+	}
+}
+
+func TestCreateWithHardLinks(t *testing.T) {
+	test.Ok(t, os.MkdirAll(testRootMounted, 0755))
+	test.Ok(t, os.MkdirAll(testRootExtracted, 0755))
+	t.Cleanup(func() { os.RemoveAll(testRoot) })
+
+	// Setup
+	dir, dirClean := test.CreateTempDir(t, "tar_create_hardlinks", testRootMounted)
+	t.Cleanup(dirClean)
+
+	var (
+		file = filepath.Join(dir, "store", "file.txt")
+		link = filepath.Join(dir, "node_modules", "file.txt")
+	)
+
+	test.Ok(t, os.MkdirAll(filepath.Dir(file), 0755))
+	test.Ok(t, os.MkdirAll(filepath.Dir(link), 0755))
+	test.Ok(t, ioutil.WriteFile(file, []byte("hello\ndrone!\n"), 0644)) // 13 bytes
+	test.Ok(t, os.Link(file, link))
+
+	ta := New(log.NewNopLogger(), testRootMounted, false)
+
+	arcDir, arcDirClean := test.CreateTempDir(t, "tar_create_hardlinks_archives", testRootMounted)
+	t.Cleanup(arcDirClean)
+
+	extDir, extDirClean := test.CreateTempDir(t, "tar_create_hardlinks_extracted", testRootExtracted)
+	t.Cleanup(extDirClean)
+
+	archivePath := filepath.Join(arcDir, "hardlinks.tar")
+
+	// Run
+	written, err := create(ta, []string{dir}, archivePath)
+	test.Ok(t, err)
+
+	_, err = extract(ta, archivePath, extDir)
+	test.Ok(t, err)
+
+	// Test
+	test.Equals(t, int64(13), written)
+
+	extracted := filepath.Join(extDir, filepath.Base(dir))
+
+	fi, err := os.Stat(filepath.Join(extracted, "node_modules", "file.txt"))
+	test.Ok(t, err)
+
+	li, err := os.Stat(filepath.Join(extracted, "store", "file.txt"))
+	test.Ok(t, err)
+
+	test.Assert(t, os.SameFile(fi, li), "extracted files are not hard linked")
+	test.EqualDirs(t, extDir, testRootMounted, []string{dir})
+}
+
+func TestCreateReproducible(t *testing.T) {
+	test.Ok(t, os.MkdirAll(testRootMounted, 0755))
+	t.Cleanup(func() { os.RemoveAll(testRoot) })
+
+	// Setup
+	files := exampleFileTree(t, "tar_create_reproducible")
+
+	epoch := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	ta := New(log.NewNopLogger(), testRootMounted, false, WithReproducible(true), WithSourceDateEpoch(epoch))
+
+	arcDir, arcDirClean := test.CreateTempDir(t, "tar_create_reproducible_archives", testRootMounted)
+	t.Cleanup(arcDirClean)
+
+	// Run
+	firstPath := filepath.Join(arcDir, "first.tar")
+	_, err := create(ta, files, firstPath)
+	test.Ok(t, err)
+
+	later := time.Now().Add(time.Hour)
+	for _, f := range files {
+		test.Ok(t, os.Chtimes(f, later, later))
+	}
+
+	secondPath := filepath.Join(arcDir, "second.tar")
+	_, err = create(ta, []string{files[1], files[0]}, secondPath)
+	test.Ok(t, err)
+
+	// Test
+	first, err := ioutil.ReadFile(firstPath)
+	test.Ok(t, err)
+
+	second, err := ioutil.ReadFile(secondPath)
+	test.Ok(t, err)
+
+	test.Assert(t, bytes.Equal(first, second), "archives of identical sources differ")
+
+	tr := tar.NewReader(bytes.NewReader(first))
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+
+		test.Ok(t, err)
+		test.Equals(t, 0, h.Uid)
+		test.Equals(t, "", h.Uname)
+		test.Assert(t, !h.ModTime.After(epoch), "modification time of <%s> is not clamped, got %v", h.Name, h.ModTime)
+	}
+}
+
+func TestExtractWithPreserveTimes(t *testing.T) {
+	test.Ok(t, os.MkdirAll(testRootMounted, 0755))
+	test.Ok(t, os.MkdirAll(testRootExtracted, 0755))
+	t.Cleanup(func() { os.RemoveAll(testRoot) })
+
+	// Setup
+	dir, dirClean := test.CreateTempDir(t, "tar_extract_times", testRootMounted)
+	t.Cleanup(dirClean)
+
+	var (
+		nested = filepath.Join(dir, "nested")
+		file   = filepath.Join(nested, "file.txt")
+		mtime  = time.Date(2019, 2, 19, 8, 0, 0, 123456789, time.UTC)
+		atime  = time.Date(2019, 2, 20, 8, 0, 0, 0, time.UTC)
+	)
+
+	test.Ok(t, os.MkdirAll(nested, 0755))
+	test.Ok(t, ioutil.WriteFile(file, []byte("hello\ndrone!\n"), 0644))
+	test.Ok(t, os.Chtimes(file, atime, mtime))
+	test.Ok(t, os.Chtimes(nested, atime, mtime))
+
+	ta := New(log.NewNopLogger(), testRootMounted, false, WithPreserveTimes(true))
+
+	arcDir, arcDirClean := test.CreateTempDir(t, "tar_extract_times_archives", testRootMounted)
+	t.Cleanup(arcDirClean)
+
+	extDir, extDirClean := test.CreateTempDir(t, "tar_extract_times_extracted", testRootExtracted)
+	t.Cleanup(extDirClean)
+
+	archivePath := filepath.Join(arcDir, "times.tar")
+	_, err := create(ta, []string{dir}, archivePath)
+	test.Ok(t, err)
+
+	// Run
+	_, err = extract(ta, archivePath, extDir)
+	test.Ok(t, err)
+
+	// Test
+	extracted := filepath.Join(extDir, filepath.Base(dir), "nested")
+
+	fi, err := os.Stat(filepath.Join(extracted, "file.txt"))
+	test.Ok(t, err)
+	test.Assert(t, fi.ModTime().Equal(mtime), "file modification time got %v want %v", fi.ModTime(), mtime)
+
+	di, err := os.Stat(extracted)
+	test.Ok(t, err)
+	test.Assert(t, di.ModTime().Equal(mtime), "directory modification time got %v want %v", di.ModTime(), mtime)
+}
+
 // Helpers
 
 func create(a *Archive, srcs []string, dst string) (int64, error) {
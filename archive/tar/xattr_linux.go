@@ -0,0 +1,76 @@
+package tar
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// readXattrs reads extended attributes of the given path, without following symbolic links.
+func readXattrs(path string) (map[string]string, error) {
+	size, err := unix.Llistxattr(path, nil)
+	if err != nil {
+		if errors.Is(err, unix.ENOTSUP) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("list extended attributes <%s>, %w", path, err)
+	}
+
+	if size == 0 {
+		return nil, nil
+	}
+
+	buf := make([]byte, size)
+
+	size, err = unix.Llistxattr(path, buf)
+	if err != nil {
+		return nil, fmt.Errorf("list extended attributes <%s>, %w", path, err)
+	}
+
+	xattrs := map[string]string{}
+
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+
+		value, err := getXattr(path, string(name))
+		if err != nil {
+			return nil, err
+		}
+
+		xattrs[string(name)] = value
+	}
+
+	return xattrs, nil
+}
+
+func getXattr(path, name string) (string, error) {
+	size, err := unix.Lgetxattr(path, name, nil)
+	if err != nil {
+		return "", fmt.Errorf("get extended attribute <%s> of <%s>, %w", name, path, err)
+	}
+
+	buf := make([]byte, size)
+
+	size, err = unix.Lgetxattr(path, name, buf)
+	if err != nil {
+		return "", fmt.Errorf("get extended attribute <%s> of <%s>, %w", name, path, err)
+	}
+
+	return string(buf[:size]), nil
+}
+
+// writeXattrs sets given extended attributes of the given path, without following symbolic links.
+func writeXattrs(path string, xattrs map[string]string) error {
+	for name, value := range xattrs {
+		if err := unix.Lsetxattr(path, name, []byte(value), 0); err != nil {
+			return fmt.Errorf("set extended attribute <%s> of <%s>, %w", name, path, err)
+		}
+	}
+
+	return nil
+}
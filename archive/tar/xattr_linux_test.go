@@ -0,0 +1,51 @@
+package tar
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"golang.org/x/sys/unix"
+
+	"github.com/meltwater/drone-cache/test"
+)
+
+func TestExtractWithPreserveXattrs(t *testing.T) {
+	test.Ok(t, os.MkdirAll(testRootMounted, 0755))
+	test.Ok(t, os.MkdirAll(testRootExtracted, 0755))
+	t.Cleanup(func() { os.RemoveAll(testRoot) })
+
+	// Setup
+	dir, dirClean := test.CreateTempDir(t, "tar_extract_xattrs", testRootMounted)
+	t.Cleanup(dirClean)
+
+	file := filepath.Join(dir, "file.txt")
+	test.Ok(t, ioutil.WriteFile(file, []byte("hello\ndrone!\n"), 0644))
+
+	if err := unix.Lsetxattr(file, "user.drone-cache", []byte("test"), 0); err != nil {
+		t.Skipf("extended attributes are not supported, %v", err)
+	}
+
+	ta := New(log.NewNopLogger(), testRootMounted, false, WithPreserveXattrs(true))
+
+	arcDir, arcDirClean := test.CreateTempDir(t, "tar_extract_xattrs_archives", testRootMounted)
+	t.Cleanup(arcDirClean)
+
+	extDir, extDirClean := test.CreateTempDir(t, "tar_extract_xattrs_extracted", testRootExtracted)
+	t.Cleanup(extDirClean)
+
+	archivePath := filepath.Join(arcDir, "xattrs.tar")
+	_, err := create(ta, []string{dir}, archivePath)
+	test.Ok(t, err)
+
+	// Run
+	_, err = extract(ta, archivePath, extDir)
+	test.Ok(t, err)
+
+	// Test
+	xattrs, err := readXattrs(filepath.Join(extDir, filepath.Base(dir), "file.txt"))
+	test.Ok(t, err)
+	test.Equals(t, map[string]string{"user.drone-cache": "test"}, xattrs)
+}
@@ -0,0 +1,9 @@
+// +build !linux
+
+package tar
+
+// readXattrs is a no-op, extended attributes are only supported on linux.
+func readXattrs(_ string) (map[string]string, error) { return nil, nil }
+
+// writeXattrs is a no-op, extended attributes are only supported on linux.
+func writeXattrs(_ string, _ map[string]string) error { return nil }
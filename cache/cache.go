@@ -2,8 +2,6 @@
 package cache
 
 import (
-	"time"
-
 	"github.com/go-kit/kit/log"
 	"github.com/meltwater/drone-cache/archive"
 	"github.com/meltwater/drone-cache/key"
@@ -43,15 +41,11 @@ type cache struct {
 
 // New creates a new cache with given parameters.
 func New(logger log.Logger, s storage.Storage, a archive.Archive, g key.Generator, opts ...Option) Cache {
-	options := options{}
-
-	for _, o := range opts {
-		o.apply(&options)
-	}
+	options := newOptions(opts...)
 
 	return &cache{
-		NewRebuilder(log.With(logger, "component", "rebuilder"), s, a, g, options.fallbackGenerator, options.namespace, options.override),
-		NewRestorer(log.With(logger, "component", "restorer"), s, a, g, options.fallbackGenerator, options.namespace),
-		NewFlusher(log.With(logger, "component", "flusher"), s, time.Hour),
+		NewRebuilder(log.With(logger, "component", "rebuilder"), s, a, g, opts...),
+		NewRestorer(log.With(logger, "component", "restorer"), s, a, g, opts...),
+		NewFlusher(log.With(logger, "component", "flusher"), s, options.namespace, options.flushTTL, options.dryRun),
 	}
 }
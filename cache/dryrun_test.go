@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/meltwater/drone-cache/archive/tar"
+	"github.com/meltwater/drone-cache/test"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestDryRun(t *testing.T) {
+	// Setup
+	dir, dirClean := test.CreateTempDir(t, "dry_run")
+	t.Cleanup(dirClean)
+
+	test.Ok(t, ioutil.WriteFile(filepath.Join(dir, "file.txt"), []byte("hello\n"), 0644))
+
+	var (
+		s      = newMemStorage()
+		a      = tar.New(log.NewNopLogger(), filepath.Dir(dir), false)
+		rec    = &recorder{}
+		mounts = []string{dir}
+	)
+
+	newRebuilder := func(dryRun bool) Rebuilder {
+		return NewRebuilder(log.NewNopLogger(), s, a, staticGenerator("key"),
+			WithNamespace("namespace"), WithRecorder(rec), WithDryRun(dryRun))
+	}
+
+	newRestorer := func(k string) Restorer {
+		return NewRestorer(log.NewNopLogger(), s, a, staticGenerator(k),
+			WithNamespace("namespace"), WithRecorder(rec), WithDryRun(true))
+	}
+
+	// Run & Test
+	test.Ok(t, newRebuilder(true).Rebuild(mounts))
+	test.Equals(t, 0, len(s.objects))
+
+	estimated := rec.results[0]
+	test.Assert(t, estimated.DryRun, "result is not marked as a dry run")
+	test.Assert(t, !estimated.Skipped, "missing cache is skipped")
+	test.Equals(t, int64(6), estimated.Size)
+	test.Assert(t, estimated.Transferred > estimated.Size, "archive size is not estimated")
+
+	test.NotOk(t, newRestorer("key").Restore(mounts))
+	test.Assert(t, !rec.results[1].Hit, "missing cache is a hit")
+
+	test.Ok(t, newRebuilder(false).Rebuild(mounts))
+	test.Equals(t, 1, len(s.objects))
+
+	test.Ok(t, newRebuilder(true).Rebuild(mounts))
+	test.Assert(t, rec.results[3].Skipped, "existing cache is not skipped")
+
+	test.Ok(t, newRestorer("key").Restore(mounts))
+	test.Equals(t, 0, s.gets[filepath.Base(dir)])
+
+	restored := rec.results[4]
+	test.Assert(t, restored.Hit && restored.DryRun, "existing cache is not a dry run hit")
+	test.Equals(t, estimated.Transferred, restored.Transferred)
+}
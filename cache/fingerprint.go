@@ -0,0 +1,213 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/meltwater/drone-cache/archive/ignore"
+	"github.com/meltwater/drone-cache/internal"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+const (
+	fingerprintSuffix = ".fingerprint"
+	// maxFingerprintSize limits the size of stored fingerprints, objects that are not fingerprints are not read further.
+	maxFingerprintSize = 1 << 10 // 1 KiB
+)
+
+// Fingerprint computes a digest of the given source directory or file, that changes when its content changes.
+type Fingerprint func(src string) (string, error)
+
+// Fingerprint modes.
+const (
+	FingerprintMetadata = "metadata"
+	FingerprintContent  = "content"
+)
+
+// FingerprintFromMode returns the fingerprint of the given mode.
+// Metadata mode digests paths, modes, sizes and modification times of files, content mode digests their contents instead of times.
+// Paths matched by the excludes, relative to the root, are skipped the same way archives skip them.
+// Settings, such as the archive format or the encryption keys, are digested too,
+// so that changing them changes the fingerprint.
+func FingerprintFromMode(mode, root string, excludes *ignore.Matcher, settings ...string) (Fingerprint, error) {
+	var entry fingerprintEntry
+
+	switch mode {
+	case FingerprintMetadata, "":
+		entry = metadataEntry
+	case FingerprintContent:
+		entry = contentEntry
+	default:
+		return nil, fmt.Errorf("unknown fingerprint mode <%s>", mode)
+	}
+
+	return func(src string) (string, error) {
+		return fingerprint(src, root, excludes, settings, entry)
+	}, nil
+}
+
+// fingerprintEntry digests the mode specific part of a file.
+type fingerprintEntry func(h hash.Hash, path string, fi os.FileInfo) error
+
+func metadataEntry(h hash.Hash, path string, fi os.FileInfo) error {
+	_, err := fmt.Fprintf(h, "%d\x00", fi.ModTime().UnixNano())
+	return err
+}
+
+func contentEntry(h hash.Hash, path string, fi os.FileInfo) error {
+	if !fi.Mode().IsRegular() {
+		return nil
+	}
+
+	return hashFile(h, path)
+}
+
+func fingerprint(src, root string, excludes *ignore.Matcher, settings []string,
+	entry fingerprintEntry) (string, error) {
+	h := sha256.New()
+
+	if _, err := fmt.Fprintf(h, "%d\x00", len(settings)); err != nil {
+		return "", err
+	}
+
+	for _, s := range settings {
+		if _, err := io.WriteString(h, s+"\x00"); err != nil {
+			return "", err
+		}
+	}
+
+	// NOTICE: filepath.Walk visits files in lexical order, which keeps the digest stable.
+	err := filepath.Walk(src, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if excludes != nil && excludes.Match(archiveName(root, path), fi.IsDir()) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return fmt.Errorf("relative path <%s>, %w", path, err)
+		}
+
+		if _, err := fmt.Fprintf(h, "%s\x00%s\x00%d\x00", filepath.ToSlash(rel), fi.Mode(), fi.Size()); err != nil {
+			return err
+		}
+
+		if fi.Mode()&os.ModeSymlink != 0 {
+			lnk, err := os.Readlink(path)
+			if err != nil {
+				return fmt.Errorf("read link <%s>, %w", path, err)
+			}
+
+			if _, err := io.WriteString(h, lnk+"\x00"); err != nil {
+				return err
+			}
+		}
+
+		return entry(h, path, fi)
+	})
+	if err != nil {
+		return "", fmt.Errorf("fingerprint <%s>, %w", src, err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// archiveName returns the slash separated name of the path relative to the root, as archives name their entries.
+func archiveName(root, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+
+	rel = filepath.ToSlash(rel)
+
+	// NOTICE: Archives name paths out of the root relative to their closest common parent.
+	for strings.HasPrefix(rel, "../") {
+		rel = strings.TrimPrefix(rel, "../")
+	}
+
+	if rel == ".." {
+		rel = "."
+	}
+
+	return rel
+}
+
+func hashFile(w io.Writer, path string) (err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open file <%s>, %w", path, err)
+	}
+
+	defer internal.CloseWithErrCapturef(&err, f, "hash file <%s>", path)
+
+	if _, err := io.Copy(w, f); err != nil {
+		return fmt.Errorf("read file <%s>, %w", path, err)
+	}
+
+	return nil
+}
+
+// unchanged checks if the fingerprint stored next to the given destination matches the given fingerprint.
+// When a signer is set, the stored fingerprint must be signed by it too.
+func (r rebuilder) unchanged(dst, fp string) (bool, error) {
+	exists, err := r.s.Exists(dst + fingerprintSuffix)
+	if err != nil {
+		return false, fmt.Errorf("fingerprint <%s> existence check, %w", dst, err)
+	}
+
+	if !exists {
+		return false, nil
+	}
+
+	var buf bytes.Buffer
+	if err := r.s.Get(dst+fingerprintSuffix, &limitedWriter{w: &buf, n: maxFingerprintSize}); err != nil {
+		if errors.Is(err, errLimitExceeded) {
+			level.Debug(r.logger).Log("msg", "fingerprint exceeds its size limit", "remote", dst)
+			return false, nil
+		}
+
+		return false, fmt.Errorf("get fingerprint <%s>, %w", dst, err)
+	}
+
+	if strings.TrimSpace(buf.String()) != fp {
+		return false, nil
+	}
+
+	if r.signer != nil {
+		var sig bytes.Buffer
+		if err := r.s.Get(dst+fingerprintSuffix+signatureSuffix, &limitedWriter{w: &sig, n: maxSignatureSize}); err != nil {
+			level.Debug(r.logger).Log("msg", "fingerprint is not signed", "remote", dst, "err", err)
+			return false, nil
+		}
+
+		if err := r.signer.verifier().verify(dst+fingerprintSuffix, fp, sig.Bytes()); err != nil {
+			level.Debug(r.logger).Log("msg", "fingerprint is not trusted", "remote", dst, "err", err)
+			return false, nil
+		}
+	}
+
+	// NOTICE: Archive might have been removed while its fingerprint remained.
+	exists, err = r.s.Exists(dst)
+	if err != nil {
+		return false, fmt.Errorf("destination <%s> existence check, %w", dst, err)
+	}
+
+	return exists, nil
+}
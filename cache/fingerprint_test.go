@@ -0,0 +1,248 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meltwater/drone-cache/archive/ignore"
+	"github.com/meltwater/drone-cache/archive/tar"
+	"github.com/meltwater/drone-cache/test"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestFingerprint(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		fingerprint     Fingerprint
+		touchChanges    bool
+		contentsChanges bool
+	}{
+		{
+			name:            "metadata",
+			fingerprint:     fingerprintOf(t, FingerprintMetadata),
+			touchChanges:    true,
+			contentsChanges: true,
+		},
+		{
+			name:            "content",
+			fingerprint:     fingerprintOf(t, FingerprintContent),
+			touchChanges:    false,
+			contentsChanges: true,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			// Setup
+			dir, dirClean := test.CreateTempDir(t, "fingerprint")
+			t.Cleanup(dirClean)
+
+			file := filepath.Join(dir, "nested", "file.txt")
+			test.Ok(t, os.MkdirAll(filepath.Dir(file), 0755))
+			test.Ok(t, ioutil.WriteFile(file, []byte("hello\n"), 0644))
+
+			// Run
+			initial, err := tc.fingerprint(dir)
+			test.Ok(t, err)
+
+			same, err := tc.fingerprint(dir)
+			test.Ok(t, err)
+
+			later := time.Now().Add(time.Hour)
+			test.Ok(t, os.Chtimes(file, later, later))
+
+			touched, err := tc.fingerprint(dir)
+			test.Ok(t, err)
+
+			test.Ok(t, ioutil.WriteFile(file, []byte("hello!\n"), 0644))
+			test.Ok(t, os.Chtimes(file, later, later))
+
+			changed, err := tc.fingerprint(dir)
+			test.Ok(t, err)
+
+			// Test
+			test.Equals(t, initial, same)
+			test.Equals(t, tc.touchChanges, initial != touched)
+			test.Equals(t, tc.contentsChanges, touched != changed)
+		})
+	}
+}
+
+func TestFingerprintFromMode(t *testing.T) {
+	_, err := FingerprintFromMode("unknown", "", nil)
+	test.NotOk(t, err)
+
+	for _, mode := range []string{"", FingerprintMetadata, FingerprintContent} {
+		_, err := FingerprintFromMode(mode, "", nil)
+		test.Ok(t, err)
+	}
+}
+
+func TestFingerprintExcludes(t *testing.T) {
+	// Setup
+	dir, dirClean := test.CreateTempDir(t, "fingerprint_excludes")
+	t.Cleanup(dirClean)
+
+	test.Ok(t, os.MkdirAll(filepath.Join(dir, "mount", "logs"), 0755))
+	test.Ok(t, ioutil.WriteFile(filepath.Join(dir, "mount", "file.txt"), []byte("hello\n"), 0644))
+
+	m, err := ignore.New("mount/logs/", "*.lock")
+	test.Ok(t, err)
+
+	fp, err := FingerprintFromMode(FingerprintContent, dir, m)
+	test.Ok(t, err)
+
+	src := filepath.Join(dir, "mount")
+
+	initial, err := fp(src)
+	test.Ok(t, err)
+
+	// Run
+	test.Ok(t, ioutil.WriteFile(filepath.Join(dir, "mount", "logs", "daemon.log"), []byte("started\n"), 0644))
+	test.Ok(t, ioutil.WriteFile(filepath.Join(dir, "mount", "build.lock"), []byte("1\n"), 0644))
+
+	excluded, err := fp(src)
+	test.Ok(t, err)
+
+	test.Ok(t, ioutil.WriteFile(filepath.Join(dir, "mount", "file.txt"), []byte("hello, drone!\n"), 0644))
+
+	changed, err := fp(src)
+	test.Ok(t, err)
+
+	// Test
+	test.Equals(t, initial, excluded, "excluded files change the fingerprint")
+	test.Assert(t, excluded != changed, "included files do not change the fingerprint")
+}
+
+func TestFingerprintSettings(t *testing.T) {
+	// Setup
+	dir, dirClean := test.CreateTempDir(t, "fingerprint_settings")
+	t.Cleanup(dirClean)
+
+	test.Ok(t, ioutil.WriteFile(filepath.Join(dir, "file.txt"), []byte("hello\n"), 0644))
+
+	digest := func(settings ...string) string {
+		fp, err := FingerprintFromMode(FingerprintContent, dir, nil, settings...)
+		test.Ok(t, err)
+
+		d, err := fp(dir)
+		test.Ok(t, err)
+
+		return d
+	}
+
+	// Run
+	var (
+		initial = digest("archive-format=tar", "compression-level=-1")
+		same    = digest("archive-format=tar", "compression-level=-1")
+		format  = digest("archive-format=gzip", "compression-level=-1")
+		level   = digest("archive-format=tar", "compression-level=9")
+		key     = digest("archive-format=tar", "compression-level=-1", "archive-encryption-key=key")
+	)
+
+	// Test
+	test.Equals(t, initial, same)
+	test.Assert(t, initial != format, "archive format does not change the fingerprint")
+	test.Assert(t, initial != level, "compression level does not change the fingerprint")
+	test.Assert(t, initial != key, "encryption keys do not change the fingerprint")
+}
+
+func TestOversizedFingerprint(t *testing.T) {
+	// Setup
+	dir, dirClean := test.CreateTempDir(t, "oversized_fingerprint")
+	t.Cleanup(dirClean)
+
+	test.Ok(t, ioutil.WriteFile(filepath.Join(dir, "file.txt"), []byte("hello\n"), 0644))
+
+	var (
+		s   = newMemStorage()
+		a   = tar.New(log.NewNopLogger(), filepath.Dir(dir), false)
+		fp  = fingerprintOf(t, FingerprintContent)
+		dst = path.Join("namespace", "key", filepath.ToSlash(dir))
+		rb  = NewRebuilder(log.NewNopLogger(), s, a, staticGenerator("key"),
+			WithNamespace("namespace"), WithFingerprint(fp))
+	)
+
+	d, err := fp(dir)
+	test.Ok(t, err)
+
+	// NOTICE: Stored fingerprint is padded beyond the limit, it must not be read into memory as a whole.
+	test.Ok(t, s.Put(dst, bytes.NewReader([]byte("archive"))))
+	test.Ok(t, s.Put(dst+fingerprintSuffix, io.MultiReader(strings.NewReader(d),
+		strings.NewReader(strings.Repeat(" ", 2*maxFingerprintSize)))))
+
+	// Run
+	test.Ok(t, rb.Rebuild([]string{dir}))
+
+	// Test
+	test.Equals(t, 2, s.puts[filepath.Base(dir)], "oversized fingerprint skips the upload")
+}
+
+func TestSignedFingerprint(t *testing.T) {
+	// Setup
+	dir, dirClean := test.CreateTempDir(t, "signed_fingerprint")
+	t.Cleanup(dirClean)
+
+	test.Ok(t, ioutil.WriteFile(filepath.Join(dir, "file.txt"), []byte("hello\n"), 0644))
+
+	_, k, err := ed25519.GenerateKey(rand.Reader)
+	test.Ok(t, err)
+
+	var (
+		s       = newMemStorage()
+		a       = tar.New(log.NewNopLogger(), filepath.Dir(dir), false)
+		g       = staticGenerator("key")
+		dst     = path.Join("namespace", "key", filepath.ToSlash(dir))
+		archive = filepath.Base(dir)
+	)
+
+	rebuilder := func(signer *Signer) Rebuilder {
+		return NewRebuilder(log.NewNopLogger(), s, a, g,
+			WithNamespace("namespace"), WithFingerprint(fingerprintOf(t, FingerprintContent)), WithSigner(signer))
+	}
+
+	fp, err := fingerprintOf(t, FingerprintContent)(dir)
+	test.Ok(t, err)
+
+	// NOTICE: Untrusted build plants the archive and the fingerprint of the source, without a signature.
+	test.Ok(t, s.Put(dst, bytes.NewReader([]byte("planted"))))
+	test.Ok(t, s.Put(dst+fingerprintSuffix, bytes.NewReader([]byte(fp))))
+
+	// Run & Test
+	// NOTICE: Without a signer, fingerprints are trusted as they are.
+	test.Ok(t, rebuilder(nil).Rebuild([]string{dir}))
+	test.Equals(t, 1, s.puts[archive], "planted fingerprint is not used")
+
+	test.Ok(t, rebuilder(NewSigner(k, "repo")).Rebuild([]string{dir}))
+	test.Equals(t, 2, s.puts[archive], "unsigned fingerprint skips the upload")
+
+	test.Ok(t, rebuilder(NewSigner(k, "repo")).Rebuild([]string{dir}))
+	test.Equals(t, 2, s.puts[archive], "signed fingerprint does not skip the upload")
+
+	_, other, err := ed25519.GenerateKey(rand.Reader)
+	test.Ok(t, err)
+
+	test.Ok(t, rebuilder(NewSigner(other, "repo")).Rebuild([]string{dir}))
+	test.Equals(t, 3, s.puts[archive], "fingerprint signed by another key skips the upload")
+}
+
+// Helpers
+
+// fingerprintOf returns the fingerprint of the given mode, without excludes or settings.
+func fingerprintOf(t *testing.T, mode string) Fingerprint {
+	t.Helper()
+
+	fp, err := FingerprintFromMode(mode, "", nil)
+	test.Ok(t, err)
+
+	return fp
+}
@@ -1,31 +1,66 @@
 package cache
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"path"
 	"time"
 
 	"github.com/meltwater/drone-cache/storage"
-	"github.com/meltwater/drone-cache/storage/backend"
+	"github.com/meltwater/drone-cache/storage/common"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 )
 
+// DefaultFlushTTL is the age after which flush removes caches, unless it is set.
+const DefaultFlushTTL = 7 * 24 * time.Hour
+
 type flusher struct {
 	logger log.Logger
 
-	store storage.Storage
-	dirty func(backend.FileEntry) bool
+	store     storage.Storage
+	namespace string
+	dirty     func(common.FileEntry) bool
+	dryRun    bool
+}
+
+// NewFlusher creates a new cache flusher, that removes objects of the namespace not modified for the given ttl.
+// On a dry run, expired objects are only logged.
+func NewFlusher(logger log.Logger, s storage.Storage, namespace string, ttl time.Duration, dryRun bool) Flusher {
+	return flusher{logger: logger, store: s, namespace: namespace, dirty: IsExpired(ttl), dryRun: dryRun}
 }
 
-// NewFlusher creates a new cache flusher.
-func NewFlusher(logger log.Logger, s storage.Storage, ttl time.Duration) Flusher {
-	return flusher{logger: logger, store: s, dirty: IsExpired(ttl)}
+// referencer is implemented by storages that store objects as references to shared, content-addressed objects,
+// such as chunked.Storage.
+type referencer interface {
+	// References returns the paths of the shared objects that the object with given key refers to.
+	References(p string) ([]string, error)
+	// Shared reports whether the given path is a shared object.
+	Shared(p string) bool
 }
 
-// Flush cleans the expired files from the cache.
+// Flush cleans the expired files under the given paths of the namespace, the whole namespace if none is given.
+// Shared objects, chunks and files of incremental caches, are only removed when no remaining cache refers to them.
 func (f flusher) Flush(srcs []string) error {
+	if len(srcs) == 0 {
+		srcs = []string{""}
+	}
+
+	var (
+		flushed int
+		deleted = map[string]bool{}
+		shared  []common.FileEntry
+	)
+
 	for _, src := range srcs {
+		src = path.Join(f.namespace, src)
+		if src == "" {
+			return errors.New("flusher, neither namespace nor path is set, refusing to flush the whole storage")
+		}
+
 		level.Info(f.logger).Log("msg", "Cleaning files", "src", src)
 
 		files, err := f.store.List(src)
@@ -34,21 +69,190 @@ func (f flusher) Flush(srcs []string) error {
 		}
 
 		for _, file := range files {
-			if f.dirty(file) {
-				err := f.store.Delete(file.Path)
-				if err != nil {
-					return fmt.Errorf("flusher delete, %w", err)
-				}
+			if !f.dirty(file) || deleted[file.Path] {
+				continue
+			}
+
+			// NOTICE: Shared objects are reused without being uploaded again, their age does not tell whether they are in use.
+			if f.shared(file.Path) {
+				shared = append(shared, file)
+				continue
+			}
+
+			if err := f.delete(file); err != nil {
+				return err
+			}
+
+			deleted[file.Path] = true
+			flushed++
+		}
+	}
+
+	n, err := f.sweep(shared, deleted)
+	if err != nil {
+		return err
+	}
+
+	flushed += n
+
+	if f.dryRun {
+		level.Info(f.logger).Log("msg", "dry run, cache not flushed", "expired files", flushed)
+		return nil
+	}
+
+	level.Info(f.logger).Log("msg", "cache flushed", "deleted files", flushed)
+
+	return nil
+}
+
+// sweep deletes the expired shared objects that none of the remaining objects of the namespace refer to.
+func (f flusher) sweep(expired []common.FileEntry, deleted map[string]bool) (int, error) {
+	if len(expired) == 0 {
+		return 0, nil
+	}
+
+	files, err := f.store.List(f.namespace)
+	if err != nil {
+		return 0, fmt.Errorf("flusher list, %w", err)
+	}
+
+	var (
+		live         []string
+		sharedFiles  []string
+		fileRefs     = map[string]bool{}
+		expiredPaths = map[string]bool{}
+	)
+
+	for _, file := range expired {
+		expiredPaths[file.Path] = true
+	}
+
+	for _, file := range files {
+		switch {
+		case deleted[file.Path]:
+		case f.isFile(file.Path):
+			sharedFiles = append(sharedFiles, file.Path)
+		case !f.shared(file.Path):
+			live = append(live, file.Path)
+		}
+	}
+
+	// Files of incremental caches are referred to by the file manifests.
+	if len(sharedFiles) > 0 {
+		for _, p := range live {
+			refs, err := f.fileReferences(p)
+			if err != nil {
+				return 0, err
+			}
+
+			for _, ref := range refs {
+				fileRefs[ref] = true
+			}
+		}
+	}
+
+	// Chunks are referred to by the remaining objects, including the files that are kept.
+	refs := map[string]bool{}
+
+	if r, ok := f.store.(referencer); ok {
+		for _, p := range sharedFiles {
+			if !expiredPaths[p] || fileRefs[p] {
+				live = append(live, p)
+			}
+		}
+
+		for _, p := range live {
+			chunks, err := r.References(p)
+			if err != nil {
+				return 0, fmt.Errorf("flusher references of <%s>, %w", p, err)
 			}
+
+			for _, c := range chunks {
+				refs[c] = true
+			}
+		}
+	}
+
+	var flushed int
+
+	for _, file := range expired {
+		if refs[file.Path] || fileRefs[file.Path] {
+			continue
 		}
+
+		if err := f.delete(file); err != nil {
+			return flushed, err
+		}
+
+		flushed++
+	}
+
+	return flushed, nil
+}
+
+// fileReferences returns the paths of the files that the object refers to, if it is a file manifest of an incremental cache.
+func (f flusher) fileReferences(p string) ([]string, error) {
+	var buf bytes.Buffer
+
+	err := f.store.Get(p, &manifestWriter{w: &buf, n: maxFileManifestSize})
+	if errors.Is(err, errNotFileManifest) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("flusher get <%s>, %w", p, err)
+	}
+
+	var m fileManifest
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil || m.Version != fileManifestVersion {
+		return nil, nil
+	}
+
+	refs := make([]string, 0, len(m.Files))
+
+	for _, e := range m.Files {
+		if e.Digest != "" {
+			refs = append(refs, filePath(f.namespace, e.Digest))
+		}
+	}
+
+	return refs, nil
+}
+
+func (f flusher) delete(file common.FileEntry) error {
+	if f.dryRun {
+		level.Info(f.logger).Log("msg", "dry run, would delete expired file", "remote", file.Path, "last modified", file.LastModified)
+		return nil
+	}
+
+	level.Debug(f.logger).Log("msg", "deleting expired file", "remote", file.Path, "last modified", file.LastModified)
+
+	if err := f.store.Delete(file.Path); err != nil {
+		return fmt.Errorf("flusher delete, %w", err)
 	}
 
 	return nil
 }
 
+// shared reports whether the path is an object that might be shared by many caches.
+func (f flusher) shared(p string) bool {
+	if f.isFile(p) {
+		return true
+	}
+
+	r, ok := f.store.(referencer)
+
+	return ok && r.Shared(p)
+}
+
+// isFile reports whether the path is a file of incremental caches.
+func (f flusher) isFile(p string) bool {
+	return common.IsUnder(p, path.Join(f.namespace, filesNamespace))
+}
+
 // IsExpired creates a function to check if file expired.
-func IsExpired(ttl time.Duration) func(file backend.FileEntry) bool {
-	return func(file backend.FileEntry) bool {
+func IsExpired(ttl time.Duration) func(file common.FileEntry) bool {
+	return func(file common.FileEntry) bool {
 		return time.Now().After(file.LastModified.Add(ttl))
 	}
 }
@@ -1,8 +1,207 @@
 package cache
 
-import "testing"
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meltwater/drone-cache/storage/chunked"
+	"github.com/meltwater/drone-cache/test"
+
+	"github.com/go-kit/kit/log"
+)
 
 func TestFlush(t *testing.T) {
-	// Implement me!
-	t.Skip("skipping unimplemented test.")
+	t.Parallel()
+
+	// Setup
+	s := newMemStorage()
+
+	for _, p := range []string{"repo/old/mount", "repo/new/mount", "repo/other/old/mount", "other/old/mount"} {
+		test.Ok(t, s.Put(p, strings.NewReader(p)))
+
+		if strings.Contains(p, "old") {
+			s.modified[p] = time.Now().Add(-2 * time.Hour)
+		}
+	}
+
+	f := NewFlusher(log.NewNopLogger(), s, "repo", time.Hour, false)
+
+	// Run
+	test.Ok(t, f.Flush(nil))
+
+	// Test
+	entries, err := s.List("")
+	test.Ok(t, err)
+
+	var remaining []string
+	for _, e := range entries {
+		remaining = append(remaining, e.Path)
+	}
+
+	test.Equals(t, []string{"other/old/mount", "repo/new/mount"}, remaining)
+}
+
+func TestFlushPaths(t *testing.T) {
+	t.Parallel()
+
+	// Setup
+	s := newMemStorage()
+
+	for _, p := range []string{"repo/key/mount", "repo/other/mount"} {
+		test.Ok(t, s.Put(p, strings.NewReader(p)))
+		s.modified[p] = time.Now().Add(-2 * time.Hour)
+	}
+
+	// Run
+	test.Ok(t, NewFlusher(log.NewNopLogger(), s, "repo", time.Hour, false).Flush([]string{"key"}))
+
+	// Test
+	exists, err := s.Exists("repo/key/mount")
+	test.Ok(t, err)
+	test.Assert(t, !exists, "flushed object exists")
+
+	exists, err = s.Exists("repo/other/mount")
+	test.Ok(t, err)
+	test.Assert(t, exists, "object out of the flushed path is removed")
+
+	test.NotOk(t, NewFlusher(log.NewNopLogger(), s, "", time.Hour, false).Flush(nil))
+}
+
+func TestFlushDryRun(t *testing.T) {
+	t.Parallel()
+
+	// Setup
+	s := newMemStorage()
+
+	test.Ok(t, s.Put("repo/key/mount", strings.NewReader("mount")))
+	s.modified["repo/key/mount"] = time.Now().Add(-2 * time.Hour)
+
+	// Run
+	test.Ok(t, NewFlusher(log.NewNopLogger(), s, "repo", time.Hour, true).Flush(nil))
+
+	// Test
+	exists, err := s.Exists("repo/key/mount")
+	test.Ok(t, err)
+	test.Assert(t, exists, "expired object is removed on a dry run")
+}
+
+func TestFlushIncrementalFiles(t *testing.T) {
+	t.Parallel()
+
+	// Setup
+	s := newMemStorage()
+
+	var (
+		used    = strings.Repeat("a", 64)
+		unused  = strings.Repeat("b", 64)
+		younger = strings.Repeat("c", 64)
+	)
+
+	putManifest := func(p string, digests ...string) {
+		m := fileManifest{Version: fileManifestVersion}
+		for _, d := range digests {
+			m.Files = append(m.Files, fileEntry{Path: d, Mode: 0644, Size: 1, Digest: d})
+		}
+
+		data, err := json.Marshal(m)
+		test.Ok(t, err)
+		test.Ok(t, s.Put(p, bytes.NewReader(data)))
+	}
+
+	putManifest("repo/new/mount", used)
+	putManifest("repo/old/mount", used, unused)
+
+	for _, d := range []string{used, unused, younger} {
+		test.Ok(t, s.Put(filePath("repo", d), strings.NewReader(d)))
+	}
+
+	// NOTICE: Files are uploaded once, so the file of a live cache is as old as the first cache that uploaded it.
+	for _, p := range []string{"repo/old/mount", filePath("repo", used), filePath("repo", unused)} {
+		s.modified[p] = time.Now().Add(-2 * time.Hour)
+	}
+
+	// Run
+	test.Ok(t, NewFlusher(log.NewNopLogger(), s, "repo", time.Hour, false).Flush(nil))
+
+	// Test
+	test.Equals(t, []string{filePath("repo", used), filePath("repo", younger), "repo/new/mount"}, paths(t, s, ""))
+}
+
+func TestFlushChunks(t *testing.T) {
+	t.Parallel()
+
+	// Setup
+	var (
+		s       = newMemStorage()
+		c       = chunked.New(log.NewNopLogger(), s, chunked.WithNamespace("repo/.chunks"), chunked.WithAverageChunkSize(chunked.MinAverageChunkSize))
+		shared  = bytes.Repeat([]byte("hello, drone!\n"), 1024)
+		content = map[string][]byte{
+			"repo/new/mount": append(append([]byte{}, shared...), bytes.Repeat([]byte("new\n"), 1024)...),
+			"repo/old/mount": append(append([]byte{}, shared...), bytes.Repeat([]byte("old\n"), 1024)...),
+		}
+	)
+
+	for p, b := range content {
+		test.Ok(t, c.Put(p, bytes.NewReader(b)))
+	}
+
+	before := len(paths(t, s, "repo/.chunks"))
+
+	for p := range s.objects {
+		if p != "repo/new/mount" {
+			s.modified[p] = time.Now().Add(-2 * time.Hour)
+		}
+	}
+
+	// Run
+	test.Ok(t, NewFlusher(log.NewNopLogger(), c, "repo", time.Hour, false).Flush(nil))
+
+	// Test
+	refs, err := c.References("repo/new/mount")
+	test.Ok(t, err)
+
+	chunks := paths(t, s, "repo/.chunks")
+	test.Assert(t, len(chunks) > 0, "chunks of the live cache are removed")
+	test.Assert(t, len(chunks) < before, "chunks of the expired cache are kept")
+
+	for _, p := range chunks {
+		test.Assert(t, contains(refs, p), "chunk <%s> of the expired cache is kept", p)
+	}
+
+	var buf bytes.Buffer
+	test.Ok(t, c.Get("repo/new/mount", &buf))
+	test.Equals(t, content["repo/new/mount"], buf.Bytes())
+
+	exists, err := s.Exists("repo/old/mount")
+	test.Ok(t, err)
+	test.Assert(t, !exists, "expired cache is kept")
+}
+
+// Helpers
+
+func paths(t *testing.T, s *memStorage, p string) []string {
+	t.Helper()
+
+	entries, err := s.List(p)
+	test.Ok(t, err)
+
+	var ps []string
+	for _, e := range entries {
+		ps = append(ps, e.Path)
+	}
+
+	return ps
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
 }
@@ -0,0 +1,385 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/meltwater/drone-cache/internal"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+var (
+	// ErrUnsafePath is returned when a file manifest has an entry that would be restored outside of its mount.
+	ErrUnsafePath = errors.New("unsafe path in file manifest")
+	// ErrInvalidDigest is returned when a file manifest has an entry whose digest is not a hex encoded sha256 digest.
+	ErrInvalidDigest = errors.New("invalid digest in file manifest")
+)
+
+const (
+	// filesNamespace is the path under namespace that files of incremental mounts are stored by their digests.
+	filesNamespace = ".files"
+
+	fileManifestVersion = 1
+)
+
+// fileManifest lists the files of an incrementally cached mount.
+type fileManifest struct {
+	Version int         `json:"version"`
+	Files   []fileEntry `json:"files"`
+}
+
+// fileEntry describes a single file, its path is relative to the mount.
+type fileEntry struct {
+	Path   string      `json:"path"`
+	Mode   os.FileMode `json:"mode"`
+	Size   int64       `json:"size,omitempty"`
+	Digest string      `json:"digest,omitempty"`
+	Link   string      `json:"link,omitempty"`
+}
+
+// rebuildIncremental uploads files of the source that do not exist in storage yet, and the manifest listing them.
+// Returns the hex encoded sha256 digest of the manifest.
+func (r rebuilder) rebuildIncremental(src, dst string, res *Result) (string, error) {
+	defer func(start time.Time) { res.TransferDuration = time.Since(start) }(time.Now())
+
+	var (
+		m        = fileManifest{Version: fileManifestVersion, Files: []fileEntry{}}
+		uploaded int
+		sw       = &statWriter{}
+		tr       = r.bandwidth.transfer()
+		total    int64
+	)
+
+	if r.progress > 0 {
+		total, _ = sourceSize(src)
+	}
+
+	defer sw.report(r.logger, r.progress, "uploading files", total, "local", src, "remote", dst)()
+
+	err := filepath.Walk(src, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if r.excludes.Match(archiveName(r.excludeRoot, p), fi.IsDir()) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return fmt.Errorf("relative path <%s>, %w", p, err)
+		}
+
+		e := fileEntry{Path: filepath.ToSlash(rel), Mode: fi.Mode()}
+
+		switch {
+		case fi.Mode()&os.ModeSymlink != 0:
+			if e.Link, err = os.Readlink(p); err != nil {
+				return fmt.Errorf("read link <%s>, %w", p, err)
+			}
+		case fi.Mode().IsRegular():
+			e.Size = fi.Size()
+			res.Size += e.Size
+
+			ok, err := r.putFile(p, &e, tr, sw)
+			if err != nil {
+				return err
+			}
+
+			if ok {
+				uploaded++
+				res.Transferred += e.Size
+			}
+		case !fi.IsDir():
+			return nil
+		}
+
+		m.Files = append(m.Files, e)
+
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("walk, upload all files, %w", err)
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return "", fmt.Errorf("encode file manifest, %w", err)
+	}
+
+	if err := r.s.Put(dst, bytes.NewReader(data)); err != nil {
+		return "", fmt.Errorf("put file manifest, %w", err)
+	}
+
+	res.Transferred += int64(len(data))
+
+	level.Debug(r.logger).Log("msg", "incremental cache built", "local", src, "remote", dst,
+		"files", len(m.Files), "uploaded files", uploaded)
+
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// putFile uploads the file if an object with the same digest does not exist, reports whether it is uploaded.
+func (r rebuilder) putFile(p string, e *fileEntry, tr transfer, sw *statWriter) (_ bool, err error) {
+	if e.Digest, err = fileDigest(p); err != nil {
+		return false, err
+	}
+
+	obj := filePath(r.namespace, e.Digest)
+
+	exists, err := r.s.Exists(obj)
+	if err != nil {
+		return false, fmt.Errorf("file <%s> existence check, %w", p, err)
+	}
+
+	if exists {
+		sw.add(e.Size)
+		return false, nil
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return false, fmt.Errorf("open file <%s>, %w", p, err)
+	}
+
+	defer internal.CloseWithErrLogf(r.logger, f, "put file <%s>", p)
+
+	if err := r.s.Put(obj, tr.reader(io.TeeReader(f, sw))); err != nil {
+		return false, fmt.Errorf("put file <%s>, %w", p, err)
+	}
+
+	return true, nil
+}
+
+// restoreIncremental downloads the files of the manifest that differ from the files in the destination.
+// Files that are not in the manifest are left untouched, same as extracting an archive.
+func (r restorer) restoreIncremental(src, dst string, res *Result) error {
+	defer func(start time.Time) { res.TransferDuration = time.Since(start) }(time.Now())
+
+	var buf bytes.Buffer
+	if err := r.s.Get(src, &buf); err != nil {
+		return fmt.Errorf("get file manifest, %w", err)
+	}
+
+	res.Transferred += int64(buf.Len())
+
+	sum := sha256.Sum256(buf.Bytes())
+	if err := r.verify(src, hex.EncodeToString(sum[:])); err != nil {
+		return err
+	}
+
+	var m fileManifest
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil || m.Version != fileManifestVersion {
+		return fmt.Errorf("decode file manifest <%s>, not an incremental cache", src)
+	}
+
+	// NOTICE: Digests name the objects of the files, so they are validated before any path is built from them.
+	for _, e := range m.Files {
+		if e.Mode.IsRegular() && !validDigest(e.Digest) {
+			return fmt.Errorf("file manifest <%s> entry <%s> has digest <%s>, %w", src, e.Path, e.Digest, ErrInvalidDigest)
+		}
+	}
+
+	var (
+		fetched, unchanged int
+		sw                 = &statWriter{}
+		tr                 = r.bandwidth.transfer()
+		total              int64
+	)
+
+	for _, e := range m.Files {
+		total += e.Size
+	}
+
+	res.Size = total
+
+	defer sw.report(r.logger, r.progress, "downloading files", total, "remote", src, "local", dst)()
+
+	for _, e := range m.Files {
+		target, err := entryTarget(dst, e.Path)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case e.Mode.IsDir():
+			if err := os.MkdirAll(target, e.Mode.Perm()); err != nil {
+				return fmt.Errorf("create directory <%s>, %w", target, err)
+			}
+		case e.Mode&os.ModeSymlink != 0:
+			if lnk, err := os.Readlink(target); err == nil && lnk == e.Link {
+				continue
+			}
+
+			if err := unlink(target); err != nil {
+				return fmt.Errorf("unlink <%s>, %w", target, err)
+			}
+
+			if err := os.Symlink(e.Link, target); err != nil {
+				return fmt.Errorf("create symbolic link <%s>, %w", target, err)
+			}
+		default:
+			if sameFile(target, e) {
+				sw.add(e.Size)
+				unchanged++
+
+				continue
+			}
+
+			if err := r.getFile(e, target, tr, sw); err != nil {
+				return err
+			}
+
+			fetched++
+			res.Transferred += e.Size
+		}
+	}
+
+	level.Debug(r.logger).Log("msg", "incremental cache restored", "local", dst, "remote", src,
+		"fetched files", fetched, "unchanged files", unchanged)
+
+	return nil
+}
+
+// getFile downloads the file next to the target and replaces the target with it, if its digest matches the entry.
+func (r restorer) getFile(e fileEntry, target string, tr transfer, sw *statWriter) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil { //nolint:gomnd
+		return fmt.Errorf("create directory <%s>, %w", filepath.Dir(target), err)
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(target), ".drone-cache-")
+	if err != nil {
+		return fmt.Errorf("create temporary file for <%s>, %w", target, err)
+	}
+
+	h := sha256.New()
+
+	err = r.s.Get(filePath(r.namespace, e.Digest), tr.writer(io.MultiWriter(f, h, sw)))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if d := hex.EncodeToString(h.Sum(nil)); err == nil && d != e.Digest {
+		err = fmt.Errorf("file is corrupted, digest <%s> want <%s>", d, e.Digest)
+	}
+
+	if err == nil {
+		err = os.Chmod(f.Name(), e.Mode.Perm())
+	}
+
+	if err == nil {
+		err = unlink(target)
+	}
+
+	if err == nil {
+		err = os.Rename(f.Name(), target)
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("get file <%s>, %w", target, err)
+	}
+
+	return nil
+}
+
+// Helpers
+
+// entryTarget resolves the path of a manifest entry under the destination.
+// Manifests are read from shared storage, so entries that escape the destination are rejected,
+// and so are entries below a symbolic link, which could have been created by an earlier entry.
+func entryTarget(dst, name string) (string, error) {
+	if name == "" || path.IsAbs(name) || filepath.IsAbs(filepath.FromSlash(name)) || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("file manifest entry <%s> is not a relative path, %w", name, ErrUnsafePath)
+	}
+
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if part == ".." {
+			return "", fmt.Errorf("file manifest entry <%s> escapes the destination, %w", name, ErrUnsafePath)
+		}
+	}
+
+	dst = filepath.Clean(dst)
+	target := filepath.Join(dst, filepath.FromSlash(name))
+
+	if rel, err := filepath.Rel(dst, target); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("file manifest entry <%s> escapes the destination, %w", name, ErrUnsafePath)
+	}
+
+	// NOTICE: Rebuild never walks into symbolic links, so a valid manifest has no entries below them.
+	for dir := filepath.Dir(target); len(dir) > len(dst); dir = filepath.Dir(dir) {
+		fi, err := os.Lstat(dir)
+		if err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("file manifest entry <%s> is below symbolic link <%s>, %w", name, dir, ErrUnsafePath)
+		}
+	}
+
+	return target, nil
+}
+
+// filePath returns the remote path of the file with given digest, digests are fanned out by their prefix.
+func filePath(namespace, digest string) string {
+	return path.Join(namespace, filesNamespace, digest[:2], digest)
+}
+
+// validDigest checks if the digest is a lowercase hex encoded sha256 digest.
+func validDigest(d string) bool {
+	if len(d) != hex.EncodedLen(sha256.Size) {
+		return false
+	}
+
+	for _, c := range d {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sameFile checks if the local file has the same size and content as the entry.
+func sameFile(p string, e fileEntry) bool {
+	fi, err := os.Lstat(p)
+	if err != nil || !fi.Mode().IsRegular() || fi.Size() != e.Size {
+		return false
+	}
+
+	d, err := fileDigest(p)
+
+	return err == nil && d == e.Digest
+}
+
+func fileDigest(p string) (string, error) {
+	h := sha256.New()
+	if err := hashFile(h, p); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func unlink(p string) error {
+	if _, err := os.Lstat(p); err != nil {
+		return nil
+	}
+
+	return os.RemoveAll(p)
+}
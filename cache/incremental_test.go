@@ -0,0 +1,250 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meltwater/drone-cache/archive/ignore"
+	"github.com/meltwater/drone-cache/archive/tar"
+	"github.com/meltwater/drone-cache/test"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestIncremental(t *testing.T) {
+	// Setup
+	dir, dirClean := test.CreateTempDir(t, "incremental")
+	t.Cleanup(dirClean)
+
+	var (
+		unchanged = filepath.Join(dir, "unchanged.txt")
+		modified  = filepath.Join(dir, "nested", "modified.txt")
+		removed   = filepath.Join(dir, "nested", "removed.txt")
+		link      = filepath.Join(dir, "link")
+	)
+
+	test.Ok(t, os.MkdirAll(filepath.Dir(modified), 0755))
+	test.Ok(t, ioutil.WriteFile(unchanged, []byte("hello\n"), 0644))
+	test.Ok(t, ioutil.WriteFile(modified, []byte("hello, drone!\n"), 0644))
+	test.Ok(t, ioutil.WriteFile(removed, []byte("hello, go!\n"), 0600))
+	test.Ok(t, os.Symlink("unchanged.txt", link))
+
+	var (
+		s  = newMemStorage()
+		a  = tar.New(log.NewNopLogger(), filepath.Dir(dir), false)
+		g  = staticGenerator("key")
+		rb = NewRebuilder(log.NewNopLogger(), s, a, g, WithNamespace("namespace"), WithOverride(true), WithIncremental(dir))
+		rs = NewRestorer(log.NewNopLogger(), s, a, g, WithNamespace("namespace"), WithIncremental(dir))
+	)
+
+	test.Ok(t, rb.Rebuild([]string{dir}))
+
+	// NOTICE: Change the workspace, restore should only download the files that differ.
+	test.Ok(t, ioutil.WriteFile(modified, []byte("hello, world!\n"), 0644))
+	test.Ok(t, os.Remove(removed))
+	test.Ok(t, os.Remove(link))
+
+	// Run
+	test.Ok(t, rs.Restore([]string{dir}))
+
+	// Test
+	for p, content := range map[string]string{
+		unchanged: "hello\n",
+		modified:  "hello, drone!\n",
+		removed:   "hello, go!\n",
+	} {
+		b, err := ioutil.ReadFile(p)
+		test.Ok(t, err)
+		test.Equals(t, content, string(b))
+	}
+
+	fi, err := os.Stat(removed)
+	test.Ok(t, err)
+	test.Equals(t, os.FileMode(0600), fi.Mode().Perm())
+
+	lnk, err := os.Readlink(link)
+	test.Ok(t, err)
+	test.Equals(t, "unchanged.txt", lnk)
+
+	d, err := fileDigest(unchanged)
+	test.Ok(t, err)
+	test.Equals(t, 0, s.gets[d], "unchanged file downloaded")
+
+	var fetched int
+	for p, n := range s.gets {
+		if p != filepath.Base(dir) {
+			fetched += n
+		}
+	}
+
+	test.Equals(t, 2, fetched)
+}
+
+func TestIncrementalExcludes(t *testing.T) {
+	// Setup
+	dir, dirClean := test.CreateTempDir(t, "incremental_excludes")
+	t.Cleanup(dirClean)
+
+	test.Ok(t, os.MkdirAll(filepath.Join(dir, "tmp"), 0755))
+	test.Ok(t, ioutil.WriteFile(filepath.Join(dir, "kept.txt"), []byte("hello\n"), 0644))
+	test.Ok(t, ioutil.WriteFile(filepath.Join(dir, "debug.log"), []byte("excluded\n"), 0644))
+	test.Ok(t, ioutil.WriteFile(filepath.Join(dir, "tmp", "file.txt"), []byte("excluded\n"), 0644))
+
+	m, err := ignore.New("*.log", "tmp/")
+	test.Ok(t, err)
+
+	var (
+		s  = newMemStorage()
+		a  = tar.New(log.NewNopLogger(), filepath.Dir(dir), false)
+		rb = NewRebuilder(log.NewNopLogger(), s, a, staticGenerator("key"),
+			WithNamespace("namespace"), WithIncremental(dir), WithExcludes(filepath.Dir(dir), m))
+	)
+
+	// Run
+	test.Ok(t, rb.Rebuild([]string{dir}))
+
+	// Test
+	var manifest fileManifest
+
+	for p, data := range s.objects {
+		if filepath.Base(p) == filepath.Base(dir) {
+			test.Ok(t, json.Unmarshal(data, &manifest))
+		}
+	}
+
+	var paths []string
+	for _, e := range manifest.Files {
+		paths = append(paths, e.Path)
+	}
+
+	test.Equals(t, []string{".", "kept.txt"}, paths)
+}
+
+func TestIncrementalRateLimit(t *testing.T) {
+	// Setup
+	dir, dirClean := test.CreateTempDir(t, "incremental_rate_limit")
+	t.Cleanup(dirClean)
+
+	const (
+		files = 10
+		rate  = 2000
+	)
+
+	for i := 0; i < files; i++ {
+		content := bytes.Repeat([]byte{byte('a' + i)}, 300)
+		test.Ok(t, ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("file%d.txt", i)), content, 0644))
+	}
+
+	var (
+		s      = newMemStorage()
+		a      = tar.New(log.NewNopLogger(), filepath.Dir(dir), false)
+		g      = staticGenerator("key")
+		limits = WithRateLimits(RateLimits{Upload: rate, Download: rate})
+		rb     = NewRebuilder(log.NewNopLogger(), s, a, g, WithNamespace("namespace"), WithIncremental(dir), limits)
+		rs     = NewRestorer(log.NewNopLogger(), s, a, g, WithNamespace("namespace"), WithIncremental(dir), limits)
+	)
+
+	// NOTICE: Each file fits in the burst of a limiter, so only a limiter shared by the files of the mount paces them.
+	// 3000 bytes at 2000 bytes per second, with a burst of one second worth of bytes, take at least half a second.
+	minimum := 400 * time.Millisecond
+
+	// Run & Test
+	start := time.Now()
+	test.Ok(t, rb.Rebuild([]string{dir}))
+
+	elapsed := time.Since(start)
+	test.Assert(t, elapsed >= minimum, "files are uploaded faster than the rate limit, in %s", elapsed)
+
+	for i := 0; i < files; i++ {
+		test.Ok(t, os.Remove(filepath.Join(dir, fmt.Sprintf("file%d.txt", i))))
+	}
+
+	start = time.Now()
+	test.Ok(t, rs.Restore([]string{dir}))
+
+	elapsed = time.Since(start)
+	test.Assert(t, elapsed >= minimum, "files are downloaded faster than the rate limit, in %s", elapsed)
+}
+
+func TestIncrementalInvalidDigest(t *testing.T) {
+	for name, digest := range map[string]string{
+		"empty":     "",
+		"short":     "a",
+		"uppercase": strings.Repeat("A", 64),
+		"not hex":   strings.Repeat("g", 64),
+		"path":      "../" + strings.Repeat("a", 61),
+	} {
+		// Setup
+		dir, dirClean := test.CreateTempDir(t, "incremental_invalid_digest")
+		t.Cleanup(dirClean)
+
+		data, err := json.Marshal(fileManifest{Version: fileManifestVersion, Files: []fileEntry{
+			{Path: "file.txt", Mode: 0644, Size: 1, Digest: digest},
+		}})
+		test.Ok(t, err)
+
+		s := newMemStorage()
+		test.Ok(t, s.Put("manifest", bytes.NewReader(data)))
+
+		rs := NewRestorer(log.NewNopLogger(), s, nil, nil, WithNamespace("namespace"))
+
+		// Run
+		err = rs.(restorer).restoreIncremental("manifest", dir, &Result{})
+
+		// Test
+		test.Assert(t, errors.Is(err, ErrInvalidDigest), "%s: expected invalid digest error, got %v", name, err)
+	}
+}
+
+func TestIncrementalUnsafeManifest(t *testing.T) {
+	var (
+		content = []byte("hello, drone!\n")
+		sum     = sha256.Sum256(content)
+		digest  = hex.EncodeToString(sum[:])
+	)
+
+	for name, entries := range map[string][]fileEntry{
+		"parent":        {{Path: "../escaped.txt", Mode: 0644, Size: int64(len(content)), Digest: digest}},
+		"nested parent": {{Path: "nested/../../escaped.txt", Mode: 0644, Size: int64(len(content)), Digest: digest}},
+		"absolute":      {{Path: "/escaped.txt", Mode: 0644, Size: int64(len(content)), Digest: digest}},
+		"symbolic link": {
+			{Path: "link", Mode: os.ModeSymlink | 0777, Link: ".."},
+			{Path: "link/escaped.txt", Mode: 0644, Size: int64(len(content)), Digest: digest},
+		},
+	} {
+		// Setup
+		dir, dirClean := test.CreateTempDir(t, "incremental_unsafe")
+		t.Cleanup(dirClean)
+
+		dst := filepath.Join(dir, "mount")
+		test.Ok(t, os.MkdirAll(dst, 0755))
+
+		data, err := json.Marshal(fileManifest{Version: fileManifestVersion, Files: entries})
+		test.Ok(t, err)
+
+		s := newMemStorage()
+		test.Ok(t, s.Put("manifest", bytes.NewReader(data)))
+		test.Ok(t, s.Put(filePath("namespace", digest), bytes.NewReader(content)))
+
+		rs := NewRestorer(log.NewNopLogger(), s, nil, nil, WithNamespace("namespace"))
+
+		// Run
+		err = rs.(restorer).restoreIncremental("manifest", dst, &Result{})
+
+		// Test
+		test.Assert(t, errors.Is(err, ErrUnsafePath), "%s: expected unsafe path error, got %v", name, err)
+
+		_, err = os.Lstat(filepath.Join(dir, "escaped.txt"))
+		test.Assert(t, os.IsNotExist(err), "%s: file is written outside of the destination", name)
+	}
+}
@@ -0,0 +1,180 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/meltwater/drone-cache/internal"
+	"github.com/meltwater/drone-cache/key"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// keyChain generates the keys of a cache.
+// Rebuild uses the key of the primary generator, or of the fallback generator when the primary fails.
+// Restore tries the same key first and then the keys of the restore generators in order until one exists.
+type keyChain struct {
+	logger log.Logger
+
+	primary  key.Generator
+	fallback key.Generator
+	restore  []key.Generator
+}
+
+func newKeyChain(logger log.Logger, primary, fallback key.Generator, restore []key.Generator) keyChain {
+	return keyChain{logger, primary, fallback, restore}
+}
+
+// first returns the key that caches are rebuilt with.
+func (c keyChain) first(parts ...string) (string, error) {
+	errs := &internal.MultiError{}
+
+	if c.primary != nil {
+		k, err := generateKey(c.primary, parts...)
+		if err == nil {
+			return k, nil
+		}
+
+		errs.Add(err)
+	}
+
+	if c.fallback != nil {
+		level.Error(c.logger).Log("msg", "falling back to fallback key generator", "err", errs)
+
+		k, err := generateKey(c.fallback, parts...)
+		if err == nil {
+			return k, nil
+		}
+
+		errs.Add(fmt.Errorf("fallback, %w", err))
+	}
+
+	if errs.Err() == nil {
+		return "", errors.New("no key generator given")
+	}
+
+	return "", errs
+}
+
+// keys returns all distinct keys that could be generated, in the order restore tries them.
+func (c keyChain) keys(parts ...string) ([]string, error) {
+	var (
+		keys []string
+		seen = map[string]bool{}
+		errs = &internal.MultiError{}
+	)
+
+	add := func(k string) {
+		if !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+
+	k, err := c.first(parts...)
+	if err != nil {
+		errs.Add(err)
+	} else {
+		add(k)
+	}
+
+	for _, g := range c.restore {
+		k, err := generateKey(g, parts...)
+		if err != nil {
+			level.Error(c.logger).Log("msg", "skipping restore key, could not generate", "err", err)
+			errs.Add(err)
+
+			continue
+		}
+
+		add(k)
+	}
+
+	if len(keys) > 0 {
+		return keys, nil
+	}
+
+	return nil, errs
+}
+
+// generateKey generates a key using given generator and makes sure it is safe to use as a storage path.
+func generateKey(g key.Generator, parts ...string) (string, error) {
+	k, err := g.Generate(parts...)
+	if err != nil {
+		return "", err
+	}
+
+	return key.Sanitize(k)
+}
+
+// remotePath joins namespace, key and local path of a mount into a storage path.
+// It makes sure that the resulting path stays under the namespace and within the limits of the backend.
+// If hashLong is set, a key that makes the path exceed the limits is replaced by its hash.
+func remotePath(limits key.Limits, hashLong bool, namespace, k, local string) (string, error) {
+	var err error
+
+	if namespace != "" {
+		if namespace, err = key.Sanitize(namespace); err != nil {
+			return "", fmt.Errorf("namespace, %w", err)
+		}
+	}
+
+	if k, err = key.Sanitize(k); err != nil {
+		return "", fmt.Errorf("key, %w", err)
+	}
+
+	if local, err = key.Sanitize(local); err != nil {
+		return "", fmt.Errorf("mount <%s>, %w", local, err)
+	}
+
+	p := path.Join(namespace, k, local)
+
+	err = limits.Check(p)
+	if err == nil || !hashLong || !errors.Is(err, key.ErrKeyTooLong) {
+		return p, err
+	}
+
+	p = path.Join(namespace, fmt.Sprintf("%x", sha256.Sum256([]byte(k))), local)
+	if err := limits.Check(p); err != nil {
+		return "", fmt.Errorf("hashed key, %w", err)
+	}
+
+	return p, nil
+}
+
+// KeyOf returns the key that the object at the given storage path is stored under, relative to the namespace.
+// Keys of branch and pull request scoped caches include the scope. Objects that are not stored under a key,
+// such as files of incremental mounts or chunks, are reported as not found.
+func KeyOf(namespace, p string) (string, bool) {
+	rel := p
+	if namespace != "" {
+		if !strings.HasPrefix(p, namespace+"/") {
+			return "", false
+		}
+
+		rel = strings.TrimPrefix(p, namespace+"/")
+	}
+
+	segments := strings.Split(rel, "/")
+
+	// NOTICE: Key is followed by at least one segment of the mount.
+	switch {
+	case (segments[0] == scopesNamespace || segments[0] == pullsNamespace) && len(segments) > 3: //nolint:gomnd
+		return path.Join(segments[:3]...), true
+	case strings.HasPrefix(segments[0], "."):
+		return "", false
+	case len(segments) > 1:
+		return segments[0], true
+	default:
+		return "", false
+	}
+}
+
+// IsSidecar reports whether the object at the given path is stored next to a cache, such as its signature.
+func IsSidecar(p string) bool {
+	return strings.HasSuffix(p, signatureSuffix) || strings.HasSuffix(p, fingerprintSuffix)
+}
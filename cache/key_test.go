@@ -0,0 +1,179 @@
+package cache
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/meltwater/drone-cache/key"
+	"github.com/meltwater/drone-cache/test"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestKeyChain(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ok      = staticGenerator("ok")
+		other   = staticGenerator("other")
+		invalid = staticGenerator("../escape")
+		failing = failingGenerator{}
+	)
+
+	for _, tt := range []struct {
+		name     string
+		primary  key.Generator
+		fallback key.Generator
+		restore  []key.Generator
+		first    string
+		expected []string
+		err      bool
+	}{
+		{name: "single", primary: ok, first: "ok", expected: []string{"ok"}},
+		{name: "ordered", primary: other, restore: []key.Generator{ok}, first: "other", expected: []string{"other", "ok"}},
+		{
+			name: "deduplicated", primary: ok, restore: []key.Generator{other, ok},
+			first: "ok", expected: []string{"ok", "other"},
+		},
+		{
+			name: "skips failing", primary: ok, restore: []key.Generator{failing, invalid, other},
+			first: "ok", expected: []string{"ok", "other"},
+		},
+		{
+			name: "fallback", primary: invalid, fallback: other, restore: []key.Generator{ok},
+			first: "other", expected: []string{"other", "ok"},
+		},
+		{name: "fallback not used", primary: ok, fallback: other, first: "ok", expected: []string{"ok"}},
+		{name: "restore only", primary: failing, restore: []key.Generator{ok}, expected: []string{"ok"}},
+		{name: "all failing", primary: failing, fallback: failing, restore: []key.Generator{failing}, err: true},
+		{name: "empty", err: true},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			kc := newKeyChain(log.NewNopLogger(), tt.primary, tt.fallback, tt.restore)
+
+			keys, err := kc.keys()
+			if tt.err {
+				test.NotOk(t, err)
+				return
+			}
+
+			test.Ok(t, err)
+			test.Equals(t, tt.expected, keys)
+
+			first, err := kc.first()
+			if tt.first == "" {
+				test.NotOk(t, err)
+				return
+			}
+
+			test.Ok(t, err)
+			test.Equals(t, tt.first, first)
+		})
+	}
+}
+
+func TestRemotePath(t *testing.T) {
+	t.Parallel()
+
+	long := strings.Repeat("k", 100)
+
+	for _, tt := range []struct {
+		name      string
+		limits    key.Limits
+		hashLong  bool
+		namespace string
+		key       string
+		local     string
+		expected  string
+		err       error
+	}{
+		{name: "simple", namespace: "repo", key: "master", local: "vendor", expected: "repo/master/vendor"},
+		{name: "empty namespace", key: "master", local: "vendor", expected: "master/vendor"},
+		{name: "absolute mount", namespace: "repo", key: "master", local: "/root/.m2", expected: "repo/master/root/.m2"},
+		{name: "leading slash key", namespace: "repo", key: "/master", local: "vendor", expected: "repo/master/vendor"},
+		{name: "traversal in key", namespace: "repo", key: "feature/../../other-repo", local: "vendor", err: key.ErrInvalidKey},
+		{name: "traversal in mount", namespace: "repo", key: "master", local: "../other-repo", err: key.ErrInvalidKey},
+		{name: "traversal in namespace", namespace: "..", key: "master", local: "vendor", err: key.ErrInvalidKey},
+		{name: "too long", limits: key.Limits{MaxLength: 80}, namespace: "repo", key: long, local: "vendor", err: key.ErrKeyTooLong},
+		{
+			name:      "too long hashed",
+			limits:    key.Limits{MaxLength: 80},
+			hashLong:  true,
+			namespace: "repo",
+			key:       long,
+			local:     "vendor",
+			expected:  "repo/e37c7cb78ccb30f0e2036576d681d619949c8a9fb885c91a07da6b845788a9ce/vendor",
+		},
+		{
+			name:      "too long segment hashed",
+			limits:    key.Limits{MaxSegmentLength: 100},
+			hashLong:  true,
+			namespace: "repo",
+			key:       long + "k",
+			local:     "vendor",
+			expected:  "repo/dec651a2cfdb388ffb5e01b69d4d79971b0a7af493a0865bb40784c545621354/vendor",
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			actual, err := remotePath(tt.limits, tt.hashLong, tt.namespace, tt.key, tt.local)
+			if tt.err != nil {
+				test.Expected(t, err, tt.err)
+				return
+			}
+
+			test.Ok(t, err)
+			test.Equals(t, tt.expected, actual)
+		})
+	}
+}
+
+// Helpers
+
+type staticGenerator string
+
+func (g staticGenerator) Generate(_ ...string) (string, error) { return string(g), nil }
+
+func (g staticGenerator) Check() error { return nil }
+
+type failingGenerator struct{}
+
+func (failingGenerator) Generate(_ ...string) (string, error) {
+	return "", errors.New("failing generator")
+}
+
+func (failingGenerator) Check() error { return nil }
+
+func TestKeyOf(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		path string
+		key  string
+		ok   bool
+	}{
+		{"repo/key/mount", "key", true},
+		{"repo/key/nested/mount.sig", "key", true},
+		{"repo/.branches/feature%2Fx/key/mount", ".branches/feature%2Fx/key", true},
+		{"repo/.branches/feature%2Fx/key", "", false},
+		{"repo/.pulls/42/key/mount", ".pulls/42/key", true},
+		{"repo/.files/ab/abcdef", "", false},
+		{"repo/.chunks/ab/abcdef", "", false},
+		{"repo/key", "", false},
+		{"other/key/mount", "", false},
+	} {
+		key, ok := KeyOf("repo", tc.path)
+		test.Equals(t, tc.ok, ok, tc.path)
+		test.Equals(t, tc.key, key, tc.path)
+	}
+
+	key, ok := KeyOf("", "key/mount")
+	test.Assert(t, ok, "key without namespace is not found")
+	test.Equals(t, "key", key)
+}
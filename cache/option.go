@@ -1,11 +1,63 @@
 package cache
 
-import "github.com/meltwater/drone-cache/key"
+import (
+	"time"
+
+	"github.com/meltwater/drone-cache/archive/ignore"
+	"github.com/meltwater/drone-cache/key"
+)
 
 type options struct {
 	namespace         string
+	generators        []key.Generator
 	fallbackGenerator key.Generator
 	override          bool
+	keyLimits         key.Limits
+	hashLongKeys      bool
+	fingerprint       Fingerprint
+	incremental       []string
+	excludeRoot       string
+	excludes          *ignore.Matcher
+	signer            *Signer
+	verifier          *Verifier
+	scope             string
+	fallbackScopes    []string
+	rateLimits        RateLimits
+	concurrency       int
+	progressInterval  time.Duration
+	mountTracer       Tracer
+	recorders         []Recorder
+	flushTTL          time.Duration
+	dryRun            bool
+}
+
+// newOptions applies the given options to the defaults.
+func newOptions(opts ...Option) options {
+	o := options{flushTTL: DefaultFlushTTL}
+
+	for _, opt := range opts {
+		opt.apply(&o)
+	}
+
+	return o
+}
+
+// tracer returns the tracer of the mounts, one that does not trace if none is set.
+func (o options) tracer() Tracer {
+	if o.mountTracer == nil {
+		return nopTracer{}
+	}
+
+	return o.mountTracer
+}
+
+// recorder returns a recorder that records to each of the recorders.
+func (o options) recorder() Recorder {
+	if len(o.recorders) == 0 {
+		return nopRecorder{}
+	}
+
+	return recorders(o.recorders)
 }
 
 // Option overrides behavior of Archive.
@@ -26,7 +78,15 @@ func WithNamespace(s string) Option {
 	})
 }
 
-// WithFallbackGenerator sets fallback key generator option.
+// WithGenerators sets key generators of restore keys, tried in order when no cache exists for the primary key.
+// They are only used to restore, rebuild always uses the primary key generator or the fallback key generator.
+func WithGenerators(gs ...key.Generator) Option {
+	return optionFunc(func(o *options) {
+		o.generators = append(o.generators, gs...)
+	})
+}
+
+// WithFallbackGenerator sets fallback key generator option, used when the primary key generator fails.
 func WithFallbackGenerator(g key.Generator) Option {
 	return optionFunc(func(o *options) {
 		o.fallbackGenerator = g
@@ -39,3 +99,118 @@ func WithOverride(override bool) Option {
 		o.override = override
 	})
 }
+
+// WithKeyLimits sets restrictions of the storage backend on object keys.
+func WithKeyLimits(l key.Limits) Option {
+	return optionFunc(func(o *options) {
+		o.keyLimits = l
+	})
+}
+
+// WithHashLongKeys sets keys exceeding the key limits should be replaced by their hash instead of failing.
+func WithHashLongKeys(b bool) Option {
+	return optionFunc(func(o *options) {
+		o.hashLongKeys = b
+	})
+}
+
+// WithFingerprint sets fingerprint to compare with the stored one before uploading, unchanged sources are not uploaded.
+// When set, existing objects are refreshed if their sources changed, regardless of override option.
+func WithFingerprint(fp Fingerprint) Option {
+	return optionFunc(func(o *options) {
+		o.fingerprint = fp
+	})
+}
+
+// WithIncremental sets mounts to cache file by file instead of as an archive,
+// restore only downloads the files that differ from the local ones.
+func WithIncremental(mounts ...string) Option {
+	return optionFunc(func(o *options) {
+		o.incremental = append(o.incremental, mounts...)
+	})
+}
+
+// WithExcludes sets paths that incremental mounts skip, matched relative to the root the same way archives skip them.
+func WithExcludes(root string, m *ignore.Matcher) Option {
+	return optionFunc(func(o *options) {
+		o.excludeRoot = root
+		o.excludes = m
+	})
+}
+
+// WithSigner sets signer to sign rebuilt caches with.
+func WithSigner(s *Signer) Option {
+	return optionFunc(func(o *options) {
+		o.signer = s
+	})
+}
+
+// WithVerifier sets verifier that restored caches must be trusted by, unsigned or invalid caches are treated as a miss.
+func WithVerifier(v *Verifier) Option {
+	return optionFunc(func(o *options) {
+		o.verifier = v
+	})
+}
+
+// WithBranchScope sets rebuild to write only to the scope of the given branch,
+// and restore to read from it first, then from the fallback branches in order.
+func WithBranchScope(branch string, fallbacks ...string) Option {
+	return optionFunc(func(o *options) {
+		o.scope = branch
+		o.fallbackScopes = fallbacks
+	})
+}
+
+// WithRateLimits sets bandwidth limits of uploads and downloads.
+func WithRateLimits(rl RateLimits) Option {
+	return optionFunc(func(o *options) {
+		o.rateLimits = rl
+	})
+}
+
+// WithConcurrency sets the maximum number of mounts rebuilt or restored concurrently, zero means unlimited.
+func WithConcurrency(n int) Option {
+	return optionFunc(func(o *options) {
+		o.concurrency = n
+	})
+}
+
+// WithProgressInterval sets the interval between progress logs of transfers, zero disables progress logs.
+func WithProgressInterval(d time.Duration) Option {
+	return optionFunc(func(o *options) {
+		o.progressInterval = d
+	})
+}
+
+// WithTracer sets the tracer that the rebuild or restore of each mount is traced with.
+func WithTracer(t Tracer) Option {
+	return optionFunc(func(o *options) {
+		if t != nil {
+			o.mountTracer = t
+		}
+	})
+}
+
+// WithRecorder adds a recorder that the result of each rebuilt or restored mount is recorded to.
+func WithRecorder(r Recorder) Option {
+	return optionFunc(func(o *options) {
+		if r != nil {
+			o.recorders = append(o.recorders, r)
+		}
+	})
+}
+
+// WithFlushTTL sets the age after which flush removes caches.
+func WithFlushTTL(ttl time.Duration) Option {
+	return optionFunc(func(o *options) {
+		o.flushTTL = ttl
+	})
+}
+
+// WithDryRun sets whether keys are generated and caches are looked up,
+// without uploading, downloading or deleting anything.
+func WithDryRun(dryRun bool) Option {
+	return optionFunc(func(o *options) {
+		o.dryRun = dryRun
+	})
+}
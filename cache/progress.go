@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// DefaultProgressInterval is the default interval between progress logs of transfers.
+const DefaultProgressInterval = 10 * time.Second
+
+// report logs the progress of the written bytes every interval, until the returned function is called.
+// Total is the expected number of bytes, zero if it is not known; ETA is only logged when it is known.
+func (s *statWriter) report(logger log.Logger, interval time.Duration, msg string, total int64, keyvals ...interface{}) func() {
+	if interval <= 0 {
+		return func() {}
+	}
+
+	var (
+		start = time.Now()
+		done  = make(chan struct{})
+	)
+
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				s.log(logger, time.Since(start), msg, total, keyvals...)
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// log logs the progress of the written bytes after given duration.
+func (s *statWriter) log(logger log.Logger, elapsed time.Duration, msg string, total int64, keyvals ...interface{}) {
+	n := s.bytes()
+
+	var rate float64
+	if elapsed > 0 {
+		rate = float64(n) / elapsed.Seconds()
+	}
+
+	keyvals = append([]interface{}{"msg", msg, "bytes", humanize.Bytes(uint64(n)),
+		"throughput", humanize.Bytes(uint64(rate)) + "/s", "elapsed", elapsed.Round(time.Second)}, keyvals...)
+
+	if total > 0 {
+		keyvals = append(keyvals, "total", humanize.Bytes(uint64(total)),
+			"progress", fmt.Sprintf("%%%0.2f", float64(n)/float64(total)*100.0)) //nolint:gomnd
+
+		if rate > 0 && n < total {
+			eta := time.Duration(float64(total-n) / rate * float64(time.Second))
+			keyvals = append(keyvals, "eta", eta.Round(time.Second))
+		}
+	}
+
+	level.Info(logger).Log(keyvals...)
+}
+
+// sourceSize returns the total size of the regular files under the source.
+func sourceSize(src string) (int64, error) {
+	var size int64
+
+	err := filepath.Walk(src, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if fi.Mode().IsRegular() {
+			size += fi.Size()
+		}
+
+		return nil
+	})
+
+	return size, err
+}
+
+// size returns the size of the object in storage, zero if the storage can not tell it or progress is not reported.
+func (r restorer) size(p string) int64 {
+	if r.progress <= 0 {
+		return 0
+	}
+
+	entries, err := r.s.List(p)
+	if err != nil {
+		level.Debug(r.logger).Log("msg", "size of the object is unknown", "remote", p, "err", err)
+		return 0
+	}
+
+	for _, e := range entries {
+		if e.Path == p {
+			return e.Size
+		}
+	}
+
+	return 0
+}
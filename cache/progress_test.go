@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meltwater/drone-cache/test"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestProgressLog(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name     string
+		total    int64
+		expected []string
+		missing  []string
+	}{
+		{
+			name:     "known total",
+			total:    2000,
+			expected: []string{"bytes=\"1.0 kB\"", "throughput=\"100 B/s\"", "elapsed=10s", "progress=%50.00", "eta=10s"},
+		},
+		{
+			name:     "unknown total",
+			expected: []string{"bytes=\"1.0 kB\"", "throughput=\"100 B/s\"", "elapsed=10s"},
+			missing:  []string{"progress=", "eta="},
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				buf bytes.Buffer
+				sw  = &statWriter{}
+			)
+
+			_, err := sw.Write(make([]byte, 1000))
+			test.Ok(t, err)
+
+			sw.log(log.NewLogfmtLogger(&buf), 10*time.Second, "uploading", tc.total, "remote", "key")
+
+			out := buf.String()
+			for _, s := range append(tc.expected, "msg=uploading", "remote=key") {
+				test.Assert(t, strings.Contains(out, s), "log <%s> does not contain <%s>", out, s)
+			}
+
+			for _, s := range tc.missing {
+				test.Assert(t, !strings.Contains(out, s), "log <%s> contains <%s>", out, s)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"io"
+
+	"github.com/meltwater/drone-cache/internal/ratelimit"
+)
+
+// RateLimits limits the bandwidth of the transfers between archives and storage, in bytes per second.
+// Zero means unlimited.
+type RateLimits struct {
+	// Upload limits each uploaded mount.
+	Upload int64
+	// Download limits each downloaded mount.
+	Download int64
+	// Global limits all mounts transferred concurrently, in total.
+	Global int64
+}
+
+// bandwidth paces the transfers of each mount with its own limiter, and all mounts with the shared one.
+type bandwidth struct {
+	rate   int64
+	global *ratelimit.Limiter
+}
+
+func newBandwidth(rate, global int64) bandwidth {
+	b := bandwidth{rate: rate}
+	if global > 0 {
+		b.global = ratelimit.New(global)
+	}
+
+	return b
+}
+
+// transfer returns the limits of a single mount, all transfers of the mount share its limiter.
+func (b bandwidth) transfer() transfer {
+	t := transfer{global: b.global}
+	if b.rate > 0 {
+		t.mount = ratelimit.New(b.rate)
+	}
+
+	return t
+}
+
+// transfer paces the transfers of a single mount, such as its archive or each of its files.
+type transfer struct {
+	mount  *ratelimit.Limiter
+	global *ratelimit.Limiter
+}
+
+// reader limits the given reader.
+func (t transfer) reader(r io.Reader) io.Reader {
+	return ratelimit.NewReader(r, t.mount, t.global)
+}
+
+// writer limits the given writer.
+func (t transfer) writer(w io.Writer) io.Writer {
+	return ratelimit.NewWriter(w, t.mount, t.global)
+}
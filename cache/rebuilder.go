@@ -1,14 +1,19 @@
 package cache
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/meltwater/drone-cache/archive"
+	"github.com/meltwater/drone-cache/archive/ignore"
 	"github.com/meltwater/drone-cache/internal"
 	"github.com/meltwater/drone-cache/key"
 	"github.com/meltwater/drone-cache/storage"
@@ -23,16 +28,34 @@ type rebuilder struct {
 
 	a  archive.Archive
 	s  storage.Storage
-	g  key.Generator
-	fg key.Generator
-
-	namespace string
-	override  bool
+	kc keyChain
+
+	namespace    string
+	override     bool
+	limits       key.Limits
+	hashLongKeys bool
+	fingerprint  Fingerprint
+	incremental  map[string]bool
+	excludeRoot  string
+	excludes     *ignore.Matcher
+	signer       *Signer
+	scope        string
+	bandwidth    bandwidth
+	concurrency  int
+	progress     time.Duration
+	tracer       Tracer
+	recorder     Recorder
+	dryRun       bool
 }
 
-// NewRebuilder TODO
-func NewRebuilder(logger log.Logger, s storage.Storage, a archive.Archive, g key.Generator, fg key.Generator, namespace string, override bool) Rebuilder { //nolint:lll
-	return rebuilder{logger, a, s, g, fg, namespace, override}
+// NewRebuilder creates a rebuilder that uploads caches with keys of the given generator, configured by the options.
+func NewRebuilder(logger log.Logger, s storage.Storage, a archive.Archive, g key.Generator, opts ...Option) Rebuilder {
+	o := newOptions(opts...)
+
+	return rebuilder{logger, a, s, newKeyChain(logger, g, o.fallbackGenerator, nil), o.namespace, o.override,
+		o.keyLimits, o.hashLongKeys, o.fingerprint, set(o.incremental), o.excludeRoot, o.excludes, o.signer, o.scope,
+		newBandwidth(o.rateLimits.Upload, o.rateLimits.Global), o.concurrency, o.progressInterval, o.tracer(), o.recorder(),
+		o.dryRun}
 }
 
 // Rebuild TODO
@@ -41,15 +64,15 @@ func (r rebuilder) Rebuild(srcs []string) error {
 
 	now := time.Now()
 
-	key, err := r.generateKey()
+	key, err := r.kc.first()
 	if err != nil {
 		return fmt.Errorf("generate key, %w", err)
 	}
 
 	var (
-		wg        sync.WaitGroup
-		errs      = &internal.MultiError{}
-		namespace = filepath.ToSlash(filepath.Clean(r.namespace))
+		wg   sync.WaitGroup
+		errs = &internal.MultiError{}
+		sem  = newSemaphore(r.concurrency)
 	)
 
 	for _, src := range srcs {
@@ -57,31 +80,120 @@ func (r rebuilder) Rebuild(srcs []string) error {
 			return fmt.Errorf("source <%s>, make sure file or directory exists and readable, %w", src, err)
 		}
 
-		dst := filepath.Join(namespace, key, src)
+		dst, err := remotePath(r.limits, r.hashLongKeys, scopedNamespace(r.namespace, r.scope), key, src)
+		if err != nil {
+			return fmt.Errorf("destination for <%s>, %w", src, err)
+		}
+
+		var fp string
 
-		// If no override is set and object already exists in storage, skip it.
-		if !r.override {
+		// If fingerprint is set and it matches the stored one, skip it.
+		// Otherwise if no override is set and object already exists in storage, skip it.
+		if r.fingerprint != nil {
+			fp, err = r.fingerprint(src)
+			if err != nil {
+				return fmt.Errorf("fingerprint of <%s>, %w", src, err)
+			}
+
+			unchanged, err := r.unchanged(dst, fp)
+			if err != nil {
+				return err
+			}
+
+			if unchanged {
+				level.Info(r.logger).Log("msg", "cache unchanged, skipping upload", "local", src, "remote", dst)
+				r.record(Result{Operation: OperationRebuild, Mount: src, Key: key, Remote: dst, Skipped: true, DryRun: r.dryRun})
+
+				continue
+			}
+		} else if !r.override {
 			exists, err := r.s.Exists(dst)
 			if err != nil {
 				return fmt.Errorf("destination <%s> existence check, %w", dst, err)
 			}
 
 			if exists {
+				level.Info(r.logger).Log("msg", "cache exists, skipping upload", "local", src, "remote", dst)
+				r.record(Result{Operation: OperationRebuild, Mount: src, Key: key, Remote: dst, Skipped: true, DryRun: r.dryRun})
+
 				continue
 			}
 		}
 
+		if r.dryRun {
+			res := Result{Operation: OperationRebuild, Mount: src, Key: key, Remote: dst, DryRun: true}
+			if err := r.estimate(src, &res); err != nil {
+				return fmt.Errorf("estimate size of <%s>, %w", src, err)
+			}
+
+			level.Info(r.logger).Log("msg", "dry run, would upload", "local", src, "remote", dst,
+				"size", humanize.Bytes(uint64(res.Size)), "archive size", humanize.Bytes(uint64(res.Transferred)))
+			r.record(res)
+
+			continue
+		}
+
 		level.Info(r.logger).Log("msg", "rebuilding cache for directory", "local", src, "remote", dst)
 
 		wg.Add(1) //nolint:gomnd
 
-		go func(dst, src string) {
+		go func(dst, src, fp string) {
 			defer wg.Done()
 
-			if err := r.rebuild(src, dst); err != nil {
-				errs.Add(fmt.Errorf("upload from <%s> to <%s>, %w", src, dst, err))
+			sem.acquire()
+			defer sem.release()
+
+			res := Result{Operation: OperationRebuild, Mount: src, Key: key, Remote: dst}
+
+			// NOTICE: The mount is rebuilt with the storage and archive of its trace,
+			// so that their calls are traced as children of the mount.
+			m := r
+			s, a, end := r.tracer.StartMount(OperationRebuild, src, r.s, r.a)
+			m.s, m.a = s, a
+
+			defer func(start time.Time) {
+				res.Duration = time.Since(start)
+				end(res)
+				r.recorder.Record(res)
+			}(time.Now())
+
+			rebuild := m.rebuild
+			if m.incremental[src] {
+				rebuild = m.rebuildIncremental
+			}
+
+			digest, err := rebuild(src, dst, &res)
+			if err != nil {
+				res.Err = fmt.Errorf("upload from <%s> to <%s>, %w", src, dst, err)
+				errs.Add(res.Err)
+
+				return
+			}
+
+			if err := m.sign(dst, digest); err != nil {
+				res.Err = fmt.Errorf("sign <%s>, %w", dst, err)
+				errs.Add(res.Err)
+
+				return
+			}
+
+			if fp == "" {
+				return
+			}
+
+			if err := m.s.Put(dst+fingerprintSuffix, strings.NewReader(fp)); err != nil {
+				res.Err = fmt.Errorf("upload fingerprint of <%s> to <%s>, %w", src, dst, err)
+				errs.Add(res.Err)
+
+				return
+			}
+
+			// NOTICE: A fingerprint planted by an untrusted build would otherwise make trusted builds skip the upload.
+			if err := m.sign(dst+fingerprintSuffix, fp); err != nil {
+				res.Err = fmt.Errorf("sign fingerprint of <%s>, %w", dst, err)
+				errs.Add(res.Err)
 			}
-		}(dst, src)
+		}(dst, src, fp)
 	}
 
 	wg.Wait()
@@ -95,11 +207,19 @@ func (r rebuilder) Rebuild(srcs []string) error {
 	return nil
 }
 
-// rebuild pushes the archived file to the cache.
-func (r rebuilder) rebuild(src, dst string) (err error) {
+// record traces and records the result of a mount that is not rebuilt, such as a skipped one.
+func (r rebuilder) record(res Result) {
+	_, _, end := r.tracer.StartMount(res.Operation, res.Mount, r.s, r.a)
+	end(res)
+
+	r.recorder.Record(res)
+}
+
+// rebuild pushes the archived file to the cache, returns the hex encoded sha256 digest of the uploaded archive.
+func (r rebuilder) rebuild(src, dst string, res *Result) (_ string, err error) {
 	src, err = filepath.Abs(filepath.Clean(src))
 	if err != nil {
-		return fmt.Errorf("clean source path, %w", err)
+		return "", fmt.Errorf("clean source path, %w", err)
 	}
 
 	pr, pw := io.Pipe()
@@ -107,11 +227,15 @@ func (r rebuilder) rebuild(src, dst string) (err error) {
 
 	var written int64
 
-	go func(wrt *int64) {
+	// NOTICE: Pipe writer is closed after the goroutine sets written bytes and archive duration,
+	// so they are set once the upload reads the end of the archive.
+	go func(wrt *int64, archived *time.Duration) {
 		defer internal.CloseWithErrLogf(r.logger, pw, "pw close defer")
 
 		level.Info(r.logger).Log("msg", "archiving directory", "src", src)
 
+		start := time.Now()
+
 		written, err := r.a.Create([]string{src}, pw)
 		if err != nil {
 			if err := pw.CloseWithError(fmt.Errorf("archive write, pipe writer failed, %w", err)); err != nil {
@@ -120,12 +244,22 @@ func (r rebuilder) rebuild(src, dst string) (err error) {
 		}
 
 		*wrt += written
-	}(&written)
+		*archived = time.Since(start)
+	}(&written, &res.ArchiveDuration)
 
 	level.Info(r.logger).Log("msg", "uploading archived directory", "local", src, "remote", dst)
 
-	sw := &statWriter{}
-	tr := io.TeeReader(pr, sw)
+	var (
+		sw = &statWriter{}
+		h  = sha256.New()
+		tr = io.TeeReader(r.bandwidth.transfer().reader(pr), io.MultiWriter(sw, h))
+	)
+
+	// NOTICE: Size of the archive is not known before it is created, and the size of the source does not tell it,
+	// since archives are compressed. So progress of uploaded bytes is logged without a total.
+	defer sw.report(r.logger, r.progress, "archiving and uploading", 0, "local", src, "remote", dst)()
+
+	start := time.Now()
 
 	if err := r.s.Put(dst, tr); err != nil {
 		err = fmt.Errorf("upload file, pipe reader failed, %w", err)
@@ -133,37 +267,68 @@ func (r rebuilder) rebuild(src, dst string) (err error) {
 			level.Error(r.logger).Log("msg", "pr close", "err", err)
 		}
 
-		return err
+		return "", err
 	}
 
+	res.Size, res.Transferred, res.TransferDuration = written, sw.bytes(), time.Since(start)
+
 	level.Debug(r.logger).Log(
 		"msg", "archive created",
 		"local", src,
 		"remote", dst,
-		"archived bytes", humanize.Bytes(uint64(sw.written)),
+		"archived bytes", humanize.Bytes(uint64(sw.bytes())),
 		"read bytes", humanize.Bytes(uint64(written)),
-		"ratio", fmt.Sprintf("%%%0.2f", float64(sw.written)/float64(written)*100.0), //nolint:gomnd
+		"ratio", fmt.Sprintf("%%%0.2f", float64(sw.bytes())/float64(written)*100.0), //nolint:gomnd
 	)
 
-	return nil
+	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
-// Helpers
+// estimate walks the source to estimate the size of its cache, as rebuild would archive it, without uploading.
+// Files of incremental mounts are uploaded as they are, so their size is the size of the cache.
+func (r rebuilder) estimate(src string, res *Result) error {
+	if r.incremental[src] {
+		size, err := sourceSize(src)
+		if err != nil {
+			return err
+		}
+
+		res.Size, res.Transferred = size, size
 
-func (r rebuilder) generateKey(parts ...string) (string, error) {
-	key, err := r.g.Generate(parts...)
-	if err == nil {
-		return key, nil
+		return nil
 	}
 
-	if r.fg != nil {
-		level.Error(r.logger).Log("msg", "falling back to fallback key generator", "err", err)
+	src, err := filepath.Abs(filepath.Clean(src))
+	if err != nil {
+		return fmt.Errorf("clean source path, %w", err)
+	}
 
-		key, err = r.fg.Generate(parts...)
-		if err == nil {
-			return key, nil
-		}
+	sw := &statWriter{}
+
+	written, err := r.a.Create([]string{src}, sw)
+	if err != nil {
+		return fmt.Errorf("archive, %w", err)
+	}
+
+	res.Size, res.Transferred = written, sw.bytes()
+
+	return nil
+}
+
+// sign uploads the signature of the object next to it, if a signer is set.
+func (r rebuilder) sign(dst, digest string) error {
+	if r.signer == nil {
+		return nil
 	}
 
-	return "", err
+	sig, err := r.signer.sign(dst, digest)
+	if err != nil {
+		return err
+	}
+
+	if err := r.s.Put(dst+signatureSuffix, bytes.NewReader(sig)); err != nil {
+		return fmt.Errorf("upload signature, %w", err)
+	}
+
+	return nil
 }
@@ -1,8 +1,271 @@
 package cache
 
-import "testing"
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/meltwater/drone-cache/archive/gzip"
+	"github.com/meltwater/drone-cache/archive/tar"
+	"github.com/meltwater/drone-cache/storage/common"
+	"github.com/meltwater/drone-cache/test"
+
+	"github.com/go-kit/kit/log"
+)
 
 func TestRebuild(t *testing.T) {
 	// Implement me!
 	t.Skip("skipping unimplemented test.")
 }
+
+func TestRebuildWithFingerprint(t *testing.T) {
+	// Setup
+	dir, dirClean := test.CreateTempDir(t, "rebuild_fingerprint")
+	t.Cleanup(dirClean)
+
+	file := filepath.Join(dir, "file.txt")
+	test.Ok(t, ioutil.WriteFile(file, []byte("hello\n"), 0644))
+
+	var (
+		s = newMemStorage()
+		a = tar.New(log.NewNopLogger(), filepath.Dir(dir), false)
+		r = NewRebuilder(log.NewNopLogger(), s, a, staticGenerator("key"),
+			WithNamespace("namespace"), WithFingerprint(fingerprintOf(t, FingerprintContent)))
+	)
+
+	// Run & Test
+	test.Ok(t, r.Rebuild([]string{dir}))
+	test.Equals(t, 1, s.puts[filepath.Base(dir)])
+
+	test.Ok(t, r.Rebuild([]string{dir}))
+	test.Equals(t, 1, s.puts[filepath.Base(dir)], "unchanged source uploaded again")
+
+	test.Ok(t, ioutil.WriteFile(file, []byte("hello, drone!\n"), 0644))
+
+	test.Ok(t, r.Rebuild([]string{dir}))
+	test.Equals(t, 2, s.puts[filepath.Base(dir)], "changed source is not uploaded")
+}
+
+func TestRebuildWithFailingGenerator(t *testing.T) {
+	// Setup
+	dir, dirClean := test.CreateTempDir(t, "rebuild_failing_generator")
+	t.Cleanup(dirClean)
+
+	test.Ok(t, ioutil.WriteFile(filepath.Join(dir, "file.txt"), []byte("hello\n"), 0644))
+
+	var (
+		s = newMemStorage()
+		a = tar.New(log.NewNopLogger(), filepath.Dir(dir), false)
+		r = NewRebuilder(log.NewNopLogger(), s, a, failingGenerator{}, WithNamespace("namespace"),
+			WithGenerators(staticGenerator("restore")), WithFallbackGenerator(staticGenerator("fallback")))
+	)
+
+	// Run
+	test.Ok(t, r.Rebuild([]string{dir}))
+
+	// Test
+	test.Equals(t, 1, len(s.objects))
+
+	for p := range s.objects {
+		k, ok := KeyOf("namespace", p)
+		test.Assert(t, ok, "object <%s> is not stored under a key", p)
+		test.Equals(t, "fallback", k, "cache is not written with the fallback key")
+	}
+}
+
+func TestRebuildWithConcurrency(t *testing.T) {
+	// Setup
+	dir, dirClean := test.CreateTempDir(t, "rebuild_concurrency")
+	t.Cleanup(dirClean)
+
+	var srcs []string
+
+	for i := 0; i < 6; i++ {
+		src := filepath.Join(dir, fmt.Sprintf("mount%d", i))
+		test.Ok(t, os.Mkdir(src, 0755))
+		test.Ok(t, ioutil.WriteFile(filepath.Join(src, "file.txt"), []byte("hello\n"), 0644))
+
+		srcs = append(srcs, src)
+	}
+
+	var (
+		s = &busyStorage{memStorage: newMemStorage()}
+		a = tar.New(log.NewNopLogger(), dir, false)
+		r = NewRebuilder(log.NewNopLogger(), s, a, staticGenerator("key"),
+			WithNamespace("namespace"), WithOverride(true), WithConcurrency(2))
+	)
+
+	// Run & Test
+	test.Ok(t, r.Rebuild(srcs))
+	test.Equals(t, 2, s.max)
+	test.Equals(t, len(srcs), len(s.objects))
+}
+
+func TestRebuildProgress(t *testing.T) {
+	// Setup
+	dir, dirClean := test.CreateTempDir(t, "rebuild_progress")
+	t.Cleanup(dirClean)
+
+	test.Ok(t, ioutil.WriteFile(filepath.Join(dir, "file.txt"), make([]byte, 2000), 0644))
+
+	var (
+		mu     sync.Mutex
+		logs   int
+		totals []interface{}
+		logger = log.LoggerFunc(func(keyvals ...interface{}) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			for i := 0; i+1 < len(keyvals); i += 2 {
+				switch keyvals[i] {
+				case "throughput":
+					logs++
+				case "total", "progress":
+					totals = append(totals, keyvals[i+1])
+				}
+			}
+
+			return nil
+		})
+
+		s = &busyStorage{memStorage: newMemStorage()}
+		a = gzip.New(log.NewNopLogger(), dir, false, flate.BestCompression)
+		r = NewRebuilder(logger, s, a, staticGenerator("key"),
+			WithNamespace("namespace"), WithOverride(true), WithProgressInterval(time.Millisecond))
+	)
+
+	// Run
+	test.Ok(t, r.Rebuild([]string{dir}))
+
+	// Test
+	mu.Lock()
+	defer mu.Unlock()
+
+	test.Assert(t, logs > 0, "progress is not logged")
+	// NOTICE: Compressed archives are smaller than their source, so uploads have no total to compare against.
+	test.Equals(t, 0, len(totals), "progress of compressed uploads is logged against the size of the source")
+}
+
+// Helpers
+
+// memStorage is an in-memory storage.Storage, counts uploads and downloads by base name of the objects.
+type memStorage struct {
+	mu sync.Mutex
+
+	objects  map[string][]byte
+	modified map[string]time.Time
+	puts     map[string]int
+	gets     map[string]int
+}
+
+func newMemStorage() *memStorage {
+	return &memStorage{
+		objects:  map[string][]byte{},
+		modified: map[string]time.Time{},
+		puts:     map[string]int{},
+		gets:     map[string]int{},
+	}
+}
+
+func (s *memStorage) Get(p string, w io.Writer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.objects[p]
+	if !ok {
+		return fmt.Errorf("get <%s>, %w", p, os.ErrNotExist)
+	}
+
+	s.gets[filepath.Base(p)]++
+
+	_, err := w.Write(b)
+
+	return err
+}
+
+func (s *memStorage) Put(p string, r io.Reader) error {
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, r); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.objects[p] = buf.Bytes()
+	s.modified[p] = time.Now()
+	s.puts[filepath.Base(p)]++
+
+	return nil
+}
+
+func (s *memStorage) Exists(p string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.objects[p]
+	return ok, nil
+}
+
+func (s *memStorage) List(p string) ([]common.FileEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var entries []common.FileEntry
+
+	for k, b := range s.objects {
+		if common.IsUnder(k, p) {
+			entries = append(entries, common.FileEntry{Path: k, Size: int64(len(b)), LastModified: s.modified[k]})
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+
+	return entries, nil
+}
+
+func (s *memStorage) Delete(p string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.objects, p)
+	delete(s.modified, p)
+
+	return nil
+}
+
+// busyStorage records the maximum number of concurrent uploads.
+type busyStorage struct {
+	*memStorage
+
+	mu          sync.Mutex
+	active, max int
+}
+
+func (s *busyStorage) Put(p string, r io.Reader) error {
+	s.mu.Lock()
+	s.active++
+
+	if s.active > s.max {
+		s.max = s.active
+	}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.active--
+		s.mu.Unlock()
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+
+	return s.memStorage.Put(p, r)
+}
@@ -1,12 +1,19 @@
 package cache
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
-	"path/filepath"
+	"io/ioutil"
+	"os"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/dustin/go-humanize"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/meltwater/drone-cache/archive"
@@ -15,20 +22,38 @@ import (
 	"github.com/meltwater/drone-cache/storage"
 )
 
+// ErrNotFound is returned when none of the keys has a cache for a mount.
+var ErrNotFound = errors.New("cache not found")
+
 type restorer struct {
 	logger log.Logger
 
 	a  archive.Archive
 	s  storage.Storage
-	g  key.Generator
-	fg key.Generator
-
-	namespace string
+	kc keyChain
+
+	namespace    string
+	limits       key.Limits
+	hashLongKeys bool
+	incremental  map[string]bool
+	verifier     *Verifier
+	scopes       []string
+	bandwidth    bandwidth
+	concurrency  int
+	progress     time.Duration
+	tracer       Tracer
+	recorder     Recorder
+	dryRun       bool
 }
 
-// NewRestorer TODO
-func NewRestorer(logger log.Logger, s storage.Storage, a archive.Archive, g key.Generator, fg key.Generator, namespace string) Restorer { //nolint:lll
-	return restorer{logger, a, s, g, fg, namespace}
+// NewRestorer creates a restorer that downloads caches with keys of the given generator, configured by the options.
+func NewRestorer(logger log.Logger, s storage.Storage, a archive.Archive, g key.Generator, opts ...Option) Restorer {
+	o := newOptions(opts...)
+
+	return restorer{logger, a, s, newKeyChain(logger, g, o.fallbackGenerator, o.generators), o.namespace, o.keyLimits,
+		o.hashLongKeys, set(o.incremental), o.verifier, readScopes(o.scope, o.fallbackScopes),
+		newBandwidth(o.rateLimits.Download, o.rateLimits.Global), o.concurrency, o.progressInterval, o.tracer(), o.recorder(),
+		o.dryRun}
 }
 
 // Restore TODO
@@ -37,31 +62,85 @@ func (r restorer) Restore(dsts []string) error {
 
 	now := time.Now()
 
-	key, err := r.generateKey()
+	keys, err := r.kc.keys()
 	if err != nil {
 		return fmt.Errorf("generate key, %w", err)
 	}
 
 	var (
-		wg        sync.WaitGroup
-		errs      = &internal.MultiError{}
-		namespace = filepath.ToSlash(filepath.Clean(r.namespace))
+		wg   sync.WaitGroup
+		errs = &internal.MultiError{}
+		sem  = newSemaphore(r.concurrency)
 	)
 
 	for _, dst := range dsts {
-		src := filepath.Join(namespace, key, dst)
+		src, key, err := r.lookup(keys, dst)
+		if err != nil {
+			err = fmt.Errorf("lookup <%s>, %w", dst, err)
+			errs.Add(err)
+
+			res := Result{Operation: OperationRestore, Mount: dst}
+			if !errors.Is(err, ErrNotFound) {
+				res.Err = err
+			}
+
+			r.record(res)
+
+			continue
+		}
+
+		if r.dryRun {
+			size := r.remoteSize(src)
+
+			level.Info(r.logger).Log("msg", "dry run, would restore", "local", dst, "remote", src, "size", humanize.Bytes(uint64(size)))
+			r.record(Result{Operation: OperationRestore, Mount: dst, Key: key, Remote: src, Hit: true, DryRun: true, Transferred: size})
+
+			continue
+		}
 
 		level.Info(r.logger).Log("msg", "restoring directory", "local", dst, "remote", src)
 
 		wg.Add(1) //nolint:gomnd
 
-		go func(src, dst string) {
+		go func(src, dst, key string) {
 			defer wg.Done()
 
-			if err := r.restore(src, dst); err != nil {
-				errs.Add(fmt.Errorf("download from <%s> to <%s>, %w", src, dst, err))
+			sem.acquire()
+			defer sem.release()
+
+			res := Result{Operation: OperationRestore, Mount: dst, Key: key, Remote: src, Hit: true}
+
+			// NOTICE: The mount is restored with the storage and archive of its trace,
+			// so that their calls are traced as children of the mount.
+			m := r
+			s, a, end := r.tracer.StartMount(OperationRestore, dst, r.s, r.a)
+			m.s, m.a = s, a
+
+			defer func(start time.Time) {
+				res.Duration = time.Since(start)
+				end(res)
+				r.recorder.Record(res)
+			}(time.Now())
+
+			restore := m.restore
+			if m.incremental[dst] {
+				restore = m.restoreIncremental
+			}
+
+			err := restore(src, dst, &res)
+			if errors.Is(err, ErrUntrusted) {
+				level.Warn(r.logger).Log("msg", "untrusted cache, treating as a miss", "local", dst, "remote", src, "err", err)
+
+				res.Hit = false
+
+				return
 			}
-		}(src, dst)
+
+			if err != nil {
+				res.Err = fmt.Errorf("download from <%s> to <%s>, %w", src, dst, err)
+				errs.Add(res.Err)
+			}
+		}(src, dst, key)
 	}
 
 	wg.Wait()
@@ -75,25 +154,45 @@ func (r restorer) Restore(dsts []string) error {
 	return nil
 }
 
+// record traces and records the result of a mount that is not restored, such as a missed one.
+func (r restorer) record(res Result) {
+	_, _, end := r.tracer.StartMount(res.Operation, res.Mount, r.s, r.a)
+	end(res)
+
+	r.recorder.Record(res)
+}
+
 // restore fetches the archived file from the cache and restores to the host machine's file system.
-func (r restorer) restore(src, dst string) (err error) {
+func (r restorer) restore(src, dst string, res *Result) (err error) {
+	if r.verifier != nil {
+		return r.restoreVerified(src, dst, res)
+	}
+
 	pr, pw := io.Pipe()
 	defer internal.CloseWithErrCapturef(&err, pr, "rebuild, pr close <%s>", dst)
 
-	go func() {
+	sw := &statWriter{}
+	defer sw.report(r.logger, r.progress, "downloading and extracting", r.size(src), "remote", src, "local", dst)()
+
+	downloaded := make(chan time.Duration, 1)
+
+	go func(start time.Time) {
+		defer func() { downloaded <- time.Since(start) }()
 		defer internal.CloseWithErrLogf(r.logger, pw, "pw close defer")
 
 		level.Info(r.logger).Log("msg", "downloading archived directory", "remote", src, "local", dst)
 
-		if err := r.s.Get(src, pw); err != nil {
+		if err := r.s.Get(src, r.bandwidth.transfer().writer(io.MultiWriter(pw, sw))); err != nil {
 			if err := pw.CloseWithError(fmt.Errorf("get file from storage backend, pipe writer failed, %w", err)); err != nil {
 				level.Error(r.logger).Log("msg", "pw close", "err", err)
 			}
 		}
-	}()
+	}(time.Now())
 
 	level.Info(r.logger).Log("msg", "extracting archived directory", "remote", src, "local", dst)
 
+	start := time.Now()
+
 	written, err := r.a.Extract(dst, pr)
 	if err != nil {
 		err = fmt.Errorf("extract files from downloaded archive, pipe reader failed, %w", err)
@@ -104,6 +203,15 @@ func (r restorer) restore(src, dst string) (err error) {
 		return err
 	}
 
+	res.ArchiveDuration = time.Since(start)
+
+	// NOTICE: Archives might end with padding that extraction does not read, it is read to complete the download.
+	if _, err := io.Copy(ioutil.Discard, pr); err != nil {
+		level.Debug(r.logger).Log("msg", "read the end of the archive", "remote", src, "err", err)
+	}
+
+	res.Size, res.Transferred, res.TransferDuration = written, sw.bytes(), <-downloaded
+
 	level.Debug(r.logger).Log(
 		"msg", "archive extracted",
 		"local", dst,
@@ -114,22 +222,143 @@ func (r restorer) restore(src, dst string) (err error) {
 	return nil
 }
 
-// Helpers
+// restoreVerified downloads the archived file to a temporary file, and only extracts it if its signature is trusted.
+func (r restorer) restoreVerified(src, dst string, res *Result) (err error) {
+	f, err := ioutil.TempFile("", "drone-cache-")
+	if err != nil {
+		return fmt.Errorf("create temporary file, %w", err)
+	}
 
-func (r restorer) generateKey(parts ...string) (string, error) {
-	key, err := r.g.Generate(parts...)
-	if err == nil {
-		return key, nil
+	defer func() {
+		if rerr := os.Remove(f.Name()); rerr != nil {
+			level.Error(r.logger).Log("msg", "remove temporary file", "err", rerr)
+		}
+	}()
+
+	defer internal.CloseWithErrCapturef(&err, f, "restore, temporary file close <%s>", dst)
+
+	level.Info(r.logger).Log("msg", "downloading archived directory", "remote", src, "local", dst)
+
+	var (
+		h    = sha256.New()
+		sw   = &statWriter{}
+		stop = sw.report(r.logger, r.progress, "downloading", r.size(src), "remote", src, "local", dst)
+	)
+
+	start := time.Now()
+
+	err = r.s.Get(src, r.bandwidth.transfer().writer(io.MultiWriter(f, h, sw)))
+	stop()
+
+	res.TransferDuration = time.Since(start)
+
+	if err != nil {
+		return fmt.Errorf("get file from storage backend, %w", err)
 	}
 
-	if r.fg != nil {
-		level.Error(r.logger).Log("msg", "falling back to fallback key generator", "err", err)
+	if err := r.verify(src, hex.EncodeToString(h.Sum(nil))); err != nil {
+		return err
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("rewind temporary file, %w", err)
+	}
+
+	level.Info(r.logger).Log("msg", "extracting archived directory", "remote", src, "local", dst)
+
+	start = time.Now()
+
+	written, err := r.a.Extract(dst, f)
+	if err != nil {
+		return fmt.Errorf("extract files from downloaded archive, %w", err)
+	}
+
+	res.Size, res.Transferred, res.ArchiveDuration = written, sw.bytes(), time.Since(start)
+
+	level.Debug(r.logger).Log("msg", "archive extracted", "local", dst, "remote", src, "raw size", written)
+
+	return nil
+}
+
+// verify checks the signature stored next to the object, if a verifier is set.
+func (r restorer) verify(src, digest string) error {
+	if r.verifier == nil {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if err := r.s.Get(src+signatureSuffix, &limitedWriter{w: &buf, n: maxSignatureSize}); err != nil {
+		return fmt.Errorf("get signature of <%s>, %v, %w", src, err, ErrUntrusted)
+	}
+
+	return r.verifier.verify(src, digest, buf.Bytes())
+}
+
+// Helpers
+
+// lookup returns the remote path of the first key that has a cache for the given mount, and the key.
+// Keys are tried in each scope in order, so caches of the current scope are preferred.
+func (r restorer) lookup(keys []string, dst string) (string, string, error) {
+	for _, scope := range r.scopes {
+		for _, k := range keys {
+			src, err := remotePath(r.limits, r.hashLongKeys, scopedNamespace(r.namespace, scope), k, dst)
+			if err != nil {
+				return "", "", fmt.Errorf("source for <%s>, %w", dst, err)
+			}
+
+			// NOTICE: A single key is not checked, unless on a dry run, as the download reports a missing cache anyway.
+			if len(keys) == 1 && len(r.scopes) == 1 && !r.dryRun {
+				return src, k, nil
+			}
+
+			// NOTICE: Unsigned caches are treated as a miss, so the next key is tried.
+			exists, err := r.exists(src)
+			if err != nil {
+				return "", "", err
+			}
+
+			if exists {
+				return src, k, nil
+			}
 
-		key, err = r.fg.Generate(parts...)
-		if err == nil {
-			return key, nil
+			level.Info(r.logger).Log("msg", "cache not found, trying next key", "local", dst, "remote", src)
 		}
 	}
 
-	return "", err
+	return "", "", fmt.Errorf("none of the keys <%s> has a cache, %w", strings.Join(keys, ", "), ErrNotFound)
+}
+
+// remoteSize returns the total size of the objects stored at the given path, as restore would download them.
+func (r restorer) remoteSize(src string) int64 {
+	entries, err := r.s.List(src)
+	if err != nil {
+		level.Debug(r.logger).Log("msg", "size of the cache is unknown", "remote", src, "err", err)
+		return 0
+	}
+
+	var size int64
+	for _, e := range entries {
+		size += e.Size
+	}
+
+	return size
+}
+
+// exists checks if the object exists, and if a verifier is set, its signature too.
+func (r restorer) exists(src string) (bool, error) {
+	exists, err := r.s.Exists(src)
+	if err != nil {
+		return false, fmt.Errorf("source <%s> existence check, %w", src, err)
+	}
+
+	if !exists || r.verifier == nil {
+		return exists, nil
+	}
+
+	exists, err = r.s.Exists(src + signatureSuffix)
+	if err != nil {
+		return false, fmt.Errorf("signature of <%s> existence check, %w", src, err)
+	}
+
+	return exists, nil
 }
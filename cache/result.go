@@ -0,0 +1,57 @@
+package cache
+
+import "time"
+
+// Operations that results are recorded for.
+const (
+	OperationRebuild = "rebuild"
+	OperationRestore = "restore"
+)
+
+// Result describes the outcome of rebuilding or restoring a single mount.
+type Result struct {
+	Operation string
+	Mount     string
+	// Key is the cache key the mount is rebuilt with or restored from, empty on a restore miss.
+	Key    string
+	Remote string
+
+	// Hit reports whether a cache is found for the mount on restore.
+	Hit bool
+	// Skipped reports whether rebuild skipped the mount, because its cache already exists or is unchanged.
+	Skipped bool
+	// DryRun reports whether the mount is only looked up, without uploading or downloading its cache.
+	DryRun bool
+
+	// Size is the number of bytes of the mount, before archiving or after extracting.
+	Size int64
+	// Transferred is the number of bytes uploaded to or downloaded from storage, or that would be on a dry run.
+	Transferred int64
+
+	Duration time.Duration
+	// ArchiveDuration is the time spent archiving or extracting the mount, zero for incremental mounts.
+	// Archives are streamed while they are transferred, so it overlaps with the transfer duration.
+	ArchiveDuration time.Duration
+	// TransferDuration is the time spent uploading or downloading the mount.
+	TransferDuration time.Duration
+
+	Err error
+}
+
+// Recorder records results of rebuilds and restores, it must be safe for concurrent use.
+type Recorder interface {
+	Record(Result)
+}
+
+type nopRecorder struct{}
+
+func (nopRecorder) Record(Result) {}
+
+// recorders records results to each recorder in order.
+type recorders []Recorder
+
+func (rs recorders) Record(res Result) {
+	for _, r := range rs {
+		r.Record(res)
+	}
+}
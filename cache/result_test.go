@@ -0,0 +1,206 @@
+package cache
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/meltwater/drone-cache/archive"
+	"github.com/meltwater/drone-cache/archive/tar"
+	"github.com/meltwater/drone-cache/storage"
+	"github.com/meltwater/drone-cache/test"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestRecordResults(t *testing.T) {
+	// Setup
+	dir, dirClean := test.CreateTempDir(t, "record_results")
+	t.Cleanup(dirClean)
+
+	test.Ok(t, ioutil.WriteFile(filepath.Join(dir, "file.txt"), []byte("hello\n"), 0644))
+
+	var (
+		s      = newMemStorage()
+		a      = tar.New(log.NewNopLogger(), filepath.Dir(dir), false)
+		rec    = &recorder{}
+		mounts = []string{dir}
+	)
+
+	newRebuilder := func() Rebuilder {
+		return NewRebuilder(log.NewNopLogger(), s, a, staticGenerator("key"),
+			WithNamespace("namespace"), WithIncremental(mounts...), WithRecorder(rec))
+	}
+
+	newRestorer := func(k string) Restorer {
+		return NewRestorer(log.NewNopLogger(), s, a, staticGenerator(k), WithGenerators(staticGenerator("other")),
+			WithNamespace("namespace"), WithIncremental(mounts...), WithRecorder(rec))
+	}
+
+	// Run
+	test.Ok(t, newRebuilder().Rebuild(mounts))
+	test.Ok(t, newRebuilder().Rebuild(mounts))
+	test.Ok(t, newRestorer("key").Restore(mounts))
+	test.NotOk(t, newRestorer("missing").Restore(mounts))
+
+	// Test
+	test.Equals(t, 4, len(rec.results))
+
+	built := rec.results[0]
+	test.Equals(t, OperationRebuild, built.Operation)
+	test.Equals(t, dir, built.Mount)
+	test.Equals(t, int64(6), built.Size)
+	test.Assert(t, built.Transferred > built.Size, "manifest is not counted as transferred")
+	test.Ok(t, built.Err)
+
+	test.Assert(t, rec.results[1].Skipped, "existing cache is not skipped")
+
+	restored := rec.results[2]
+	test.Equals(t, OperationRestore, restored.Operation)
+	test.Assert(t, restored.Hit, "existing cache is not a hit")
+	test.Equals(t, int64(6), restored.Size)
+	test.Ok(t, restored.Err)
+
+	missed := rec.results[3]
+	test.Assert(t, !missed.Hit, "missing cache is a hit")
+	test.Ok(t, missed.Err)
+}
+
+func TestRecordPhaseDurations(t *testing.T) {
+	// Setup
+	dir, dirClean := test.CreateTempDir(t, "record_phase_durations")
+	t.Cleanup(dirClean)
+
+	test.Ok(t, ioutil.WriteFile(filepath.Join(dir, "file.txt"), []byte("hello\n"), 0644))
+
+	// NOTICE: Archives extract mounts relative to the working directory, so the test can not run in parallel.
+	wd, err := os.Getwd()
+	test.Ok(t, err)
+	test.Ok(t, os.Chdir(filepath.Dir(dir)))
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	var (
+		s      = &busyStorage{memStorage: newMemStorage()}
+		a      = tar.New(log.NewNopLogger(), filepath.Dir(dir), false)
+		g      = staticGenerator("key")
+		rec    = &recorder{}
+		mounts = []string{filepath.Base(dir)}
+	)
+
+	// Run
+	test.Ok(t, NewRebuilder(log.NewNopLogger(), s, a, g, WithNamespace("namespace"), WithRecorder(rec)).Rebuild(mounts))
+	test.Ok(t, NewRestorer(log.NewNopLogger(), s, a, g, WithNamespace("namespace"), WithRecorder(rec)).Restore(mounts))
+
+	// Test
+	test.Equals(t, 2, len(rec.results))
+
+	for _, res := range rec.results {
+		test.Ok(t, res.Err)
+		test.Assert(t, res.ArchiveDuration > 0, "%s: archive duration is not recorded", res.Operation)
+		test.Assert(t, res.TransferDuration > 0, "%s: transfer duration is not recorded", res.Operation)
+		test.Assert(t, res.ArchiveDuration <= res.Duration && res.TransferDuration <= res.Duration,
+			"%s: phases take longer than the mount", res.Operation)
+	}
+
+	// NOTICE: Storage is busy for a while on each upload, which the transfer of the rebuild must account for.
+	test.Assert(t, rec.results[0].TransferDuration >= 10*time.Millisecond, "upload is not part of the transfer duration")
+}
+
+func TestTraceMounts(t *testing.T) {
+	// Setup
+	dir, dirClean := test.CreateTempDir(t, "trace_mounts")
+	t.Cleanup(dirClean)
+
+	test.Ok(t, ioutil.WriteFile(filepath.Join(dir, "file.txt"), []byte("hello\n"), 0644))
+
+	var (
+		s      = newMemStorage()
+		a      = tar.New(log.NewNopLogger(), filepath.Dir(dir), false)
+		tr     = &mountTracer{}
+		mounts = []string{dir}
+		opts   = []Option{WithNamespace("namespace"), WithIncremental(mounts...), WithTracer(tr)}
+	)
+
+	// Run
+	test.Ok(t, NewRebuilder(log.NewNopLogger(), s, a, staticGenerator("key"), opts...).Rebuild(mounts))
+	test.Ok(t, NewRestorer(log.NewNopLogger(), s, a, staticGenerator("key"), opts...).Restore(mounts))
+	test.NotOk(t, NewRestorer(log.NewNopLogger(), s, a, staticGenerator("missing"),
+		append(opts, WithGenerators(staticGenerator("other")))...).Restore(mounts))
+
+	// Test
+	test.Equals(t, []string{OperationRebuild, OperationRestore, OperationRestore}, tr.started)
+	test.Equals(t, 3, len(tr.ended))
+
+	test.Assert(t, tr.calls[0] > 0, "rebuild does not use the storage of the mount")
+	test.Assert(t, tr.calls[1] > 0, "restore does not use the storage of the mount")
+	test.Assert(t, tr.ended[1].Hit, "existing cache is not a hit")
+	test.Assert(t, !tr.ended[2].Hit, "missing cache is a hit")
+}
+
+// Helpers
+
+// recorder keeps the recorded results in order.
+type recorder struct {
+	mu      sync.Mutex
+	results []Result
+}
+
+func (r *recorder) Record(res Result) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.results = append(r.results, res)
+}
+
+// mountTracer keeps the started operations and ended results in order,
+// and counts the calls to the storage of each mount.
+type mountTracer struct {
+	mu      sync.Mutex
+	started []string
+	calls   []int
+	ended   []Result
+}
+
+func (t *mountTracer) StartMount(operation, _ string, s storage.Storage, a archive.Archive) (storage.Storage, archive.Archive, func(Result)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.started = append(t.started, operation)
+	t.calls = append(t.calls, 0)
+
+	return &countingStorage{Storage: s, t: t, i: len(t.calls) - 1}, a, func(res Result) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		t.ended = append(t.ended, res)
+	}
+}
+
+// countingStorage counts the gets and puts of a mount.
+type countingStorage struct {
+	storage.Storage
+
+	t *mountTracer
+	i int
+}
+
+func (s *countingStorage) Get(p string, w io.Writer) error {
+	s.count()
+	return s.Storage.Get(p, w)
+}
+
+func (s *countingStorage) Put(p string, r io.Reader) error {
+	s.count()
+	return s.Storage.Put(p, r)
+}
+
+func (s *countingStorage) count() {
+	s.t.mu.Lock()
+	defer s.t.mu.Unlock()
+
+	s.t.calls[s.i]++
+}
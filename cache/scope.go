@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"net/url"
+	"path"
+	"strings"
+)
+
+const (
+	// scopesNamespace is the path under namespace that branch scoped caches are stored under.
+	scopesNamespace = ".branches"
+	// pullsNamespace is the path under namespace that pull request scoped caches are stored under.
+	pullsNamespace = ".pulls"
+
+	// pullScopePrefix marks scopes of pull requests, ':' is not allowed in git branch names.
+	pullScopePrefix = "pull:"
+)
+
+// PullRequestScope returns the scope of the pull request with the given id, such as its number.
+// Pull requests are scoped apart from branches, so that a fork can not write to the scope of a branch,
+// even if its source branch has the same name, such as its own main.
+func PullRequestScope(id string) string {
+	return pullScopePrefix + id
+}
+
+// scopedNamespace returns the namespace of the given scope, branch names are escaped into a single path segment.
+func scopedNamespace(namespace, scope string) string {
+	if scope == "" {
+		return namespace
+	}
+
+	if strings.HasPrefix(scope, pullScopePrefix) {
+		return path.Join(namespace, pullsNamespace, url.PathEscape(strings.TrimPrefix(scope, pullScopePrefix)))
+	}
+
+	return path.Join(namespace, scopesNamespace, url.PathEscape(scope))
+}
+
+// readScopes returns the scopes to restore from in order, the write scope first, without duplicates.
+func readScopes(scope string, fallbacks []string) []string {
+	var (
+		scopes = []string{scope}
+		seen   = map[string]bool{scope: true}
+	)
+
+	for _, s := range fallbacks {
+		if s == "" || seen[s] {
+			continue
+		}
+
+		seen[s] = true
+		scopes = append(scopes, s)
+	}
+
+	return scopes
+}
@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/meltwater/drone-cache/archive/tar"
+	"github.com/meltwater/drone-cache/test"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestScopedNamespace(t *testing.T) {
+	test.Equals(t, "repo", scopedNamespace("repo", ""))
+	test.Equals(t, "repo/.branches/main", scopedNamespace("repo", "main"))
+	test.Equals(t, "repo/.branches/feature%2Fcache", scopedNamespace("repo", "feature/cache"))
+	test.Equals(t, "repo/.pulls/42", scopedNamespace("repo", PullRequestScope("42")))
+}
+
+func TestReadScopes(t *testing.T) {
+	test.Equals(t, []string{"feature"}, readScopes("feature", nil))
+	test.Equals(t, []string{"feature", "main"}, readScopes("feature", []string{"main", "", "feature", "main"}))
+}
+
+func TestBranchScope(t *testing.T) {
+	// Setup
+	dir, dirClean := test.CreateTempDir(t, "branch_scope")
+	t.Cleanup(dirClean)
+
+	file := filepath.Join(dir, "file.txt")
+	test.Ok(t, ioutil.WriteFile(file, []byte("main\n"), 0644))
+
+	var (
+		s = newMemStorage()
+		a = tar.New(log.NewNopLogger(), filepath.Dir(dir), false)
+		g = staticGenerator("key")
+		// NOTICE: Incremental mounts keep the test independent of archive paths.
+		mounts = []string{dir}
+	)
+
+	rebuilder := func(branch string) Rebuilder {
+		return NewRebuilder(log.NewNopLogger(), s, a, g,
+			WithNamespace("repo"), WithOverride(true), WithIncremental(mounts...), WithBranchScope(branch))
+	}
+
+	restorer := func(branch string, fallbacks ...string) Restorer {
+		return NewRestorer(log.NewNopLogger(), s, a, g,
+			WithNamespace("repo"), WithIncremental(mounts...), WithBranchScope(branch, fallbacks...))
+	}
+
+	restored := func(r Restorer) string {
+		test.Ok(t, os.Remove(file))
+		test.Ok(t, r.Restore(mounts))
+
+		b, err := ioutil.ReadFile(file)
+		test.Ok(t, err)
+
+		return string(b)
+	}
+
+	// Run & Test
+	test.Ok(t, rebuilder("main").Rebuild(mounts))
+
+	// Feature branch starts from the cache of the default branch.
+	test.Equals(t, "main\n", restored(restorer("feature/cache", "main")))
+
+	test.Ok(t, ioutil.WriteFile(file, []byte("feature\n"), 0644))
+	test.Ok(t, rebuilder("feature/cache").Rebuild(mounts))
+
+	// Feature branch prefers its own cache, default branch is not affected by it.
+	test.Equals(t, "feature\n", restored(restorer("feature/cache", "main")))
+	test.Equals(t, "main\n", restored(restorer("main")))
+
+	for p := range s.objects {
+		test.Assert(t, strings.HasPrefix(p, "repo/.branches/") || strings.HasPrefix(p, "repo/.files/"),
+			"object <%s> is written outside of branch scopes", p)
+	}
+}
+
+func TestPullRequestScope(t *testing.T) {
+	// Setup
+	dir, dirClean := test.CreateTempDir(t, "pull_request_scope")
+	t.Cleanup(dirClean)
+
+	file := filepath.Join(dir, "file.txt")
+	test.Ok(t, ioutil.WriteFile(file, []byte("main\n"), 0644))
+
+	var (
+		s      = newMemStorage()
+		a      = tar.New(log.NewNopLogger(), filepath.Dir(dir), false)
+		g      = staticGenerator("key")
+		mounts = []string{dir}
+		pull   = PullRequestScope("7")
+	)
+
+	rb := NewRebuilder(log.NewNopLogger(), s, a, g,
+		WithNamespace("repo"), WithOverride(true), WithIncremental(mounts...), WithBranchScope("main"))
+	test.Ok(t, rb.Rebuild(mounts))
+
+	// Run
+	// NOTICE: Source branch of the pull request, such as main of a fork, has the same name as the default branch.
+	test.Ok(t, ioutil.WriteFile(file, []byte("fork\n"), 0644))
+	rb = NewRebuilder(log.NewNopLogger(), s, a, g,
+		WithNamespace("repo"), WithOverride(true), WithIncremental(mounts...), WithBranchScope(pull))
+	test.Ok(t, rb.Rebuild(mounts))
+
+	// Test
+	test.Ok(t, os.Remove(file))
+	rs := NewRestorer(log.NewNopLogger(), s, a, g,
+		WithNamespace("repo"), WithIncremental(mounts...), WithBranchScope("main"))
+	test.Ok(t, rs.Restore(mounts))
+
+	b, err := ioutil.ReadFile(file)
+	test.Ok(t, err)
+	test.Equals(t, "main\n", string(b), "pull request overwrites the cache of the default branch")
+
+	exists, err := s.Exists(path.Join("repo/.pulls/7/key", dir))
+	test.Ok(t, err)
+	test.Assert(t, exists, "pull request cache is not written to its scope")
+}
@@ -0,0 +1,153 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	signatureSuffix  = ".sig"
+	signatureVersion = 1
+	// maxSignatureSize limits the size of the signatures, objects that are not signatures are not read further.
+	maxSignatureSize = 4 << 10 // 4 KiB
+)
+
+// ErrUntrusted is returned when a cache is not signed by any of the trusted keys.
+var ErrUntrusted = errors.New("cache is not signed by a trusted key")
+
+// signature is stored next to the signed object.
+type signature struct {
+	Version   int    `json:"version"`
+	KeyID     string `json:"key_id"`
+	Digest    string `json:"digest"`
+	Signature []byte `json:"signature"`
+}
+
+// Signer signs cache objects at rebuild, binding them to their path and the scope, e.g. the repository.
+type Signer struct {
+	key   ed25519.PrivateKey
+	scope string
+}
+
+// NewSigner creates a signer with the given key and scope.
+func NewSigner(key ed25519.PrivateKey, scope string) *Signer {
+	return &Signer{key: key, scope: scope}
+}
+
+// sign returns the encoded signature of the object at the given path with the given digest.
+func (s *Signer) sign(p, digest string) ([]byte, error) {
+	sig := signature{
+		Version:   signatureVersion,
+		KeyID:     keyID(s.key.Public().(ed25519.PublicKey)),
+		Digest:    digest,
+		Signature: ed25519.Sign(s.key, signedMessage(s.scope, p, digest)),
+	}
+
+	b, err := json.Marshal(sig)
+	if err != nil {
+		return nil, fmt.Errorf("encode signature, %w", err)
+	}
+
+	return b, nil
+}
+
+// verifier returns a verifier that trusts the key of the signer in its scope.
+func (s *Signer) verifier() *Verifier {
+	return NewVerifier(s.scope, s.key.Public().(ed25519.PublicKey))
+}
+
+// Verifier verifies that cache objects are signed by one of the trusted keys, for the same path and scope.
+type Verifier struct {
+	keys  map[string]ed25519.PublicKey
+	scope string
+}
+
+// NewVerifier creates a verifier that trusts the given keys in the given scope.
+func NewVerifier(scope string, keys ...ed25519.PublicKey) *Verifier {
+	v := &Verifier{keys: make(map[string]ed25519.PublicKey, len(keys)), scope: scope}
+	for _, k := range keys {
+		v.keys[keyID(k)] = k
+	}
+
+	return v
+}
+
+// verify checks the encoded signature of the object at the given path with the given digest.
+func (v *Verifier) verify(p, digest string, b []byte) error {
+	var sig signature
+	if err := json.Unmarshal(b, &sig); err != nil || sig.Version != signatureVersion {
+		return fmt.Errorf("decode signature of <%s>, %w", p, ErrUntrusted)
+	}
+
+	k, ok := v.keys[sig.KeyID]
+	if !ok {
+		return fmt.Errorf("unknown key id <%s>, %w", sig.KeyID, ErrUntrusted)
+	}
+
+	if sig.Digest != digest {
+		return fmt.Errorf("digest of <%s> does not match the signed digest, %w", p, ErrUntrusted)
+	}
+
+	if !ed25519.Verify(k, signedMessage(v.scope, p, digest), sig.Signature) {
+		return fmt.Errorf("invalid signature of <%s>, %w", p, ErrUntrusted)
+	}
+
+	return nil
+}
+
+// ParseSigningKey parses a base64 encoded ed25519 private key, either the 32 bytes seed or the 64 bytes key.
+func ParseSigningKey(s string) (ed25519.PrivateKey, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("decode signing key, %w", err)
+	}
+
+	switch len(b) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(b), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(b), nil
+	default:
+		return nil, fmt.Errorf("signing key must be %d or %d bytes, got %d bytes", ed25519.SeedSize, ed25519.PrivateKeySize, len(b))
+	}
+}
+
+// ParseVerificationKey parses a base64 encoded 32 bytes ed25519 public key.
+func ParseVerificationKey(s string) (ed25519.PublicKey, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("decode verification key, %w", err)
+	}
+
+	if len(b) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("verification key must be %d bytes, got %d bytes", ed25519.PublicKeySize, len(b))
+	}
+
+	return ed25519.PublicKey(b), nil
+}
+
+// Helpers
+
+// signedMessage binds the digest to the path and scope, so signed objects can not be moved to another key or repository.
+func signedMessage(scope, p, digest string) []byte {
+	var buf bytes.Buffer
+
+	buf.WriteString("drone-cache signature v1\x00")
+	buf.WriteString(scope + "\x00")
+	buf.WriteString(p + "\x00")
+	buf.WriteString(digest)
+
+	return buf.Bytes()
+}
+
+func keyID(k ed25519.PublicKey) string {
+	sum := sha256.Sum256(k)
+	return hex.EncodeToString(sum[:8])
+}
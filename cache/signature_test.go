@@ -0,0 +1,169 @@
+package cache
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/meltwater/drone-cache/archive/tar"
+	"github.com/meltwater/drone-cache/test"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestSignature(t *testing.T) {
+	t.Parallel()
+
+	var (
+		pub, priv = testSigningKey(t)
+		other, _  = testSigningKey(t)
+		digest    = "0123456789abcdef"
+	)
+
+	sig, err := NewSigner(priv, "octocat/hello-world").sign("hello-world/key/mount", digest)
+	test.Ok(t, err)
+
+	for _, tc := range []struct {
+		name     string
+		verifier *Verifier
+		path     string
+		digest   string
+		err      error
+	}{
+		{
+			name:     "trusted",
+			verifier: NewVerifier("octocat/hello-world", other, pub),
+			path:     "hello-world/key/mount",
+			digest:   digest,
+		},
+		{
+			name:     "untrusted key",
+			verifier: NewVerifier("octocat/hello-world", other),
+			path:     "hello-world/key/mount",
+			digest:   digest,
+			err:      ErrUntrusted,
+		},
+		{
+			name:     "other scope",
+			verifier: NewVerifier("forker/hello-world", pub),
+			path:     "hello-world/key/mount",
+			digest:   digest,
+			err:      ErrUntrusted,
+		},
+		{
+			name:     "other path",
+			verifier: NewVerifier("octocat/hello-world", pub),
+			path:     "hello-world/other/mount",
+			digest:   digest,
+			err:      ErrUntrusted,
+		},
+		{
+			name:     "other digest",
+			verifier: NewVerifier("octocat/hello-world", pub),
+			path:     "hello-world/key/mount",
+			digest:   "fedcba9876543210",
+			err:      ErrUntrusted,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.verifier.verify(tc.path, tc.digest, sig)
+			if tc.err == nil {
+				test.Ok(t, err)
+				return
+			}
+
+			test.Expected(t, err, tc.err)
+		})
+	}
+}
+
+func TestRestoreSigned(t *testing.T) {
+	// Setup
+	test.Ok(t, os.MkdirAll("testdata", 0755))
+	t.Cleanup(func() { os.RemoveAll("testdata") })
+
+	root, err := os.Getwd()
+	test.Ok(t, err)
+
+	dir, dirClean := test.CreateTempDir(t, "restore_signed", "testdata")
+	t.Cleanup(dirClean)
+
+	file := filepath.Join(dir, "file.txt")
+	test.Ok(t, ioutil.WriteFile(file, []byte("hello\n"), 0644))
+
+	var (
+		pub, priv = testSigningKey(t)
+		other, _  = testSigningKey(t)
+		s         = newMemStorage()
+		a         = tar.New(log.NewNopLogger(), root, false)
+		g         = staticGenerator("key")
+		scope     = "octocat/hello-world"
+	)
+
+	rb := NewRebuilder(log.NewNopLogger(), s, a, g,
+		WithNamespace("namespace"), WithOverride(true), WithSigner(NewSigner(priv, scope)))
+	test.Ok(t, rb.Rebuild([]string{dir}))
+
+	restore := func(v *Verifier) bool {
+		test.Ok(t, os.Remove(file))
+		rs := NewRestorer(log.NewNopLogger(), s, a, g, WithNamespace("namespace"), WithVerifier(v))
+		test.Ok(t, rs.Restore([]string{dir}))
+
+		_, err := os.Stat(file)
+		if err == nil {
+			return true
+		}
+
+		test.Assert(t, os.IsNotExist(err), "unexpected error: %v", err)
+		test.Ok(t, ioutil.WriteFile(file, []byte("hello\n"), 0644))
+
+		return false
+	}
+
+	// Run & Test
+	test.Assert(t, restore(NewVerifier(scope, pub)), "cache signed by trusted key is not restored")
+	test.Assert(t, !restore(NewVerifier(scope, other)), "cache signed by untrusted key is restored")
+
+	for p, b := range s.objects {
+		if filepath.Ext(p) != signatureSuffix {
+			s.objects[p] = append(b, 0)
+		}
+	}
+
+	test.Assert(t, !restore(NewVerifier(scope, pub)), "tampered cache is restored")
+}
+
+func TestParseSigningKey(t *testing.T) {
+	t.Parallel()
+
+	pub, priv := testSigningKey(t)
+
+	parsed, err := ParseSigningKey(base64.StdEncoding.EncodeToString(priv.Seed()))
+	test.Ok(t, err)
+	test.Equals(t, priv, parsed)
+
+	parsed, err = ParseSigningKey(base64.StdEncoding.EncodeToString(priv))
+	test.Ok(t, err)
+	test.Equals(t, priv, parsed)
+
+	verification, err := ParseVerificationKey(base64.StdEncoding.EncodeToString(pub))
+	test.Ok(t, err)
+	test.Equals(t, pub, verification)
+
+	_, err = ParseVerificationKey(base64.StdEncoding.EncodeToString(priv))
+	test.NotOk(t, err)
+}
+
+// Helpers
+
+func testSigningKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	test.Ok(t, err)
+
+	return pub, priv
+}
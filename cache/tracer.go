@@ -0,0 +1,20 @@
+package cache
+
+import (
+	"github.com/meltwater/drone-cache/archive"
+	"github.com/meltwater/drone-cache/storage"
+)
+
+// Tracer traces rebuilds and restores of each mount, it must be safe for concurrent use.
+type Tracer interface {
+	// StartMount is called when the mount starts, with the storage and archive of the cache.
+	// It returns the storage and archive that the mount is rebuilt or restored with,
+	// and a function that is called with the result of the mount when it is done.
+	StartMount(operation, mount string, s storage.Storage, a archive.Archive) (storage.Storage, archive.Archive, func(Result))
+}
+
+type nopTracer struct{}
+
+func (nopTracer) StartMount(_, _ string, s storage.Storage, a archive.Archive) (storage.Storage, archive.Archive, func(Result)) {
+	return s, a, func(Result) {}
+}
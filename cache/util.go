@@ -1,13 +1,114 @@
 package cache
 
-// statWriter implements io.Writer and keeps track of the written bytes.
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+)
+
+// statWriter implements io.Writer and keeps track of the written bytes, it is safe for concurrent use.
 type statWriter struct {
 	written int64
 }
 
 func (s *statWriter) Write(p []byte) (n int, err error) {
 	size := len(p)
-	s.written += int64(size)
+	s.add(int64(size))
 
 	return size, nil
 }
+
+// add counts bytes that are processed without being written, e.g. skipped files.
+func (s *statWriter) add(n int64) {
+	atomic.AddInt64(&s.written, n)
+}
+
+func (s *statWriter) bytes() int64 {
+	return atomic.LoadInt64(&s.written)
+}
+
+// set returns a set of the given items.
+func set(items []string) map[string]bool {
+	s := make(map[string]bool, len(items))
+	for _, i := range items {
+		s[i] = true
+	}
+
+	return s
+}
+
+// semaphore limits the number of concurrent workers, nil semaphore does not limit.
+type semaphore chan struct{}
+
+func newSemaphore(n int) semaphore {
+	if n <= 0 {
+		return nil
+	}
+
+	return make(semaphore, n)
+}
+
+func (s semaphore) acquire() {
+	if s != nil {
+		s <- struct{}{}
+	}
+}
+
+func (s semaphore) release() {
+	if s != nil {
+		<-s
+	}
+}
+
+// errLimitExceeded is returned by limitedWriter when more than its limit is written.
+var errLimitExceeded = errors.New("write limit exceeded")
+
+// limitedWriter fails when more than n bytes written.
+type limitedWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > l.n {
+		return 0, errLimitExceeded
+	}
+
+	l.n -= int64(len(p))
+
+	return l.w.Write(p)
+}
+
+// errNotFileManifest is returned by manifestWriter when the written object can not be a file manifest.
+var errNotFileManifest = errors.New("not a file manifest")
+
+// maxFileManifestSize limits the size of the file manifests read by the flusher.
+const maxFileManifestSize = 64 << 20 // 64 MiB
+
+// manifestWriter fails early when the written object is not a JSON document, or is larger than n bytes,
+// so that archives are not downloaded as a whole to find file manifests.
+type manifestWriter struct {
+	w       io.Writer
+	n       int64
+	started bool
+}
+
+func (m *manifestWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	if !m.started && p[0] != '{' {
+		return 0, errNotFileManifest
+	}
+
+	m.started = true
+
+	if int64(len(p)) > m.n {
+		return 0, errNotFileManifest
+	}
+
+	m.n -= int64(len(p))
+
+	return m.w.Write(p)
+}
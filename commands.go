@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/meltwater/drone-cache/internal/plugin"
+
+	"github.com/urfave/cli/v2"
+)
+
+// commands creates the subcommands to use the plugin outside of Drone, such as locally or in other CI systems.
+// Subcommands accept the same flags as the plugin, mounts and keys are given as arguments.
+func commands(flags []cli.Flag) []*cli.Command {
+	return []*cli.Command{
+		{
+			Name:      "restore",
+			Usage:     "restore the cache of the mounts",
+			ArgsUsage: "[mount...]",
+			Flags:     flags,
+			Action:    mode(func(cfg *plugin.Config) { cfg.Restore = true }),
+		},
+		{
+			Name:      "rebuild",
+			Usage:     "rebuild the cache of the mounts",
+			ArgsUsage: "[mount...]",
+			Flags:     flags,
+			Action:    mode(func(cfg *plugin.Config) { cfg.Rebuild = true }),
+		},
+		{
+			Name:   "flush",
+			Usage:  "remove caches of the namespace that are not modified for flush-ttl",
+			Flags:  flags,
+			Action: mode(func(cfg *plugin.Config) { cfg.Flush = true }),
+		},
+		{
+			Name:      "ls",
+			Usage:     "list keys of the namespace with their sizes and ages",
+			ArgsUsage: "[prefix]",
+			Flags:     flags,
+			Action: func(c *cli.Context) error {
+				plg, _, err := newPlugin(c)
+				if err != nil {
+					return exit(err)
+				}
+
+				return exit(plg.List(c.App.Writer, c.Args().First()))
+			},
+		},
+		{
+			Name:      "inspect",
+			Usage:     "show the objects of a key and the contents of its archives",
+			ArgsUsage: "key",
+			Flags:     flags,
+			Action: func(c *cli.Context) error {
+				if c.NArg() != 1 {
+					return exit(errors.New("exactly one key is required"))
+				}
+
+				plg, _, err := newPlugin(c)
+				if err != nil {
+					return exit(err)
+				}
+
+				return exit(plg.Inspect(c.App.Writer, c.Args().First()))
+			},
+		},
+		{
+			Name:      "rm",
+			Usage:     "remove every object of the keys",
+			ArgsUsage: "key...",
+			Flags:     flags,
+			Action: func(c *cli.Context) error {
+				plg, _, err := newPlugin(c)
+				if err != nil {
+					return exit(err)
+				}
+
+				return exit(plg.Remove(c.Args().Slice()...))
+			},
+		},
+	}
+}
+
+// mode creates an action that executes the plugin in the mode that the given function sets.
+// Arguments override the mounts of the flags.
+func mode(set func(*plugin.Config)) cli.ActionFunc {
+	return func(c *cli.Context) error {
+		plg, _, err := newPlugin(c)
+		if err != nil {
+			return exit(err)
+		}
+
+		plg.Config.Rebuild, plg.Config.Restore, plg.Config.Flush = false, false, false
+		set(&plg.Config)
+
+		if c.Args().Present() {
+			plg.Config.Mount = c.Args().Slice()
+		}
+
+		return exit(plg.Exec())
+	}
+}
+
+// exit makes subcommands exit with a non-zero status code and the message of the error, if any.
+func exit(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return cli.Exit(err, 1)
+}
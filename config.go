@@ -0,0 +1,303 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v2"
+)
+
+// defaultConfigFile is loaded if it exists and no other config file is given.
+const defaultConfigFile = ".drone-cache.yml"
+
+// configFile is a declarative alternative to flags and environment variables, in YAML or JSON.
+// Fields are tagged with the flag that they set, flags and environment variables override them.
+type configFile struct {
+	LogLevel  *string `yaml:"log_level" flag:"log.level"`
+	LogFormat *string `yaml:"log_format" flag:"log.format"`
+
+	Backend *string       `yaml:"backend" flag:"backend"`
+	Mounts  []mountConfig `yaml:"mounts"`
+	Exclude []string      `yaml:"exclude" flag:"exclude"`
+	Include []string      `yaml:"include" flag:"include"`
+
+	Rebuild  *bool          `yaml:"rebuild" flag:"rebuild"`
+	Restore  *bool          `yaml:"restore" flag:"restore"`
+	Flush    *bool          `yaml:"flush" flag:"flush"`
+	FlushTTL *time.Duration `yaml:"flush_ttl" flag:"flush-ttl"`
+	DryRun   *bool          `yaml:"dry_run" flag:"dry-run"`
+	Debug    *bool          `yaml:"debug" flag:"debug"`
+	ExitCode *bool          `yaml:"exit_code" flag:"exit-code"`
+
+	CacheKey      *string  `yaml:"cache_key" flag:"cache-key"`
+	RestoreKeys   []string `yaml:"restore_keys" flag:"restore-keys"`
+	HashAlgorithm *string  `yaml:"hash_algorithm" flag:"hash-algorithm"`
+	HashLongKeys  *bool    `yaml:"hash_long_keys" flag:"hash-long-keys"`
+	RemoteRoot    *string  `yaml:"remote_root" flag:"remote-root"`
+	LocalRoot     *string  `yaml:"local_root" flag:"local-root"`
+	Override      *bool    `yaml:"override" flag:"override"`
+	SkipUnchanged *bool    `yaml:"skip_unchanged" flag:"skip-unchanged"`
+	Fingerprint   *string  `yaml:"fingerprint" flag:"fingerprint"`
+	BranchScope   *bool    `yaml:"branch_scope" flag:"branch-scope"`
+
+	ArchiveFormat          *string  `yaml:"archive_format" flag:"archive-format"`
+	CompressionLevel       *int     `yaml:"compression_level" flag:"compression-level"`
+	CompressionConcurrency *int     `yaml:"compression_concurrency" flag:"compression-concurrency"`
+	ArchiveEncryptionKeys  []string `yaml:"archive_encryption_keys" flag:"archive-encryption-keys"`
+	SigningKey             *string  `yaml:"signing_key" flag:"signing-key"`
+	TrustedKeys            []string `yaml:"trusted_keys" flag:"trusted-keys"`
+	SkipSymlinks           *bool    `yaml:"skip_symlinks" flag:"skip-symlinks"`
+	PreserveTimes          *bool    `yaml:"preserve_times" flag:"preserve-times"`
+	PreserveOwner          *bool    `yaml:"preserve_owner" flag:"preserve-owner"`
+	PreserveXattrs         *bool    `yaml:"preserve_xattrs" flag:"preserve-xattrs"`
+	Reproducible           *bool    `yaml:"reproducible" flag:"reproducible"`
+	SourceDateEpoch        *int64   `yaml:"source_date_epoch" flag:"source-date-epoch"`
+
+	Chunked           *bool          `yaml:"chunked" flag:"chunked"`
+	ChunkSize         *int           `yaml:"chunk_size" flag:"chunk-size"`
+	ChunkCache        *string        `yaml:"chunk_cache" flag:"chunk-cache"`
+	UploadRateLimit   *int64         `yaml:"upload_rate_limit" flag:"upload-rate-limit"`
+	DownloadRateLimit *int64         `yaml:"download_rate_limit" flag:"download-rate-limit"`
+	RateLimit         *int64         `yaml:"rate_limit" flag:"rate-limit"`
+	MaxConcurrency    *int           `yaml:"max_concurrency" flag:"max-concurrency"`
+	ProgressInterval  *time.Duration `yaml:"progress_interval" flag:"progress-interval"`
+	OperationTimeout  *time.Duration `yaml:"operation_timeout" flag:"backend.operation-timeout"`
+	Report            *string        `yaml:"report" flag:"report"`
+
+	Metrics struct {
+		Textfile    *string `yaml:"textfile" flag:"metrics.textfile"`
+		Pushgateway *string `yaml:"pushgateway" flag:"metrics.pushgateway"`
+		Job         *string `yaml:"job" flag:"metrics.job"`
+	} `yaml:"metrics"`
+
+	FileSystem struct {
+		CacheRoot *string `yaml:"cache_root" flag:"filesystem.cache-root"`
+	} `yaml:"filesystem"`
+
+	S3 struct {
+		Endpoint   *string `yaml:"endpoint" flag:"endpoint"`
+		Bucket     *string `yaml:"bucket" flag:"bucket"`
+		Region     *string `yaml:"region" flag:"region"`
+		AccessKey  *string `yaml:"access_key" flag:"access-key"`
+		SecretKey  *string `yaml:"secret_key" flag:"secret-key"`
+		PathStyle  *bool   `yaml:"path_style" flag:"path-style"`
+		ACL        *string `yaml:"acl" flag:"acl"`
+		Encryption *string `yaml:"encryption" flag:"encryption"`
+	} `yaml:"s3"`
+
+	GCS struct {
+		Endpoint      *string `yaml:"endpoint" flag:"endpoint"`
+		Bucket        *string `yaml:"bucket" flag:"bucket"`
+		APIKey        *string `yaml:"api_key" flag:"gcs.api-key"`
+		JSONKey       *string `yaml:"json_key" flag:"gcs.json-key"`
+		EncryptionKey *string `yaml:"encryption_key" flag:"gcs.encryption-key"`
+	} `yaml:"gcs"`
+
+	Azure struct {
+		AccountName    *string `yaml:"account_name" flag:"azure.account-name"`
+		AccountKey     *string `yaml:"account_key" flag:"azure.account-key"`
+		Container      *string `yaml:"container" flag:"azure.blob-container-name"`
+		BlobStorageURL *string `yaml:"blob_storage_url" flag:"azure.blob-storage-url"`
+	} `yaml:"azure"`
+
+	SFTP struct {
+		CacheRoot     *string `yaml:"cache_root" flag:"sftp.cache-root"`
+		Username      *string `yaml:"username" flag:"sftp.username"`
+		Password      *string `yaml:"password" flag:"sftp.password"`
+		PublicKeyFile *string `yaml:"public_key_file" flag:"sftp.public-key-file"`
+		AuthMethod    *string `yaml:"auth_method" flag:"sftp.auth-method"`
+		Host          *string `yaml:"host" flag:"sftp.host"`
+		Port          *string `yaml:"port" flag:"sftp.port"`
+	} `yaml:"sftp"`
+
+	// Set from mounts.
+	Mount       []string `yaml:"-" flag:"mount"`
+	Incremental []string `yaml:"-" flag:"incremental"`
+}
+
+// mountConfig holds the settings of a single mount, it is either a path or a mapping.
+type mountConfig struct {
+	Path        string   `yaml:"path"`
+	Incremental bool     `yaml:"incremental"`
+	Exclude     []string `yaml:"exclude"`
+	Include     []string `yaml:"include"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler, so mounts without settings are given as plain paths.
+func (m *mountConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&m.Path); err == nil {
+		return nil
+	}
+
+	type plain mountConfig
+
+	return unmarshal((*plain)(m))
+}
+
+// loadConfigFile sets the flags that are not set by arguments or environment variables from the config file.
+// The default config file is optional, a given one must exist.
+func loadConfigFile(c *cli.Context) error {
+	p := c.String("config")
+	if p == "" {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) && !c.IsSet("config") {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("read config file <%s>, %w", p, err)
+	}
+
+	f, err := parseConfigFile(b)
+	if err != nil {
+		return fmt.Errorf("parse config file <%s>, %w", p, err)
+	}
+
+	if err := setFlags(c, "", reflect.ValueOf(f)); err != nil {
+		return fmt.Errorf("config file <%s>, %w", p, err)
+	}
+
+	return nil
+}
+
+// parseConfigFile parses the YAML or JSON config, as JSON is also valid YAML. Unknown fields are errors.
+func parseConfigFile(b []byte) (configFile, error) {
+	var f configFile
+	if err := yaml.UnmarshalStrict(b, &f); err != nil {
+		return f, err
+	}
+
+	// NOTICE: Backends share flags, e.g. endpoint and bucket of s3 and gcs, so only one of them can be configured.
+	var backends []string
+
+	for name, block := range map[string]interface{}{
+		"filesystem": f.FileSystem, "s3": f.S3, "gcs": f.GCS, "azure": f.Azure, "sftp": f.SFTP,
+	} {
+		if !reflect.ValueOf(block).IsZero() {
+			backends = append(backends, name)
+		}
+	}
+
+	if len(backends) > 1 {
+		sort.Strings(backends)
+		return f, fmt.Errorf("only one backend can be configured, got <%s>", strings.Join(backends, ", "))
+	}
+
+	for i, m := range f.Mounts {
+		if m.Path == "" {
+			return f, fmt.Errorf("mounts[%d], path is required", i)
+		}
+
+		f.Mount = append(f.Mount, m.Path)
+		if m.Incremental {
+			f.Incremental = append(f.Incremental, m.Path)
+		}
+
+		if len(m.Exclude) == 0 && len(m.Include) == 0 {
+			continue
+		}
+
+		if path.IsAbs(filepath.ToSlash(m.Path)) {
+			return f, fmt.Errorf("mounts[%d], exclude and include require a path relative to local root", i)
+		}
+
+		f.Exclude = append(f.Exclude, mountPatterns(m.Path, m.Exclude)...)
+		f.Include = append(f.Include, mountPatterns(m.Path, m.Include)...)
+	}
+
+	return f, nil
+}
+
+// mountPatterns scopes gitignore style patterns, given relative to the mount, to the mount's path under local root.
+func mountPatterns(mount string, patterns []string) []string {
+	mount = path.Clean(filepath.ToSlash(mount))
+	scoped := make([]string, 0, len(patterns))
+
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if p == "" || strings.HasPrefix(p, "#") {
+			continue
+		}
+
+		var negate string
+		if strings.HasPrefix(p, "!") {
+			negate, p = "!", p[1:]
+		}
+
+		// NOTICE: Like gitignore, patterns without a separator before the end match at any level of the mount.
+		switch {
+		case mount == ".":
+		case strings.Contains(strings.TrimSuffix(p, "/"), "/"):
+			p = mount + "/" + strings.TrimPrefix(p, "/")
+		default:
+			p = mount + "/**/" + p
+		}
+
+		scoped = append(scoped, negate+p)
+	}
+
+	return scoped
+}
+
+// setFlags sets the flags of the given struct's fields that are present, unless flags are already set.
+func setFlags(c *cli.Context, prefix string, v reflect.Value) error {
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		var (
+			field = t.Field(i)
+			value = v.Field(i)
+			key   = prefix + field.Tag.Get("yaml")
+		)
+
+		if field.Type.Kind() == reflect.Struct {
+			if err := setFlags(c, key+".", value); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		name, ok := field.Tag.Lookup("flag")
+		if !ok || c.IsSet(name) {
+			continue
+		}
+
+		var values []string
+
+		switch value.Kind() { //nolint:exhaustive
+		case reflect.Ptr:
+			if value.IsNil() {
+				continue
+			}
+
+			values = []string{fmt.Sprint(value.Elem().Interface())}
+		case reflect.Slice:
+			for j := 0; j < value.Len(); j++ {
+				values = append(values, fmt.Sprint(value.Index(j).Interface()))
+			}
+		default:
+			return errors.New("unsupported config field " + field.Name)
+		}
+
+		for _, val := range values {
+			if err := c.Set(name, val); err != nil {
+				return fmt.Errorf("%s, invalid value <%s>, %w", key, val, err)
+			}
+		}
+	}
+
+	return nil
+}
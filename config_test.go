@@ -0,0 +1,133 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/meltwater/drone-cache/test"
+
+	"github.com/urfave/cli/v2"
+)
+
+const testConfigFile = `
+backend: s3
+mounts:
+  - node_modules
+  - path: .cache
+    incremental: true
+  - path: build
+    exclude: ["*.log", "/tmp/", "!keep.log"]
+    include: [tmp/cache]
+rebuild: true
+flush_ttl: 24h
+cache_key: '{{ printf "%s,%s" .Repo.Name .Commit.Branch }}'
+restore_keys:
+  - '{{ .Commit.Branch }}'
+  - main
+s3:
+  bucket: from-file
+  region: eu-west-1
+`
+
+func TestLoadConfigFile(t *testing.T) {
+	// Setup
+	dir, dirClean := test.CreateTempDir(t, "config_file")
+	t.Cleanup(dirClean)
+
+	file := filepath.Join(dir, "drone-cache.yml")
+	test.Ok(t, ioutil.WriteFile(file, []byte(testConfigFile), 0644))
+
+	// Run
+	c, err := runWithConfigFile([]string{"--config", file, "--bucket", "from-flag"})
+	test.Ok(t, err)
+
+	// Test
+	test.Equals(t, "s3", c.String("backend"))
+	test.Equals(t, []string{"node_modules", ".cache", "build"}, c.StringSlice("mount"))
+	test.Equals(t, []string{"build/**/*.log", "build/tmp/", "!build/**/keep.log"}, c.StringSlice("exclude"))
+	test.Equals(t, []string{"build/tmp/cache"}, c.StringSlice("include"))
+	test.Equals(t, []string{".cache"}, c.StringSlice("incremental"))
+	test.Equals(t, true, c.Bool("rebuild"))
+	test.Equals(t, 24*time.Hour, c.Duration("flush-ttl"))
+	test.Equals(t, `{{ printf "%s,%s" .Repo.Name .Commit.Branch }}`, c.String("cache-key"))
+	test.Equals(t, []string{"{{ .Commit.Branch }}", "main"}, c.StringSlice("restore-keys"))
+	test.Equals(t, "eu-west-1", c.String("region"))
+	test.Equals(t, "from-flag", c.String("bucket"))
+}
+
+func TestLoadConfigFileJSON(t *testing.T) {
+	// Setup
+	dir, dirClean := test.CreateTempDir(t, "config_file_json")
+	t.Cleanup(dirClean)
+
+	file := filepath.Join(dir, "drone-cache.json")
+	test.Ok(t, ioutil.WriteFile(file, []byte(`{"backend": "filesystem", "mounts": [{"path": "vendor"}]}`), 0644))
+
+	// Run
+	c, err := runWithConfigFile([]string{"--config", file})
+	test.Ok(t, err)
+
+	// Test
+	test.Equals(t, "filesystem", c.String("backend"))
+	test.Equals(t, []string{"vendor"}, c.StringSlice("mount"))
+}
+
+func TestLoadConfigFileErrors(t *testing.T) {
+	// Setup
+	dir, dirClean := test.CreateTempDir(t, "config_file_errors")
+	t.Cleanup(dirClean)
+
+	for name, content := range map[string]string{
+		"unknown field":  "bakend: s3\n",
+		"invalid value":  "flush_ttl: weekly\n",
+		"mount path":     "mounts:\n  - incremental: true\n",
+		"mount exclude":  "mounts:\n  - path: /cache\n    exclude: [tmp]\n",
+		"many backends":  "s3:\n  bucket: cache\ngcs:\n  bucket: cache\n",
+		"unknown nested": "s3:\n  bucket_name: cache\n",
+	} {
+		file := filepath.Join(dir, "drone-cache.yml")
+		test.Ok(t, ioutil.WriteFile(file, []byte(content), 0644))
+
+		_, err := runWithConfigFile([]string{"--config", file})
+		test.Assert(t, err != nil, "%s: expected an error", name)
+	}
+
+	_, err := runWithConfigFile([]string{"--config", filepath.Join(dir, "missing.yml")})
+	test.NotOk(t, err)
+
+	_, err = runWithConfigFile(nil)
+	test.Ok(t, err)
+}
+
+// Helpers
+
+// runWithConfigFile runs an app with a subset of the flags and loads the config file, returning its context.
+func runWithConfigFile(args []string) (*cli.Context, error) {
+	var ctx *cli.Context
+
+	app := cli.NewApp()
+	app.Flags = []cli.Flag{
+		&cli.StringFlag{Name: "config", Value: filepath.Join("testdata", defaultConfigFile)},
+		&cli.StringFlag{Name: "backend", Value: "s3"},
+		&cli.StringSliceFlag{Name: "mount"},
+		&cli.StringSliceFlag{Name: "incremental"},
+		&cli.StringSliceFlag{Name: "exclude"},
+		&cli.StringSliceFlag{Name: "include"},
+		&cli.BoolFlag{Name: "rebuild"},
+		&cli.DurationFlag{Name: "flush-ttl"},
+		&cli.StringFlag{Name: "cache-key"},
+		&cli.StringSliceFlag{Name: "restore-keys"},
+		&cli.StringFlag{Name: "bucket"},
+		&cli.StringFlag{Name: "region"},
+	}
+	app.Action = func(c *cli.Context) error {
+		ctx = c
+		return loadConfigFile(c)
+	}
+
+	err := app.Run(append([]string{"drone-cache"}, args...))
+
+	return ctx, err
+}
@@ -0,0 +1,71 @@
+package metadata
+
+// Buildkite reads metadata from the environment of Buildkite builds.
+type Buildkite struct{}
+
+// Name implements Provider.
+func (Buildkite) Name() string { return "buildkite" }
+
+// Detect implements Provider.
+func (Buildkite) Detect(getenv Getenv) bool { return getenv("BUILDKITE") == "true" }
+
+// Metadata implements Provider.
+func (Buildkite) Metadata(getenv Getenv) (Metadata, error) {
+	remote := getenv("BUILDKITE_REPO")
+
+	owner, name, link := parseRemote(remote)
+	if name == "" {
+		owner, name = getenv("BUILDKITE_ORGANIZATION_SLUG"), getenv("BUILDKITE_PIPELINE_SLUG")
+	}
+
+	var (
+		event, ref               string
+		pull                     int
+		branch                   = getenv("BUILDKITE_BRANCH")
+		sourceBranch, baseBranch string
+	)
+
+	switch {
+	case getenv("BUILDKITE_TAG") != "":
+		event, ref = "tag", "refs/tags/"+getenv("BUILDKITE_TAG")
+	case getenv("BUILDKITE_PULL_REQUEST") != "" && getenv("BUILDKITE_PULL_REQUEST") != "false":
+		event, ref = "pull_request", "refs/pull/"+getenv("BUILDKITE_PULL_REQUEST")+"/head"
+		pull = atoi(getenv("BUILDKITE_PULL_REQUEST"))
+		// NOTICE: Pull requests are built for the base branch, as in Drone.
+		sourceBranch, baseBranch = branch, getenv("BUILDKITE_PULL_REQUEST_BASE_BRANCH")
+		branch = firstOf(baseBranch, branch)
+	case getenv("BUILDKITE_BRANCH") != "":
+		event, ref = getenv("BUILDKITE_SOURCE"), "refs/heads/"+getenv("BUILDKITE_BRANCH")
+	default:
+		event = getenv("BUILDKITE_SOURCE")
+	}
+
+	return Metadata{
+		Repo: Repo{
+			Branch:    getenv("BUILDKITE_PIPELINE_DEFAULT_BRANCH"),
+			Link:      link,
+			Name:      name,
+			Namespace: owner,
+			Owner:     owner,
+		},
+		Build: Build{
+			Event:  event,
+			Link:   getenv("BUILDKITE_BUILD_URL"),
+			Number: atoi(getenv("BUILDKITE_BUILD_NUMBER")),
+		},
+		Commit: Commit{
+			Author: Author{
+				Email: getenv("BUILDKITE_BUILD_AUTHOR_EMAIL"),
+				Name:  getenv("BUILDKITE_BUILD_AUTHOR"),
+			},
+			Branch:       branch,
+			Message:      getenv("BUILDKITE_MESSAGE"),
+			PullRequest:  pull,
+			Ref:          ref,
+			Remote:       withoutCredentials(remote),
+			Sha:          getenv("BUILDKITE_COMMIT"),
+			SourceBranch: sourceBranch,
+			TargetBranch: baseBranch,
+		},
+	}, nil
+}
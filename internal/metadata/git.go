@@ -0,0 +1,217 @@
+package metadata
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Git reads metadata from the git repository of the workspace, when the pipeline runs in no known CI system.
+// Only the repository, the branch and the commit are known, as commit objects are not read.
+type Git struct {
+	// Workspace is the directory to look up the repository from, its parents are looked up too.
+	Workspace string
+}
+
+// Name implements Provider.
+func (Git) Name() string { return "git" }
+
+// Detect implements Provider.
+func (g Git) Detect(Getenv) bool {
+	_, _, err := g.gitDir()
+	return err == nil
+}
+
+// Metadata implements Provider.
+func (g Git) Metadata(Getenv) (Metadata, error) {
+	root, dir, err := g.gitDir()
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	head, err := ioutil.ReadFile(filepath.Join(dir, "HEAD"))
+	if err != nil {
+		return Metadata{}, fmt.Errorf("read HEAD, %w", err)
+	}
+
+	var ref, sha string
+
+	if r := strings.TrimSpace(string(head)); strings.HasPrefix(r, "ref: ") {
+		ref = strings.TrimPrefix(r, "ref: ")
+
+		if sha, err = resolveRef(dir, ref); err != nil {
+			return Metadata{}, err
+		}
+	} else {
+		// Detached HEAD.
+		sha = r
+	}
+
+	remote, err := remoteURL(commonDir(dir), "origin")
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	owner, name, link := parseRemote(remote)
+	if name == "" {
+		name = filepath.Base(root)
+	}
+
+	var commitLink string
+	if link != "" && sha != "" {
+		commitLink = link + "/commit/" + sha
+	}
+
+	return Metadata{
+		Repo: Repo{
+			Link:      link,
+			Name:      name,
+			Namespace: owner,
+			Owner:     owner,
+		},
+		Commit: Commit{
+			Branch: branchOf(ref),
+			Link:   commitLink,
+			Ref:    ref,
+			Remote: withoutCredentials(remote),
+			Sha:    sha,
+		},
+	}, nil
+}
+
+// gitDir looks up the git directory of the workspace, or of its closest parent that has one.
+// Returns the root of the working tree and the git directory.
+func (g Git) gitDir() (string, string, error) {
+	dir, err := filepath.Abs(g.Workspace)
+	if err != nil {
+		return "", "", fmt.Errorf("workspace, %w", err)
+	}
+
+	for {
+		p := filepath.Join(dir, ".git")
+
+		fi, err := os.Stat(p)
+		if err == nil && fi.IsDir() {
+			return dir, p, nil
+		}
+
+		// NOTICE: Worktrees and submodules have a file that points to the git directory.
+		if err == nil {
+			gitDir, err := readGitFile(p)
+			return dir, gitDir, err
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", "", fmt.Errorf("no git repository in <%s> or its parents, %w", g.Workspace, ErrNotDetected)
+		}
+
+		dir = parent
+	}
+}
+
+// readGitFile reads the git directory from a .git file, such as "gitdir: ../.git/modules/sub".
+func readGitFile(p string) (string, error) {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return "", fmt.Errorf("read <%s>, %w", p, err)
+	}
+
+	dir := strings.TrimSpace(strings.TrimPrefix(string(b), "gitdir:"))
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(filepath.Dir(p), dir)
+	}
+
+	return dir, nil
+}
+
+// commonDir returns the git directory that has the refs and the config, it differs from the given one for worktrees.
+func commonDir(dir string) string {
+	b, err := ioutil.ReadFile(filepath.Join(dir, "commondir"))
+	if err != nil {
+		return dir
+	}
+
+	common := strings.TrimSpace(string(b))
+	if !filepath.IsAbs(common) {
+		common = filepath.Join(dir, common)
+	}
+
+	return common
+}
+
+// resolveRef returns the commit of the given ref, from its loose ref file or the packed refs.
+// An unborn branch has no commit.
+func resolveRef(dir, ref string) (string, error) {
+	dir = commonDir(dir)
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(ref)))
+	if err == nil {
+		return strings.TrimSpace(string(b)), nil
+	}
+
+	if !os.IsNotExist(err) {
+		return "", fmt.Errorf("read ref <%s>, %w", ref, err)
+	}
+
+	packed, err := ioutil.ReadFile(filepath.Join(dir, "packed-refs"))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("read packed refs, %w", err)
+	}
+
+	s := bufio.NewScanner(bytes.NewReader(packed))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 2 && fields[1] == ref { //nolint:gomnd
+			return fields[0], nil
+		}
+	}
+
+	return "", s.Err()
+}
+
+// remoteURL returns the URL of the given remote from the git config, empty if there is no such remote.
+func remoteURL(dir, remote string) (string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, "config"))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("read git config, %w", err)
+	}
+
+	var (
+		section = fmt.Sprintf(`[remote "%s"]`, remote)
+		in      bool
+		s       = bufio.NewScanner(bytes.NewReader(b))
+	)
+
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+
+		if strings.HasPrefix(line, "[") {
+			in = line == section
+			continue
+		}
+
+		if !in {
+			continue
+		}
+
+		if kv := strings.SplitN(line, "=", 2); len(kv) == 2 && strings.TrimSpace(kv[0]) == "url" { //nolint:gomnd
+			return strings.TrimSpace(kv[1]), nil
+		}
+	}
+
+	return "", s.Err()
+}
@@ -0,0 +1,83 @@
+package metadata
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/meltwater/drone-cache/test"
+)
+
+func TestGit(t *testing.T) {
+	t.Parallel()
+
+	// Setup
+	dir, dirClean := test.CreateTempDir(t, "git_metadata")
+	t.Cleanup(dirClean)
+
+	gitDir := filepath.Join(dir, ".git")
+	test.Ok(t, os.MkdirAll(filepath.Join(gitDir, "refs", "heads"), 0755))
+	test.Ok(t, os.MkdirAll(filepath.Join(dir, "sub", "dir"), 0755))
+
+	writeFile(t, filepath.Join(gitDir, "HEAD"), "ref: refs/heads/feature/cache\n")
+	writeFile(t, filepath.Join(gitDir, "packed-refs"), "# pack-refs with: peeled fully-peeled sorted\nabc123 refs/heads/feature/cache\n")
+	writeFile(t, filepath.Join(gitDir, "config"), `[core]
+	bare = false
+[remote "upstream"]
+	url = https://github.com/upstream/hello-world.git
+[remote "origin"]
+	url = git@github.com:octocat/hello-world.git
+	fetch = +refs/heads/*:refs/remotes/origin/*
+`)
+
+	g := Git{Workspace: filepath.Join(dir, "sub", "dir")}
+
+	// Run
+	test.Assert(t, g.Detect(getenv(nil)), "git repository of a parent is not detected")
+
+	m, err := g.Metadata(getenv(nil))
+	test.Ok(t, err)
+
+	// Test
+	test.Equals(t, "octocat", m.Repo.Owner)
+	test.Equals(t, "hello-world", m.Repo.Name)
+	test.Equals(t, "feature/cache", m.Commit.Branch)
+	test.Equals(t, "abc123", m.Commit.Sha)
+	test.Equals(t, "https://github.com/octocat/hello-world/commit/abc123", m.Commit.Link)
+
+	writeFile(t, filepath.Join(gitDir, "refs", "heads", "feature", "cache"), "def456\n")
+	m, err = g.Metadata(getenv(nil))
+	test.Ok(t, err)
+	test.Equals(t, "def456", m.Commit.Sha, "loose ref is not preferred over packed refs")
+
+	writeFile(t, filepath.Join(gitDir, "HEAD"), "fed789\n")
+	m, err = g.Metadata(getenv(nil))
+	test.Ok(t, err)
+	test.Equals(t, "fed789", m.Commit.Sha)
+	test.Equals(t, "", m.Commit.Branch, "detached HEAD has a branch")
+}
+
+func TestGitNotDetected(t *testing.T) {
+	t.Parallel()
+
+	dir, dirClean := test.CreateTempDir(t, "git_not_detected")
+	t.Cleanup(dirClean)
+
+	// NOTICE: Temporary directories may be in a git repository, such as testdata of this one.
+	if (Git{Workspace: filepath.Dir(dir)}).Detect(getenv(nil)) {
+		t.Skip("temporary directory is in a git repository")
+	}
+
+	_, _, err := FromEnvironment("", getenv(nil), dir)
+	test.Expected(t, err, ErrNotDetected)
+}
+
+// Helpers
+
+func writeFile(t *testing.T, p, content string) {
+	t.Helper()
+
+	test.Ok(t, os.MkdirAll(filepath.Dir(p), 0755))
+	test.Ok(t, ioutil.WriteFile(p, []byte(content), 0644))
+}
@@ -0,0 +1,111 @@
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// GitHubActions reads metadata from the environment of GitHub Actions workflows,
+// and the event payload for what is not in the environment.
+type GitHubActions struct{}
+
+// githubEvent holds the fields of the event payload that are used.
+type githubEvent struct {
+	Repository struct {
+		DefaultBranch string `json:"default_branch"`
+		Private       bool   `json:"private"`
+		Owner         struct {
+			AvatarURL string `json:"avatar_url"`
+		} `json:"owner"`
+	} `json:"repository"`
+	HeadCommit struct {
+		Message string `json:"message"`
+		Author  struct {
+			Name  string `json:"name"`
+			Email string `json:"email"`
+		} `json:"author"`
+	} `json:"head_commit"`
+}
+
+// Name implements Provider.
+func (GitHubActions) Name() string { return "github-actions" }
+
+// Detect implements Provider.
+func (GitHubActions) Detect(getenv Getenv) bool { return getenv("GITHUB_ACTIONS") == "true" }
+
+// Metadata implements Provider.
+func (GitHubActions) Metadata(getenv Getenv) (Metadata, error) {
+	var (
+		fullName    = getenv("GITHUB_REPOSITORY")
+		owner, name = splitFullName(fullName)
+		server      = firstOf(getenv("GITHUB_SERVER_URL"), "https://github.com")
+		repoLink    = strings.TrimSuffix(server, "/") + "/" + fullName
+		sha         = getenv("GITHUB_SHA")
+		ref         = getenv("GITHUB_REF")
+	)
+
+	event, err := readGitHubEvent(getenv("GITHUB_EVENT_PATH"))
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	return Metadata{
+		Repo: Repo{
+			Avatar:    event.Repository.Owner.AvatarURL,
+			Branch:    event.Repository.DefaultBranch,
+			Link:      repoLink,
+			Name:      name,
+			Namespace: owner,
+			Owner:     owner,
+			Private:   event.Repository.Private,
+		},
+		Build: Build{
+			Event:  getenv("GITHUB_EVENT_NAME"),
+			Link:   fmt.Sprintf("%s/actions/runs/%s", repoLink, getenv("GITHUB_RUN_ID")),
+			Number: atoi(getenv("GITHUB_RUN_NUMBER")),
+		},
+		Commit: Commit{
+			Author: Author{
+				Name:  firstOf(event.HeadCommit.Author.Name, getenv("GITHUB_ACTOR")),
+				Email: event.HeadCommit.Author.Email,
+			},
+			// NOTICE: Pull requests are built on a merge ref, the branch is the target branch as in Drone.
+			Branch:       firstOf(getenv("GITHUB_BASE_REF"), branchOf(ref)),
+			Link:         repoLink + "/commit/" + sha,
+			Message:      event.HeadCommit.Message,
+			PullRequest:  pullRequestOf(ref),
+			Ref:          ref,
+			Remote:       repoLink + ".git",
+			Sha:          sha,
+			SourceBranch: getenv("GITHUB_HEAD_REF"),
+			TargetBranch: getenv("GITHUB_BASE_REF"),
+		},
+	}, nil
+}
+
+// readGitHubEvent reads the event payload at the given path, an empty event if there is none.
+func readGitHubEvent(p string) (githubEvent, error) {
+	var e githubEvent
+
+	if p == "" {
+		return e, nil
+	}
+
+	b, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		return e, nil
+	}
+
+	if err != nil {
+		return e, fmt.Errorf("read event payload, %w", err)
+	}
+
+	if err := json.Unmarshal(b, &e); err != nil {
+		return e, fmt.Errorf("parse event payload <%s>, %w", p, err)
+	}
+
+	return e, nil
+}
@@ -0,0 +1,75 @@
+package metadata
+
+// GitLab reads metadata from the predefined variables of GitLab CI/CD pipelines.
+type GitLab struct{}
+
+// Name implements Provider.
+func (GitLab) Name() string { return "gitlab" }
+
+// Detect implements Provider.
+func (GitLab) Detect(getenv Getenv) bool { return getenv("GITLAB_CI") == "true" }
+
+// Metadata implements Provider.
+func (GitLab) Metadata(getenv Getenv) (Metadata, error) {
+	var (
+		projectLink = getenv("CI_PROJECT_URL")
+		sha         = getenv("CI_COMMIT_SHA")
+		ref         string
+	)
+
+	switch {
+	case getenv("CI_COMMIT_TAG") != "":
+		ref = "refs/tags/" + getenv("CI_COMMIT_TAG")
+	case getenv("CI_MERGE_REQUEST_IID") != "":
+		ref = "refs/merge-requests/" + getenv("CI_MERGE_REQUEST_IID") + "/head"
+	case getenv("CI_COMMIT_BRANCH") != "":
+		ref = "refs/heads/" + getenv("CI_COMMIT_BRANCH")
+	}
+
+	var commitLink string
+	if projectLink != "" && sha != "" {
+		commitLink = projectLink + "/-/commit/" + sha
+	}
+
+	return Metadata{
+		Repo: Repo{
+			Branch:    getenv("CI_DEFAULT_BRANCH"),
+			Link:      projectLink,
+			Name:      getenv("CI_PROJECT_NAME"),
+			Namespace: getenv("CI_PROJECT_NAMESPACE"),
+			Owner:     getenv("CI_PROJECT_NAMESPACE"),
+			Private:   getenv("CI_PROJECT_VISIBILITY") == "private",
+		},
+		Build: Build{
+			Created: unix(getenv("CI_PIPELINE_CREATED_AT")),
+			Deploy:  getenv("CI_ENVIRONMENT_NAME"),
+			Event:   getenv("CI_PIPELINE_SOURCE"),
+			Link:    getenv("CI_PIPELINE_URL"),
+			Number:  atoi(getenv("CI_PIPELINE_IID")),
+			Started: unix(getenv("CI_JOB_STARTED_AT")),
+		},
+		Commit: Commit{
+			Author: parseAuthor(getenv("CI_COMMIT_AUTHOR")),
+			// NOTICE: Merge request pipelines have no commit branch, the branch is the target branch as in Drone.
+			Branch:       firstOf(getenv("CI_MERGE_REQUEST_TARGET_BRANCH_NAME"), getenv("CI_COMMIT_BRANCH"), getenv("CI_COMMIT_REF_NAME")),
+			Link:         commitLink,
+			Message:      getenv("CI_COMMIT_MESSAGE"),
+			PullRequest:  atoi(getenv("CI_MERGE_REQUEST_IID")),
+			Ref:          ref,
+			SourceBranch: getenv("CI_MERGE_REQUEST_SOURCE_BRANCH_NAME"),
+			TargetBranch: getenv("CI_MERGE_REQUEST_TARGET_BRANCH_NAME"),
+			// NOTICE: CI_REPOSITORY_URL has the job token in it, so the remote is derived from the project URL.
+			Remote: remoteOf(projectLink),
+			Sha:    sha,
+		},
+	}, nil
+}
+
+// remoteOf returns the git remote of the given repository link.
+func remoteOf(link string) string {
+	if link == "" {
+		return ""
+	}
+
+	return link + ".git"
+}
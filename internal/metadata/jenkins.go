@@ -0,0 +1,58 @@
+package metadata
+
+import "strings"
+
+// Jenkins reads metadata from the environment of Jenkins builds, as set by Jenkins and its Git plugin.
+type Jenkins struct{}
+
+// Name implements Provider.
+func (Jenkins) Name() string { return "jenkins" }
+
+// Detect implements Provider.
+func (Jenkins) Detect(getenv Getenv) bool { return getenv("JENKINS_URL") != "" }
+
+// Metadata implements Provider.
+func (Jenkins) Metadata(getenv Getenv) (Metadata, error) {
+	// NOTICE: Jenkins has no notion of repositories, they are derived from the remote, or the job otherwise.
+	remote := getenv("GIT_URL")
+
+	owner, name, link := parseRemote(remote)
+	if name == "" {
+		owner, name = splitFullName(getenv("JOB_NAME"))
+	}
+
+	event := "push"
+	if getenv("CHANGE_ID") != "" {
+		event = "pull_request"
+	} else if getenv("TAG_NAME") != "" {
+		event = "tag"
+	}
+
+	return Metadata{
+		Repo: Repo{
+			Link:      link,
+			Name:      name,
+			Namespace: owner,
+			Owner:     owner,
+		},
+		Build: Build{
+			Event:  event,
+			Link:   getenv("BUILD_URL"),
+			Number: atoi(getenv("BUILD_NUMBER")),
+		},
+		Commit: Commit{
+			Author: Author{
+				Email: firstOf(getenv("CHANGE_AUTHOR_EMAIL"), getenv("GIT_AUTHOR_EMAIL"), getenv("GIT_COMMITTER_EMAIL")),
+				Name:  firstOf(getenv("CHANGE_AUTHOR"), getenv("GIT_AUTHOR_NAME"), getenv("GIT_COMMITTER_NAME")),
+			},
+			// NOTICE: The Git plugin reports branches with the name of the remote, such as origin/main.
+			// Change requests are built for the target branch, as in Drone.
+			Branch:       firstOf(getenv("CHANGE_TARGET"), getenv("BRANCH_NAME"), strings.TrimPrefix(getenv("GIT_BRANCH"), "origin/")),
+			PullRequest:  atoi(getenv("CHANGE_ID")),
+			Remote:       withoutCredentials(remote),
+			Sha:          getenv("GIT_COMMIT"),
+			SourceBranch: getenv("CHANGE_BRANCH"),
+			TargetBranch: getenv("CHANGE_TARGET"),
+		},
+	}, nil
+}
@@ -27,13 +27,16 @@ type (
 
 	// Commit stores information about current commit.
 	Commit struct {
-		Author  Author
-		Branch  string
-		Link    string
-		Message string
-		Ref     string
-		Remote  string
-		Sha     string
+		Author       Author
+		Branch       string // target branch of pull requests
+		Link         string
+		Message      string
+		PullRequest  int
+		Ref          string
+		Remote       string
+		Sha          string
+		SourceBranch string
+		TargetBranch string
 	}
 
 	// Author stores information about current commit's author.
@@ -0,0 +1,207 @@
+package metadata
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotDetected is returned when the pipeline runs in none of the supported CI systems.
+var ErrNotDetected = errors.New("no CI system detected")
+
+// Getenv looks up environment variables, like os.Getenv.
+type Getenv func(key string) string
+
+// Provider reads metadata of the pipeline run from the environment of a CI system.
+type Provider interface {
+	// Name is the name of the CI system, that it is selected by.
+	Name() string
+
+	// Detect reports whether the pipeline runs in the CI system.
+	Detect(getenv Getenv) bool
+
+	// Metadata reads metadata of the pipeline run.
+	Metadata(getenv Getenv) (Metadata, error)
+}
+
+// Providers returns the providers of the supported CI systems in the order they are detected,
+// git metadata of the workspace is the last resort.
+func Providers(workspace string) []Provider {
+	return []Provider{
+		GitHubActions{},
+		GitLab{},
+		Woodpecker{},
+		Jenkins{},
+		Buildkite{},
+		Git{Workspace: workspace},
+	}
+}
+
+// FromEnvironment reads metadata with the provider of the given name, or the first detected provider if name is empty.
+// Returns the metadata and the name of the provider.
+func FromEnvironment(name string, getenv Getenv, workspace string) (Metadata, string, error) {
+	for _, p := range Providers(workspace) {
+		if name != "" && p.Name() != name {
+			continue
+		}
+
+		if name == "" && !p.Detect(getenv) {
+			continue
+		}
+
+		m, err := p.Metadata(getenv)
+		if err != nil {
+			return Metadata{}, p.Name(), fmt.Errorf("%s metadata, %w", p.Name(), err)
+		}
+
+		return m, p.Name(), nil
+	}
+
+	if name != "" {
+		return Metadata{}, "", fmt.Errorf("unknown CI system <%s>", name)
+	}
+
+	return Metadata{}, "", ErrNotDetected
+}
+
+// Merge returns the metadata with its empty fields filled from the other metadata.
+func Merge(m, other Metadata) Metadata {
+	merge(reflect.ValueOf(&m).Elem(), reflect.ValueOf(other))
+	return m
+}
+
+func merge(dst, src reflect.Value) {
+	for i := 0; i < dst.NumField(); i++ {
+		d, s := dst.Field(i), src.Field(i)
+
+		if d.Kind() == reflect.Struct {
+			merge(d, s)
+			continue
+		}
+
+		if d.IsZero() {
+			d.Set(s)
+		}
+	}
+}
+
+// Helpers
+
+// parseRemote parses owner and name of the repository and a link to it from a git remote URL,
+// such as https://github.com/octocat/hello-world.git or git@gitlab.com:group/subgroup/project.git.
+// Credentials of the URL are never part of the link.
+func parseRemote(remote string) (owner, name, link string) {
+	remote = strings.TrimSpace(remote)
+	if remote == "" {
+		return "", "", ""
+	}
+
+	var host, p string
+
+	if u, err := url.Parse(remote); err == nil && u.Host != "" {
+		host, p = u.Hostname(), u.Path
+	} else if i := strings.Index(remote, ":"); i > 0 && !strings.Contains(remote[:i], "/") {
+		// scp-like syntax, user@host:path.
+		host, p = remote[strings.LastIndex(remote[:i], "@")+1:i], remote[i+1:]
+	} else {
+		p = remote
+	}
+
+	p = strings.TrimSuffix(strings.Trim(p, "/"), ".git")
+	if i := strings.LastIndex(p, "/"); i >= 0 {
+		owner, name = p[:i], p[i+1:]
+	} else {
+		name = p
+	}
+
+	if host != "" && owner != "" {
+		link = "https://" + host + "/" + p
+	}
+
+	return owner, name, link
+}
+
+// withoutCredentials removes the user info of the given remote URL, that may have tokens in it.
+func withoutCredentials(remote string) string {
+	u, err := url.Parse(remote)
+	if err != nil || u.User == nil || u.Host == "" {
+		return remote
+	}
+
+	u.User = nil
+
+	return u.String()
+}
+
+// splitFullName splits a full repository name, such as octocat/hello-world, into owner and name.
+func splitFullName(fullName string) (owner, name string) {
+	if i := strings.LastIndex(fullName, "/"); i >= 0 {
+		return fullName[:i], fullName[i+1:]
+	}
+
+	return "", fullName
+}
+
+// branchOf returns the branch of the given ref, empty if it is not a branch.
+func branchOf(ref string) string {
+	if strings.HasPrefix(ref, "refs/heads/") {
+		return strings.TrimPrefix(ref, "refs/heads/")
+	}
+
+	return ""
+}
+
+// pullRequestOf returns the number of the pull request of the given ref, such as refs/pull/1/merge,
+// zero if it is not a pull request.
+func pullRequestOf(ref string) int {
+	if !strings.HasPrefix(ref, "refs/pull/") {
+		return 0
+	}
+
+	return atoi(strings.SplitN(strings.TrimPrefix(ref, "refs/pull/"), "/", 2)[0]) //nolint:gomnd
+}
+
+// atoi parses the given number, zero if it is not a number.
+func atoi(s string) int {
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return 0
+	}
+
+	return i
+}
+
+// unix parses the given RFC 3339 time as seconds since the epoch, zero if it is not a time.
+func unix(s string) int64 {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return 0
+	}
+
+	return t.Unix()
+}
+
+// parseAuthor splits an author of the form "Name <email>".
+func parseAuthor(s string) Author {
+	i, j := strings.LastIndex(s, "<"), strings.LastIndex(s, ">")
+	if i < 0 || j < i {
+		return Author{Name: strings.TrimSpace(s)}
+	}
+
+	return Author{Name: strings.TrimSpace(s[:i]), Email: s[i+1 : j]}
+}
+
+// firstOf returns the first of the given values that is not empty.
+func firstOf(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
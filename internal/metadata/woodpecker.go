@@ -0,0 +1,57 @@
+package metadata
+
+// Woodpecker reads metadata from the environment of Woodpecker CI pipelines.
+type Woodpecker struct{}
+
+// Name implements Provider.
+func (Woodpecker) Name() string { return "woodpecker" }
+
+// Detect implements Provider.
+func (Woodpecker) Detect(getenv Getenv) bool { return getenv("CI") == "woodpecker" }
+
+// Metadata implements Provider.
+func (Woodpecker) Metadata(getenv Getenv) (Metadata, error) {
+	owner, name := getenv("CI_REPO_OWNER"), getenv("CI_REPO_NAME")
+	if owner == "" && name == "" {
+		owner, name = splitFullName(getenv("CI_REPO"))
+	}
+
+	return Metadata{
+		Repo: Repo{
+			Branch:    getenv("CI_REPO_DEFAULT_BRANCH"),
+			Link:      firstOf(getenv("CI_REPO_URL"), getenv("CI_REPO_LINK")),
+			Name:      name,
+			Namespace: owner,
+			Owner:     owner,
+			Private:   getenv("CI_REPO_PRIVATE") == "true",
+			Trusted:   getenv("CI_REPO_TRUSTED") == "true",
+		},
+		Build: Build{
+			Created:  int64(atoi(getenv("CI_PIPELINE_CREATED"))),
+			Deploy:   getenv("CI_PIPELINE_DEPLOY_TARGET"),
+			Event:    getenv("CI_PIPELINE_EVENT"),
+			Finished: int64(atoi(getenv("CI_PIPELINE_FINISHED"))),
+			Link:     firstOf(getenv("CI_PIPELINE_URL"), getenv("CI_PIPELINE_LINK")),
+			Number:   atoi(getenv("CI_PIPELINE_NUMBER")),
+			Started:  int64(atoi(getenv("CI_PIPELINE_STARTED"))),
+			Status:   getenv("CI_PIPELINE_STATUS"),
+		},
+		Commit: Commit{
+			Author: Author{
+				Avatar: getenv("CI_COMMIT_AUTHOR_AVATAR"),
+				Email:  getenv("CI_COMMIT_AUTHOR_EMAIL"),
+				Name:   getenv("CI_COMMIT_AUTHOR"),
+			},
+			// NOTICE: Pull request pipelines are built on the target branch, as in Drone.
+			Branch:       firstOf(getenv("CI_COMMIT_TARGET_BRANCH"), getenv("CI_COMMIT_BRANCH")),
+			Link:         firstOf(getenv("CI_COMMIT_URL"), getenv("CI_COMMIT_LINK")),
+			Message:      getenv("CI_COMMIT_MESSAGE"),
+			PullRequest:  atoi(getenv("CI_COMMIT_PULL_REQUEST")),
+			Ref:          getenv("CI_COMMIT_REF"),
+			Remote:       getenv("CI_REPO_CLONE_URL"),
+			Sha:          getenv("CI_COMMIT_SHA"),
+			SourceBranch: getenv("CI_COMMIT_SOURCE_BRANCH"),
+			TargetBranch: getenv("CI_COMMIT_TARGET_BRANCH"),
+		},
+	}, nil
+}
@@ -0,0 +1,170 @@
+// Package metrics records results of cache operations as Prometheus metrics,
+// and exports them to a node exporter textfile or a Pushgateway at the end of the run.
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/meltwater/drone-cache/cache"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+const (
+	namespace = "drone_cache"
+
+	// DefaultJob is the job name that metrics are pushed with.
+	DefaultJob = "drone_cache"
+)
+
+// Metrics records results of cache operations for a single repository, it is safe for concurrent use.
+type Metrics struct {
+	// NOTICE: Pushgateway adds the repository label from the grouping key, textfile collector needs it on metrics.
+	reg     *prometheus.Registry
+	labeled *prometheus.Registry
+
+	repo    string
+	backend string
+
+	hits        *prometheus.GaugeVec
+	size        *prometheus.GaugeVec
+	transferred *prometheus.GaugeVec
+	ratio       *prometheus.GaugeVec
+	duration    *prometheus.GaugeVec
+	archive     *prometheus.GaugeVec
+	transfer    *prometheus.GaugeVec
+	errors      *prometheus.CounterVec
+	lastRun     prometheus.Gauge
+}
+
+// New creates metrics labeled by the given repository and storage backend.
+func New(repo, backend string) *Metrics {
+	m := &Metrics{
+		reg:     prometheus.NewRegistry(),
+		labeled: prometheus.NewRegistry(),
+		repo:    repo,
+		backend: backend,
+
+		hits: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "hit",
+			Help:      "Whether a cache is found for the mount on restore, 1 for hit and 0 for miss.",
+		}, []string{"mount"}),
+		size: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "archived_bytes",
+			Help:      "Size of the mount in bytes, before archiving or after extracting.",
+		}, []string{"mount", "operation"}),
+		transferred: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "transferred_bytes",
+			Help:      "Bytes uploaded to or downloaded from storage for the mount.",
+		}, []string{"mount", "operation"}),
+		ratio: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "compression_ratio",
+			Help:      "Ratio of transferred bytes to archived bytes of the mount.",
+		}, []string{"mount", "operation"}),
+		duration: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "duration_seconds",
+			Help:      "Duration of rebuilding or restoring the mount in seconds.",
+		}, []string{"mount", "operation"}),
+		archive: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "archive_duration_seconds",
+			Help:      "Duration of archiving or extracting the mount in seconds, it overlaps with the transfer.",
+		}, []string{"mount", "operation"}),
+		transfer: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "transfer_duration_seconds",
+			Help:      "Duration of uploading or downloading the mount in seconds.",
+		}, []string{"mount", "operation"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "errors_total",
+			Help:      "Number of mounts that failed to rebuild or restore.",
+		}, []string{"mount", "operation", "backend"}),
+		lastRun: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "last_run_timestamp_seconds",
+			Help:      "Unix timestamp of the last recorded result.",
+		}),
+	}
+
+	cs := []prometheus.Collector{
+		m.hits, m.size, m.transferred, m.ratio, m.duration, m.archive, m.transfer, m.errors, m.lastRun,
+	}
+	m.reg.MustRegister(cs...)
+	prometheus.WrapRegistererWith(prometheus.Labels{"repo": repo}, m.labeled).MustRegister(cs...)
+
+	return m
+}
+
+// Record records the result of a rebuilt or restored mount.
+func (m *Metrics) Record(res cache.Result) {
+	m.lastRun.SetToCurrentTime()
+
+	if res.Operation == cache.OperationRestore {
+		m.hits.WithLabelValues(res.Mount).Set(boolToFloat(res.Hit))
+	}
+
+	if res.Err != nil {
+		m.errors.WithLabelValues(res.Mount, res.Operation, m.backend).Inc()
+		return
+	}
+
+	if res.Skipped || (res.Operation == cache.OperationRestore && !res.Hit) {
+		return
+	}
+
+	m.size.WithLabelValues(res.Mount, res.Operation).Set(float64(res.Size))
+	m.transferred.WithLabelValues(res.Mount, res.Operation).Set(float64(res.Transferred))
+	m.duration.WithLabelValues(res.Mount, res.Operation).Set(res.Duration.Seconds())
+	m.transfer.WithLabelValues(res.Mount, res.Operation).Set(res.TransferDuration.Seconds())
+
+	// NOTICE: Incremental mounts are transferred file by file, without an archive.
+	if res.ArchiveDuration > 0 {
+		m.archive.WithLabelValues(res.Mount, res.Operation).Set(res.ArchiveDuration.Seconds())
+	}
+
+	if res.Size > 0 {
+		m.ratio.WithLabelValues(res.Mount, res.Operation).Set(float64(res.Transferred) / float64(res.Size))
+	}
+}
+
+// WriteTextfile writes the metrics to the given file in the format of the node exporter textfile collector.
+func (m *Metrics) WriteTextfile(path string) error {
+	if err := prometheus.WriteToTextfile(path, m.labeled); err != nil {
+		return fmt.Errorf("write metrics to textfile <%s>, %w", path, err)
+	}
+
+	return nil
+}
+
+// Push pushes the metrics to the Pushgateway at the given URL, grouped by job and repository.
+func (m *Metrics) Push(url, job string, timeout time.Duration) error {
+	p := push.New(url, job).
+		Gatherer(m.reg).
+		Grouping("repo", m.repo).
+		Client(&http.Client{Timeout: timeout})
+
+	if err := p.Push(); err != nil {
+		return fmt.Errorf("push metrics to <%s>, %w", url, err)
+	}
+
+	return nil
+}
+
+// Helpers
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meltwater/drone-cache/cache"
+	"github.com/meltwater/drone-cache/test"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+func TestWriteTextfile(t *testing.T) {
+	t.Parallel()
+
+	dir, dirClean := test.CreateTempDir(t, "metrics_textfile")
+	t.Cleanup(dirClean)
+
+	m := record(New("meltwater/drone-cache", "s3"))
+	file := filepath.Join(dir, "drone_cache.prom")
+
+	test.Ok(t, m.WriteTextfile(file))
+
+	b, err := ioutil.ReadFile(file)
+	test.Ok(t, err)
+
+	for _, s := range []string{
+		`drone_cache_hit{mount="node_modules",repo="meltwater/drone-cache"} 1`,
+		`drone_cache_hit{mount="vendor",repo="meltwater/drone-cache"} 0`,
+		`drone_cache_archived_bytes{mount="node_modules",operation="restore",repo="meltwater/drone-cache"} 1000`,
+		`drone_cache_transferred_bytes{mount="node_modules",operation="restore",repo="meltwater/drone-cache"} 250`,
+		`drone_cache_compression_ratio{mount="node_modules",operation="restore",repo="meltwater/drone-cache"} 0.25`,
+		`drone_cache_duration_seconds{mount="node_modules",operation="restore",repo="meltwater/drone-cache"} 2`,
+		`drone_cache_archive_duration_seconds{mount="node_modules",operation="restore",repo="meltwater/drone-cache"} 1.5`,
+		`drone_cache_transfer_duration_seconds{mount="node_modules",operation="restore",repo="meltwater/drone-cache"} 1`,
+		`drone_cache_errors_total{backend="s3",mount="build",operation="restore",repo="meltwater/drone-cache"} 1`,
+	} {
+		test.Assert(t, strings.Contains(string(b), s), "textfile does not contain <%s>", s)
+	}
+}
+
+func TestPush(t *testing.T) {
+	t.Parallel()
+
+	var (
+		method, path string
+		families     = map[string]*dto.MetricFamily{}
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+
+		dec := expfmt.NewDecoder(r.Body, expfmt.ResponseFormat(r.Header))
+
+		for {
+			mf := &dto.MetricFamily{}
+			if err := dec.Decode(mf); err != nil {
+				break
+			}
+
+			families[mf.GetName()] = mf
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(srv.Close)
+
+	m := record(New("drone-cache", "s3"))
+
+	test.Ok(t, m.Push(srv.URL, DefaultJob, time.Second))
+	test.Equals(t, http.MethodPut, method)
+	test.Equals(t, "/metrics/job/drone_cache/repo/drone-cache", path)
+
+	hits, ok := families["drone_cache_hit"]
+	test.Assert(t, ok, "hit metric is not pushed")
+	test.Equals(t, 3, len(hits.GetMetric()))
+
+	for _, m := range hits.GetMetric() {
+		for _, l := range m.GetLabel() {
+			test.Assert(t, l.GetName() != "repo", "pushed metric contains grouping label")
+		}
+	}
+}
+
+func TestPushError(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(srv.Close)
+
+	test.NotOk(t, New("drone-cache", "s3").Push(srv.URL, DefaultJob, time.Second))
+}
+
+// Helpers
+
+func record(m *Metrics) *Metrics {
+	m.Record(cache.Result{
+		Operation:   cache.OperationRestore,
+		Mount:       "node_modules",
+		Hit:         true,
+		Size:        1000,
+		Transferred: 250,
+		Duration:    2 * time.Second,
+
+		ArchiveDuration:  1500 * time.Millisecond,
+		TransferDuration: time.Second,
+	})
+	m.Record(cache.Result{Operation: cache.OperationRestore, Mount: "vendor"})
+	m.Record(cache.Result{Operation: cache.OperationRestore, Mount: "build", Hit: true, Err: errors.New("failed")})
+
+	return m
+}
@@ -0,0 +1,67 @@
+package plugin
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/meltwater/drone-cache/internal/metadata"
+	"github.com/meltwater/drone-cache/storage/backend"
+	"github.com/meltwater/drone-cache/storage/backend/filesystem"
+	"github.com/meltwater/drone-cache/test"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestDefaultAlgorithmRestoresLegacyKeys(t *testing.T) {
+	// Setup
+	root, rootClean := test.CreateTempDir(t, "legacy_keys_storage")
+	t.Cleanup(rootClean)
+
+	dir, dirClean := test.CreateTempDir(t, "legacy_keys")
+	t.Cleanup(dirClean)
+
+	file := filepath.Join(dir, "file.txt")
+	test.Ok(t, ioutil.WriteFile(file, []byte("hello\n"), 0644))
+
+	// NOTICE: Mounts are relative to the working directory, so the test can not run in parallel.
+	wd, err := os.Getwd()
+	test.Ok(t, err)
+	test.Ok(t, os.Chdir(filepath.Dir(dir)))
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	p := New(log.NewNopLogger())
+	p.Metadata = metadata.Metadata{
+		Repo:   metadata.Repo{Name: "repo"},
+		Commit: metadata.Commit{Branch: "main"},
+	}
+	p.Config = Config{
+		Backend:                 backend.FileSystem,
+		FileSystem:              filesystem.Config{CacheRoot: root},
+		StorageOperationTimeout: time.Minute,
+		HashAlgorithm:           "md5",
+		Rebuild:                 true,
+		Mount:                   []string{filepath.Base(dir)},
+	}
+
+	test.Ok(t, p.Exec())
+	test.Ok(t, os.Remove(file))
+
+	// Run
+	p.Config.HashAlgorithm, p.Config.Rebuild, p.Config.Restore = "", false, true
+	test.Ok(t, p.Exec())
+
+	// Test
+	b, err := ioutil.ReadFile(file)
+	test.Ok(t, err)
+	test.Equals(t, "hello\n", string(b), "cache of md5 key is not restored")
+
+	p.Config.Rebuild, p.Config.Restore = true, false
+	test.Ok(t, p.Exec())
+
+	keys, err := filepath.Glob(filepath.Join(root, "*", "sha256-*"))
+	test.Ok(t, err)
+	test.Equals(t, 1, len(keys), "cache is not rebuilt with a sha256 key")
+}
@@ -0,0 +1,221 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/meltwater/drone-cache/archive"
+	"github.com/meltwater/drone-cache/archive/tar"
+	"github.com/meltwater/drone-cache/cache"
+	"github.com/meltwater/drone-cache/storage"
+	"github.com/meltwater/drone-cache/storage/common"
+
+	"github.com/dustin/go-humanize"
+	"github.com/go-kit/kit/log/level"
+)
+
+// keyEntry summarizes the objects stored under a single key.
+type keyEntry struct {
+	key          string
+	size         int64
+	objects      int
+	lastModified time.Time
+}
+
+// List writes the keys of the namespace under the given prefix to the writer, with their sizes and ages.
+// Most recently modified keys are listed first.
+func (p *Plugin) List(w io.Writer, prefix string) error {
+	if err := p.Config.Validate(); err != nil {
+		return fmt.Errorf("invalid config, %w", err)
+	}
+
+	s, err := p.storage(nil)
+	if err != nil {
+		return err
+	}
+
+	namespace := p.namespace()
+
+	entries, err := s.List(path.Join(namespace, prefix))
+	if err != nil {
+		return fmt.Errorf("list <%s>, %w", path.Join(namespace, prefix), err)
+	}
+
+	keys := map[string]*keyEntry{}
+
+	for _, e := range entries {
+		k, ok := cache.KeyOf(namespace, e.Path)
+		if !ok {
+			continue
+		}
+
+		ke, ok := keys[k]
+		if !ok {
+			ke = &keyEntry{key: k}
+			keys[k] = ke
+		}
+
+		ke.size += e.Size
+		ke.objects++
+
+		if e.LastModified.After(ke.lastModified) {
+			ke.lastModified = e.LastModified
+		}
+	}
+
+	sorted := make([]*keyEntry, 0, len(keys))
+	for _, ke := range keys {
+		sorted = append(sorted, ke)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].lastModified.After(sorted[j].lastModified) })
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0) //nolint:gomnd
+	fmt.Fprintln(tw, "KEY\tSIZE\tOBJECTS\tLAST MODIFIED")
+
+	for _, ke := range sorted {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", ke.key, humanize.Bytes(uint64(ke.size)), ke.objects, humanize.Time(ke.lastModified))
+	}
+
+	return tw.Flush()
+}
+
+// Inspect writes the objects stored under the given key of the namespace to the writer,
+// with the entries of the archives among them.
+func (p *Plugin) Inspect(w io.Writer, key string) error {
+	if err := p.Config.Validate(); err != nil {
+		return fmt.Errorf("invalid config, %w", err)
+	}
+
+	prefix, err := p.keyPath(key)
+	if err != nil {
+		return err
+	}
+
+	s, err := p.storage(nil)
+	if err != nil {
+		return err
+	}
+
+	localRoot, err := p.localRoot()
+	if err != nil {
+		return err
+	}
+
+	a, err := p.archive(localRoot)
+	if err != nil {
+		return err
+	}
+
+	objects, err := s.List(prefix)
+	if err != nil {
+		return fmt.Errorf("list <%s>, %w", prefix, err)
+	}
+
+	if len(objects) == 0 {
+		return fmt.Errorf("key <%s>, %w", key, cache.ErrNotFound)
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Path < objects[j].Path })
+
+	for _, o := range objects {
+		fmt.Fprintf(w, "%s\n  size: %s\n  last modified: %s (%s)\n",
+			o.Path, humanize.Bytes(uint64(o.Size)), o.LastModified.UTC().Format(time.RFC3339), humanize.Time(o.LastModified))
+
+		if cache.IsSidecar(o.Path) {
+			continue
+		}
+
+		entries, err := archiveEntries(s, a, o)
+		if err != nil {
+			fmt.Fprintf(w, "  entries: unavailable, %v\n", err)
+			continue
+		}
+
+		fmt.Fprintf(w, "  entries: %d\n", len(entries))
+
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0) //nolint:gomnd
+		for _, e := range entries {
+			name := e.Name
+			if e.Link != "" {
+				name += " -> " + e.Link
+			}
+
+			fmt.Fprintf(tw, "    %s\t%s\t%s\t%s\n", e.Mode, humanize.Bytes(uint64(e.Size)), e.ModTime.UTC().Format(time.RFC3339), name)
+		}
+
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// archiveEntries downloads the object and lists its entries as an archive, without extracting it.
+func archiveEntries(s storage.Storage, a archive.Archive, o common.FileEntry) ([]tar.Entry, error) {
+	pr, pw := io.Pipe()
+	defer pr.Close()
+
+	go func() {
+		pw.CloseWithError(s.Get(o.Path, pw))
+	}()
+
+	return archive.List(a, pr)
+}
+
+// Remove deletes every object stored under the given keys of the namespace.
+func (p *Plugin) Remove(keys ...string) error {
+	if err := p.Config.Validate(); err != nil {
+		return fmt.Errorf("invalid config, %w", err)
+	}
+
+	if len(keys) == 0 {
+		return errors.New("at least one key is required")
+	}
+
+	s, err := p.storage(nil)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		prefix, err := p.keyPath(k)
+		if err != nil {
+			return err
+		}
+
+		objects, err := s.List(prefix)
+		if err != nil {
+			return fmt.Errorf("list <%s>, %w", prefix, err)
+		}
+
+		for _, o := range objects {
+			if err := s.Delete(o.Path); err != nil {
+				return fmt.Errorf("delete <%s>, %w", o.Path, err)
+			}
+		}
+
+		level.Info(p.logger).Log("msg", "cache removed", "key", k, "deleted objects", len(objects))
+	}
+
+	return nil
+}
+
+// keyPath returns the storage path of the given key, making sure it stays under the namespace.
+func (p *Plugin) keyPath(key string) (string, error) {
+	namespace := p.namespace()
+
+	prefix := path.Join(namespace, key)
+	if prefix == path.Clean(namespace) || !common.IsUnder(prefix, namespace) || prefix == ".." || strings.HasPrefix(prefix, "../") {
+		return "", fmt.Errorf("key <%s>, must be a path under the namespace <%s>", key, namespace)
+	}
+
+	return prefix, nil
+}
@@ -0,0 +1,65 @@
+package plugin
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meltwater/drone-cache/internal/metadata"
+	"github.com/meltwater/drone-cache/storage/backend"
+	"github.com/meltwater/drone-cache/storage/backend/filesystem"
+	"github.com/meltwater/drone-cache/test"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestListRemove(t *testing.T) {
+	t.Parallel()
+
+	// Setup
+	root, cleanup := test.CreateTempDir(t, "plugin_commands")
+	t.Cleanup(cleanup)
+
+	for _, p := range []string{"repo/k1/mount", "repo/k1/mount.sig", "repo/k2/mount", "repo/.files/ab/abcdef", "other/k3/mount"} {
+		test.Ok(t, os.MkdirAll(filepath.Join(root, filepath.Dir(p)), 0755))
+		test.Ok(t, ioutil.WriteFile(filepath.Join(root, p), []byte(p), 0644))
+	}
+
+	p := New(log.NewNopLogger())
+	p.Metadata = metadata.Metadata{Repo: metadata.Repo{Name: "repo"}}
+	p.Config = Config{
+		Backend:                 backend.FileSystem,
+		FileSystem:              filesystem.Config{CacheRoot: root},
+		StorageOperationTimeout: time.Minute,
+	}
+
+	// Run & Test
+	var buf bytes.Buffer
+	test.Ok(t, p.List(&buf, ""))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	test.Equals(t, 3, len(lines))
+	test.Assert(t, strings.HasPrefix(lines[0], "KEY"), "header is missing, got %q", lines[0])
+
+	for _, l := range lines[1:] {
+		f := strings.Fields(l)
+		test.Assert(t, f[0] == "k1" || f[0] == "k2", "unexpected key %q", f[0])
+	}
+
+	test.Ok(t, p.Remove("k1"))
+	test.NotOk(t, p.Remove("../other"))
+	test.NotOk(t, p.Remove(""))
+
+	_, err := os.Stat(filepath.Join(root, "repo/k1/mount.sig"))
+	test.Assert(t, os.IsNotExist(err), "objects of the removed key exist")
+
+	_, err = os.Stat(filepath.Join(root, "repo/k2/mount"))
+	test.Ok(t, err)
+
+	_, err = os.Stat(filepath.Join(root, "other/k3/mount"))
+	test.Ok(t, err)
+}
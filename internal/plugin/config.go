@@ -1,6 +1,7 @@
 package plugin
 
 import (
+	"net/url"
 	"time"
 
 	"github.com/meltwater/drone-cache/storage/backend/azure"
@@ -12,24 +13,58 @@ import (
 
 // Config plugin-specific parameters and secrets.
 type Config struct {
-	ArchiveFormat    string
-	Backend          string
-	CacheKeyTemplate string
-	RemoteRoot       string
-	LocalRoot        string
+	ArchiveFormat       string
+	Backend             string
+	CacheKeyTemplate    string
+	RestoreKeyTemplates []string
+	HashAlgorithm       string
+	RemoteRoot          string
+	LocalRoot           string
 
 	// Modes
 	Debug   bool
 	Rebuild bool
 	Restore bool
+	Flush   bool
+	DryRun  bool
 
 	// Optional
 	SkipSymlinks            bool
+	PreserveTimes           bool
+	PreserveOwner           bool
+	PreserveXattrs          bool
+	Reproducible            bool
+	SourceDateEpoch         int64
 	CompressionLevel        int
 	StorageOperationTimeout time.Duration
 	Override                bool
+	HashLongKeys            bool
+	SkipUnchanged           bool
+	Fingerprint             string
+	Chunked                 bool
+	ChunkSize               int
+	ChunkCache              string
+	EncryptionKeys          []string
+	SigningKey              string
+	TrustedKeys             []string
+	BranchScope             bool
+	UploadRateLimit         int64
+	DownloadRateLimit       int64
+	RateLimit               int64
+	MaxConcurrency          int
+	CompressionConcurrency  int
+	ProgressInterval        time.Duration
+	MetricsTextfile         string
+	MetricsPushgateway      string
+	MetricsJob              string
+	Report                  string
+	FlushTTL                time.Duration
 
-	Mount []string
+	Mount   []string
+	Exclude []string
+	Include []string
+
+	Incremental []string
 
 	// Backend
 	S3         s3.Config
@@ -38,3 +73,65 @@ type Config struct {
 	Azure      azure.Config
 	GCS        gcs.Config
 }
+
+// redactedValue replaces secrets in the redacted config.
+const redactedValue = "REDACTED"
+
+// redacted returns a copy of the config with its secrets replaced, so it is safe to be reported.
+func (c Config) redacted() Config {
+	c.EncryptionKeys = redactAll(c.EncryptionKeys)
+	c.SigningKey = redact(c.SigningKey)
+
+	c.S3.Key = redact(c.S3.Key)
+	c.S3.Secret = redact(c.S3.Secret)
+	c.Azure.AccountKey = redact(c.Azure.AccountKey)
+	c.GCS.APIKey = redact(c.GCS.APIKey)
+	c.GCS.JSONKey = redact(c.GCS.JSONKey)
+	c.GCS.Encryption = redact(c.GCS.Encryption)
+	c.SFTP.Auth.Password = redact(c.SFTP.Auth.Password)
+
+	// NOTICE: URLs might carry credentials as user info, e.g. a basic auth protected pushgateway.
+	c.MetricsPushgateway = redactURL(c.MetricsPushgateway)
+	c.S3.Endpoint = redactURL(c.S3.Endpoint)
+	c.GCS.Endpoint = redactURL(c.GCS.Endpoint)
+	c.Azure.BlobStorageURL = redactURL(c.Azure.BlobStorageURL)
+
+	return c
+}
+
+func redact(s string) string {
+	if s == "" {
+		return ""
+	}
+
+	return redactedValue
+}
+
+// redactURL strips the user info from the URL, the whole URL is redacted if it cannot be parsed.
+func redactURL(s string) string {
+	if s == "" {
+		return ""
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return redactedValue
+	}
+
+	u.User = nil
+
+	return u.String()
+}
+
+func redactAll(ss []string) []string {
+	if ss == nil {
+		return nil
+	}
+
+	redacted := make([]string, len(ss))
+	for i, s := range ss {
+		redacted[i] = redact(s)
+	}
+
+	return redacted
+}
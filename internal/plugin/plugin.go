@@ -2,23 +2,37 @@
 package plugin
 
 import (
+	"context"
+	"crypto/ed25519"
 	"errors"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
+	"time"
 
 	"github.com/meltwater/drone-cache/archive"
+	"github.com/meltwater/drone-cache/archive/encrypt"
+	"github.com/meltwater/drone-cache/archive/ignore"
 	"github.com/meltwater/drone-cache/cache"
 	"github.com/meltwater/drone-cache/internal/metadata"
+	"github.com/meltwater/drone-cache/internal/metrics"
+	"github.com/meltwater/drone-cache/internal/report"
+	"github.com/meltwater/drone-cache/internal/tracing"
 	"github.com/meltwater/drone-cache/key"
 	keygen "github.com/meltwater/drone-cache/key/generator"
 	"github.com/meltwater/drone-cache/storage"
 	"github.com/meltwater/drone-cache/storage/backend"
+	"github.com/meltwater/drone-cache/storage/chunked"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 )
 
+// tracingShutdownTimeout limits the time spent flushing spans at the end of the run.
+const tracingShutdownTimeout = 10 * time.Second
+
 // Error recognized error from plugin.
 type Error string
 
@@ -42,7 +56,7 @@ func New(logger log.Logger) *Plugin {
 }
 
 // Exec entry point of Plugin, where the magic happens.
-func (p *Plugin) Exec() error {
+func (p *Plugin) Exec() (err error) {
 	cfg := p.Config
 
 	// 1. Check parameters
@@ -57,69 +71,155 @@ func (p *Plugin) Exec() error {
 		level.Debug(p.logger).Log("msg", "plugin initialized with metadata", "metadata", fmt.Sprintf("%#v", p.Metadata))
 	}
 
-	// FLUSH
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid config, %w", err)
+	}
+
+	// NOTICE: Restore only trusts signed caches, so untrusted builds must neither sign nor upload unsigned caches.
+	if cfg.Rebuild && cfg.SigningKey != "" && !trusted(p.Metadata) {
+		level.Warn(p.logger).Log("msg", "untrusted build, cache is not rebuilt and signing key is ignored",
+			"event", p.Metadata.Build.Event, "pull request", p.Metadata.Commit.PullRequest)
 
-	if cfg.Rebuild && cfg.Restore {
-		return errors.New("rebuild and restore are mutually exclusive, please set only one of them")
+		return nil
 	}
 
-	var localRoot string
-	if p.Config.LocalRoot != "" {
-		localRoot = filepath.Clean(p.Config.LocalRoot)
-	} else {
-		workspace, err := os.Getwd()
-		if err != nil {
-			return fmt.Errorf("get working directory, %w", err)
-		}
+	localRoot, err := p.localRoot()
+	if err != nil {
+		return err
+	}
+
+	tracer, shutdown := p.tracing()
+	defer shutdown()
 
-		localRoot = workspace
+	options := []cache.Option{cache.WithNamespace(p.namespace())}
+
+	algorithm, err := keygen.ParseAlgorithm(cfg.HashAlgorithm)
+	if err != nil {
+		return fmt.Errorf("parse hash algorithm, %w", err)
 	}
 
-	var options []cache.Option
-	if p.Config.RemoteRoot != "" {
-		options = append(options, cache.WithNamespace(p.Config.RemoteRoot))
-	} else {
-		options = append(options, cache.WithNamespace(p.Metadata.Repo.Name))
+	// NOTICE: Branch scoped caches are isolated by the scope instead of the key,
+	// so that the key of a branch matches the key of the default branch that restore falls back to.
+	keyPart := p.Metadata.Commit.Branch
+	if cfg.BranchScope {
+		keyPart = p.Metadata.Repo.Name
 	}
 
-	var generator key.Generator
+	generator := tracer.Generator(keygen.NewHash(algorithm, keyPart))
+	fallback := tracer.Generator(keygen.NewStatic(keyPart))
+	legacy := tracer.Generator(keygen.NewHash(keygen.MD5, keyPart))
+
 	if cfg.CacheKeyTemplate != "" {
-		generator = keygen.NewMetadata(p.logger, cfg.CacheKeyTemplate, p.Metadata)
-		if err := generator.Check(); err != nil {
+		g := keygen.NewMetadata(p.logger, cfg.CacheKeyTemplate, p.Metadata, algorithm)
+		if err := g.Check(); err != nil {
 			return fmt.Errorf("parse failed, falling back to default, %w", err)
 		}
 
-		options = append(options, cache.WithFallbackGenerator(keygen.NewHash(p.Metadata.Commit.Branch)))
-	} else {
-		generator = keygen.NewHash(p.Metadata.Commit.Branch)
-		options = append(options, cache.WithFallbackGenerator(keygen.NewStatic(p.Metadata.Commit.Branch)))
+		generator, fallback = tracer.Generator(g), generator
+		legacy = tracer.Generator(keygen.NewMetadata(p.logger, cfg.CacheKeyTemplate, p.Metadata, keygen.MD5))
 	}
 
-	options = append(options, cache.WithOverride(p.Config.Override))
+	var restoreGenerators []key.Generator
 
-	// 2. Initialize storage backend.
-	b, err := backend.FromConfig(p.logger, cfg.Backend, backend.Config{
-		Debug:      cfg.Debug,
-		Azure:      cfg.Azure,
-		FileSystem: cfg.FileSystem,
-		GCS:        cfg.GCS,
-		S3:         cfg.S3,
-		SFTP:       cfg.SFTP,
-	})
+	// NOTICE: Keys were md5 digests before sha256 became the default,
+	// so unless an algorithm is selected, restore falls back to the md5 key to keep existing caches in use.
+	if cfg.HashAlgorithm == "" && algorithm != keygen.MD5 {
+		restoreGenerators = append(restoreGenerators, legacy)
+	}
+
+	for _, tmpl := range cfg.RestoreKeyTemplates {
+		if tmpl == "" {
+			continue
+		}
+
+		g := keygen.NewMetadata(p.logger, tmpl, p.Metadata, algorithm)
+		if err := g.Check(); err != nil {
+			return fmt.Errorf("parse restore key failed, %w", err)
+		}
+
+		restoreGenerators = append(restoreGenerators, tracer.Generator(g))
+	}
+
+	options = append(options, cache.WithGenerators(restoreGenerators...), cache.WithFallbackGenerator(fallback))
+
+	options = append(options,
+		cache.WithOverride(p.Config.Override),
+		cache.WithKeyLimits(backend.KeyLimits(cfg.Backend)),
+		cache.WithHashLongKeys(p.Config.HashLongKeys),
+		cache.WithIncremental(cfg.Incremental...),
+		cache.WithRateLimits(cache.RateLimits{
+			Upload:   cfg.UploadRateLimit,
+			Download: cfg.DownloadRateLimit,
+			Global:   cfg.RateLimit,
+		}),
+		cache.WithConcurrency(cfg.MaxConcurrency),
+		cache.WithProgressInterval(cfg.ProgressInterval),
+		cache.WithTracer(tracer.Mounts()),
+		cache.WithDryRun(cfg.DryRun),
+	)
+
+	signing, err := signing(cfg, p.Metadata)
 	if err != nil {
-		return fmt.Errorf("initialize backend <%s>, %w", cfg.Backend, err)
+		return fmt.Errorf("cache signing, %w", err)
+	}
+
+	options = append(options, signing...)
+
+	// NOTICE: Nothing is transferred on a dry run, so its results would skew the metrics.
+	if (cfg.MetricsTextfile != "" || cfg.MetricsPushgateway != "") && !cfg.DryRun {
+		m := metrics.New(fullName(p.Metadata.Repo), cfg.Backend)
+		options = append(options, cache.WithRecorder(m))
+
+		defer p.exportMetrics(m)
+	}
+
+	if cfg.Report != "" {
+		r := report.New(build(p.Metadata), cfg.Backend, cfg.redacted())
+		options = append(options, cache.WithRecorder(r))
+
+		defer func() { p.writeReport(r, err) }()
+	}
+
+	if cfg.BranchScope {
+		scope, fallbacks := branchScope(p.Metadata)
+		options = append(options, cache.WithBranchScope(scope, fallbacks...))
+	}
+
+	if cfg.FlushTTL > 0 {
+		options = append(options, cache.WithFlushTTL(cfg.FlushTTL))
+	}
+
+	// NOTICE: Excluded paths are not archived, so incremental mounts skip them,
+	// and their changes must not change the fingerprint either.
+	m, err := excludes(localRoot, cfg.Exclude, cfg.Include)
+	if err != nil {
+		return fmt.Errorf("exclude patterns, %w", err)
+	}
+
+	options = append(options, cache.WithExcludes(localRoot, m))
+
+	if cfg.SkipUnchanged {
+		fp, err := cache.FingerprintFromMode(cfg.Fingerprint, localRoot, m, archiveSettings(cfg)...)
+		if err != nil {
+			return fmt.Errorf("fingerprint, %w", err)
+		}
+
+		options = append(options, cache.WithFingerprint(fp))
+	}
+
+	// 2. Initialize storage backend and archive.
+	s, err := p.storage(tracer)
+	if err != nil {
+		return err
+	}
+
+	a, err := p.archive(localRoot)
+	if err != nil {
+		return err
 	}
 
 	// 3. Initialize cache.
-	c := cache.New(p.logger,
-		storage.New(p.logger, b, cfg.StorageOperationTimeout),
-		archive.FromFormat(p.logger, localRoot, cfg.ArchiveFormat,
-			archive.WithSkipSymlinks(cfg.SkipSymlinks),
-			archive.WithCompressionLevel(cfg.CompressionLevel),
-		),
-		generator,
-		options...,
-	)
+	c := tracer.Cache(cache.New(p.logger, s, tracer.Archive(a), generator, options...))
 
 	// 4. Select mode
 	if cfg.Rebuild {
@@ -136,7 +236,287 @@ func (p *Plugin) Exec() error {
 		}
 	}
 
-	// FLUSH
+	if cfg.Flush {
+		if err := c.Flush(nil); err != nil {
+			level.Debug(p.logger).Log("err", fmt.Sprintf("%+v\n", err))
+			return Error(fmt.Sprintf("[IMPORTANT] flush cache, %+v\n", err))
+		}
+	}
 
 	return nil
 }
+
+// localRoot returns the directory that mounts are relative to, the working directory unless it is set.
+func (p *Plugin) localRoot() (string, error) {
+	if p.Config.LocalRoot != "" {
+		return filepath.Clean(p.Config.LocalRoot), nil
+	}
+
+	workspace, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("get working directory, %w", err)
+	}
+
+	return workspace, nil
+}
+
+// namespace returns the path that caches of the repository are stored under.
+func (p *Plugin) namespace() string {
+	if p.Config.RemoteRoot != "" {
+		return p.Config.RemoteRoot
+	}
+
+	return p.Metadata.Repo.Name
+}
+
+// storage initializes the storage backend of the config.
+func (p *Plugin) storage(tracer *tracing.Tracer) (storage.Storage, error) {
+	cfg := p.Config
+
+	b, err := backend.FromConfig(p.logger, cfg.Backend, backend.Config{
+		Debug:      cfg.Debug,
+		Azure:      cfg.Azure,
+		FileSystem: cfg.FileSystem,
+		GCS:        cfg.GCS,
+		S3:         cfg.S3,
+		SFTP:       cfg.SFTP,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("initialize backend <%s>, %w", cfg.Backend, err)
+	}
+
+	s := tracer.Storage(storage.New(p.logger, b, cfg.StorageOperationTimeout))
+	if cfg.Chunked {
+		s = chunked.New(log.With(p.logger, "component", "chunked"), s,
+			chunked.WithNamespace(path.Join(p.namespace(), chunked.DefaultNamespace)),
+			chunked.WithAverageChunkSize(cfg.ChunkSize),
+			chunked.WithLocalCache(cfg.ChunkCache),
+		)
+	}
+
+	return s, nil
+}
+
+// archive initializes the archive of the config, with mounts relative to the given local root.
+func (p *Plugin) archive(localRoot string) (archive.Archive, error) {
+	cfg := p.Config
+
+	excludes, err := excludes(localRoot, cfg.Exclude, cfg.Include)
+	if err != nil {
+		return nil, fmt.Errorf("exclude patterns, %w", err)
+	}
+
+	a, err := archive.FromFormat(p.logger, localRoot, cfg.ArchiveFormat,
+		archive.WithSkipSymlinks(cfg.SkipSymlinks),
+		archive.WithCompressionLevel(cfg.CompressionLevel),
+		archive.WithExcludes(excludes),
+		archive.WithPreserveTimes(cfg.PreserveTimes),
+		archive.WithPreserveOwner(cfg.PreserveOwner),
+		archive.WithPreserveXattrs(cfg.PreserveXattrs),
+		archive.WithReproducible(cfg.Reproducible),
+		archive.WithSourceDateEpoch(time.Unix(cfg.SourceDateEpoch, 0).UTC()),
+		archive.WithConcurrency(cfg.CompressionConcurrency),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("archive format, %w", err)
+	}
+
+	if len(cfg.EncryptionKeys) > 0 {
+		if a, err = encrypted(p.logger, a, cfg.EncryptionKeys, cfg.Incremental); err != nil {
+			return nil, fmt.Errorf("archive encryption, %w", err)
+		}
+	}
+
+	return a, nil
+}
+
+// Helpers
+
+// modes returns the number of the given modes that are set.
+func modes(set ...bool) int {
+	var n int
+
+	for _, s := range set {
+		if s {
+			n++
+		}
+	}
+
+	return n
+}
+
+// excludes creates a matcher from patterns in the ignore file of the workspace, followed by given exclude patterns.
+// Include patterns are added last as negated patterns, so they re-include otherwise excluded paths.
+func excludes(localRoot string, exclude, include []string) (*ignore.Matcher, error) {
+	patterns, err := ignore.ReadFile(filepath.Join(localRoot, ignore.FileName))
+	if err != nil {
+		return nil, err
+	}
+
+	patterns = append(patterns, exclude...)
+	for _, p := range include {
+		patterns = append(patterns, "!"+p)
+	}
+
+	return ignore.New(patterns...)
+}
+
+// archiveSettings returns the settings that change the archive of a source, so that they change its fingerprint too.
+func archiveSettings(cfg Config) []string {
+	settings := []string{
+		"archive-format=" + cfg.ArchiveFormat,
+		"compression-level=" + strconv.Itoa(cfg.CompressionLevel),
+		"skip-symlinks=" + strconv.FormatBool(cfg.SkipSymlinks),
+		"preserve-times=" + strconv.FormatBool(cfg.PreserveTimes),
+		"preserve-owner=" + strconv.FormatBool(cfg.PreserveOwner),
+		"preserve-xattrs=" + strconv.FormatBool(cfg.PreserveXattrs),
+		"reproducible=" + strconv.FormatBool(cfg.Reproducible),
+		"source-date-epoch=" + strconv.FormatInt(cfg.SourceDateEpoch, 10),
+	}
+
+	for _, k := range cfg.EncryptionKeys {
+		settings = append(settings, "archive-encryption-key="+k)
+	}
+
+	return settings
+}
+
+// encrypted wraps the archive to encrypt with the first of the given keys, and decrypt with any of them.
+func encrypted(l log.Logger, a archive.Archive, keys []string, incremental []string) (archive.Archive, error) {
+	// NOTICE: Incremental mounts are stored file by file, without an archive to encrypt.
+	if len(incremental) > 0 {
+		return nil, errors.New("incremental mounts can not be encrypted")
+	}
+
+	parsed := make([]encrypt.Key, 0, len(keys))
+
+	for i, k := range keys {
+		key, err := encrypt.ParseKey(k)
+		if err != nil {
+			return nil, fmt.Errorf("key %d, %w", i, err)
+		}
+
+		parsed = append(parsed, key)
+	}
+
+	level.Debug(l).Log("msg", "archives are encrypted", "key id", parsed[0].ID())
+
+	return encrypt.New(l, a, parsed...)
+}
+
+// tracing creates a tracer if tracing is configured by the environment, and a function to flush its spans.
+// Failing to set up or flush tracing does not fail the build.
+func (p *Plugin) tracing() (*tracing.Tracer, func()) {
+	if !tracing.Enabled() {
+		return nil, func() {}
+	}
+
+	t, shutdown, err := tracing.Setup(context.Background())
+	if err != nil {
+		level.Warn(p.logger).Log("msg", "tracing disabled", "err", err)
+		return nil, func() {}
+	}
+
+	return t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+		defer cancel()
+
+		if err := shutdown(ctx); err != nil {
+			level.Warn(p.logger).Log("msg", "flush spans", "err", err)
+		}
+	}
+}
+
+// fullName returns the name of the repository prefixed with its namespace, or its owner for older Drone versions.
+func fullName(repo metadata.Repo) string {
+	owner := repo.Namespace
+	if owner == "" {
+		owner = repo.Owner
+	}
+
+	return path.Join(owner, repo.Name)
+}
+
+// exportMetrics writes the recorded metrics to the textfile and pushes them to the Pushgateway, if they are set.
+// Failing to export metrics does not fail the build.
+func (p *Plugin) exportMetrics(m *metrics.Metrics) {
+	cfg := p.Config
+
+	if cfg.MetricsTextfile != "" {
+		if err := m.WriteTextfile(cfg.MetricsTextfile); err != nil {
+			level.Warn(p.logger).Log("msg", "export metrics", "err", err)
+		}
+	}
+
+	if cfg.MetricsPushgateway != "" {
+		if err := m.Push(cfg.MetricsPushgateway, cfg.MetricsJob, cfg.StorageOperationTimeout); err != nil {
+			level.Warn(p.logger).Log("msg", "export metrics", "err", err)
+		}
+	}
+}
+
+// build describes the pipeline run in the report.
+func build(m metadata.Metadata) report.Build {
+	return report.Build{
+		Repo:   fullName(m.Repo),
+		Branch: m.Commit.Branch,
+		Commit: m.Commit.Sha,
+		Number: m.Build.Number,
+		Event:  m.Build.Event,
+	}
+}
+
+// writeReport finishes the report with the outcome of the run and writes it.
+// Failing to write the report does not fail the build.
+func (p *Plugin) writeReport(r *report.Report, err error) {
+	r.Finish(err)
+
+	if err := r.WriteFile(p.Config.Report); err != nil {
+		level.Warn(p.logger).Log("msg", "write report", "err", err)
+	}
+}
+
+// trusted reports whether the build may sign caches. Pull requests, from forks in particular, run code that is not reviewed yet,
+// unless the repository is private and trusted, so that only its members can open pull requests that are built with privileges.
+func trusted(m metadata.Metadata) bool {
+	if m.Build.Event != "pull_request" && m.Commit.PullRequest == 0 {
+		return true
+	}
+
+	return m.Repo.Private && m.Repo.Trusted
+}
+
+// signing creates options to sign rebuilt caches and verify restored ones, scoped to the repository.
+// Caches are only signed by trusted builds.
+func signing(cfg Config, m metadata.Metadata) ([]cache.Option, error) {
+	var (
+		scope   = fullName(m.Repo)
+		options []cache.Option
+	)
+
+	if cfg.SigningKey != "" && trusted(m) {
+		k, err := cache.ParseSigningKey(cfg.SigningKey)
+		if err != nil {
+			return nil, err
+		}
+
+		options = append(options, cache.WithSigner(cache.NewSigner(k, scope)))
+	}
+
+	if len(cfg.TrustedKeys) > 0 {
+		keys := make([]ed25519.PublicKey, 0, len(cfg.TrustedKeys))
+
+		for i, s := range cfg.TrustedKeys {
+			k, err := cache.ParseVerificationKey(s)
+			if err != nil {
+				return nil, fmt.Errorf("trusted key %d, %w", i, err)
+			}
+
+			keys = append(keys, k)
+		}
+
+		options = append(options, cache.WithVerifier(cache.NewVerifier(scope, keys...)))
+	}
+
+	return options, nil
+}
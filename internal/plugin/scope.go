@@ -0,0 +1,31 @@
+package plugin
+
+import (
+	"strconv"
+
+	"github.com/meltwater/drone-cache/cache"
+	"github.com/meltwater/drone-cache/internal/metadata"
+)
+
+// branchScope returns the scope that rebuild writes to, and the scopes that restore falls back to in order.
+// Pull requests, forks included, write to a scope of their own, so that they never overwrite the cache of a branch.
+// They restore from their source branch first, then from their target branch and the default branch.
+func branchScope(m metadata.Metadata) (string, []string) {
+	c := m.Commit
+	if c.PullRequest == 0 && m.Build.Event != "pull_request" {
+		return c.Branch, []string{m.Repo.Branch}
+	}
+
+	id := c.SourceBranch
+	if c.PullRequest > 0 {
+		id = strconv.Itoa(c.PullRequest)
+	}
+
+	target := c.TargetBranch
+	if target == "" {
+		// NOTICE: Commit branch of pull requests is their target branch.
+		target = c.Branch
+	}
+
+	return cache.PullRequestScope(id), []string{c.SourceBranch, target, m.Repo.Branch}
+}
@@ -0,0 +1,118 @@
+package plugin
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/meltwater/drone-cache/internal/metadata"
+	"github.com/meltwater/drone-cache/storage/backend"
+	"github.com/meltwater/drone-cache/storage/backend/filesystem"
+	"github.com/meltwater/drone-cache/test"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestBranchScope(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name      string
+		m         metadata.Metadata
+		scope     string
+		fallbacks []string
+	}{
+		{
+			name: "push",
+			m: metadata.Metadata{
+				Build:  metadata.Build{Event: "push"},
+				Commit: metadata.Commit{Branch: "feature"},
+				Repo:   metadata.Repo{Branch: "main"},
+			},
+			scope:     "feature",
+			fallbacks: []string{"main"},
+		},
+		{
+			name: "pull request",
+			m: metadata.Metadata{
+				Build:  metadata.Build{Event: "pull_request"},
+				Commit: metadata.Commit{Branch: "main", PullRequest: 42, SourceBranch: "feature", TargetBranch: "main"},
+				Repo:   metadata.Repo{Branch: "main"},
+			},
+			scope:     "pull:42",
+			fallbacks: []string{"feature", "main", "main"},
+		},
+		{
+			// NOTICE: A fork with a source branch named as a branch of the repository must not write to its scope.
+			name: "pull request of a fork",
+			m: metadata.Metadata{
+				Build:  metadata.Build{Event: "pull_request"},
+				Commit: metadata.Commit{Branch: "release", PullRequest: 7, SourceBranch: "main"},
+				Repo:   metadata.Repo{Branch: "main"},
+			},
+			scope:     "pull:7",
+			fallbacks: []string{"main", "release", "main"},
+		},
+		{
+			name: "pull request without number",
+			m: metadata.Metadata{
+				Build:  metadata.Build{Event: "pull_request"},
+				Commit: metadata.Commit{Branch: "main", SourceBranch: "main"},
+			},
+			scope:     "pull:main",
+			fallbacks: []string{"main", "main", ""},
+		},
+	} {
+		scope, fallbacks := branchScope(tc.m)
+		test.Equals(t, tc.scope, scope, tc.name)
+		test.Equals(t, tc.fallbacks, fallbacks, tc.name)
+	}
+}
+
+func TestBranchScopeRestoresDefaultBranch(t *testing.T) {
+	// Setup
+	root, rootClean := test.CreateTempDir(t, "branch_scope_storage")
+	t.Cleanup(rootClean)
+
+	dir, dirClean := test.CreateTempDir(t, "branch_scope")
+	t.Cleanup(dirClean)
+
+	file := filepath.Join(dir, "file.txt")
+	test.Ok(t, ioutil.WriteFile(file, []byte("main\n"), 0644))
+
+	// NOTICE: Mounts are relative to the working directory, so the test can not run in parallel.
+	wd, err := os.Getwd()
+	test.Ok(t, err)
+	test.Ok(t, os.Chdir(filepath.Dir(dir)))
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	p := New(log.NewNopLogger())
+	p.Metadata = metadata.Metadata{
+		Build:  metadata.Build{Event: "push"},
+		Repo:   metadata.Repo{Name: "repo", Branch: "main"},
+		Commit: metadata.Commit{Branch: "main"},
+	}
+	p.Config = Config{
+		Backend:                 backend.FileSystem,
+		FileSystem:              filesystem.Config{CacheRoot: root},
+		StorageOperationTimeout: time.Minute,
+		BranchScope:             true,
+		Rebuild:                 true,
+		Mount:                   []string{filepath.Base(dir)},
+	}
+
+	test.Ok(t, p.Exec())
+	test.Ok(t, os.Remove(file))
+
+	// Run
+	p.Metadata.Commit.Branch = "feature"
+	p.Config.Rebuild, p.Config.Restore = false, true
+	test.Ok(t, p.Exec())
+
+	// Test
+	b, err := ioutil.ReadFile(file)
+	test.Ok(t, err)
+	test.Equals(t, "main\n", string(b), "cache of the default branch is not restored")
+}
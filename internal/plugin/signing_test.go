@@ -0,0 +1,88 @@
+package plugin
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/meltwater/drone-cache/internal/metadata"
+	"github.com/meltwater/drone-cache/storage/backend"
+	"github.com/meltwater/drone-cache/storage/backend/filesystem"
+	"github.com/meltwater/drone-cache/test"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestTrusted(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name    string
+		m       metadata.Metadata
+		trusted bool
+	}{
+		{"push", metadata.Metadata{Build: metadata.Build{Event: "push"}}, true},
+		{"pull request", metadata.Metadata{Build: metadata.Build{Event: "pull_request"}}, false},
+		{"pull request number", metadata.Metadata{Commit: metadata.Commit{PullRequest: 1}}, false},
+		{"pull request of a public trusted repository", metadata.Metadata{
+			Build: metadata.Build{Event: "pull_request"},
+			Repo:  metadata.Repo{Trusted: true},
+		}, false},
+		{"pull request of a private trusted repository", metadata.Metadata{
+			Build: metadata.Build{Event: "pull_request"},
+			Repo:  metadata.Repo{Private: true, Trusted: true},
+		}, true},
+	} {
+		test.Equals(t, tc.trusted, trusted(tc.m), tc.name)
+	}
+}
+
+func TestUntrustedRebuild(t *testing.T) {
+	t.Parallel()
+
+	// Setup
+	root, rootClean := test.CreateTempDir(t, "untrusted_rebuild_storage")
+	t.Cleanup(rootClean)
+
+	dir, dirClean := test.CreateTempDir(t, "untrusted_rebuild")
+	t.Cleanup(dirClean)
+
+	test.Ok(t, ioutil.WriteFile(filepath.Join(dir, "file.txt"), []byte("hello\n"), 0644))
+
+	_, k, err := ed25519.GenerateKey(nil)
+	test.Ok(t, err)
+
+	p := New(log.NewNopLogger())
+	p.Metadata = metadata.Metadata{
+		Repo:   metadata.Repo{Name: "repo"},
+		Build:  metadata.Build{Event: "pull_request"},
+		Commit: metadata.Commit{Branch: "main", PullRequest: 1},
+	}
+	p.Config = Config{
+		Backend:                 backend.FileSystem,
+		FileSystem:              filesystem.Config{CacheRoot: root},
+		StorageOperationTimeout: time.Minute,
+		Rebuild:                 true,
+		Mount:                   []string{dir},
+		SigningKey:              base64.StdEncoding.EncodeToString(k.Seed()),
+	}
+
+	// Run
+	test.Ok(t, p.Exec())
+
+	// Test
+	entries, err := ioutil.ReadDir(root)
+	test.Ok(t, err)
+	test.Equals(t, 0, len(entries), "untrusted build rebuilt the cache")
+
+	// NOTICE: Same build is trusted once it is not a pull request.
+	p.Metadata.Build.Event, p.Metadata.Commit.PullRequest = "push", 0
+	test.Ok(t, p.Exec())
+
+	entries, err = ioutil.ReadDir(root)
+	test.Ok(t, err)
+	test.Assert(t, len(entries) > 0, "trusted build did not rebuild the cache")
+}
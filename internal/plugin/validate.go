@@ -0,0 +1,167 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/meltwater/drone-cache/archive"
+	"github.com/meltwater/drone-cache/cache"
+	"github.com/meltwater/drone-cache/internal"
+	"github.com/meltwater/drone-cache/internal/metadata"
+	keygen "github.com/meltwater/drone-cache/key/generator"
+	"github.com/meltwater/drone-cache/storage/backend"
+	"github.com/meltwater/drone-cache/storage/backend/sftp"
+
+	"github.com/go-kit/kit/log"
+)
+
+// Validate checks the config before anything is fetched or stored, returns all of its problems at once.
+func (c Config) Validate() error {
+	errs := &internal.MultiError{}
+
+	if modes(c.Rebuild, c.Restore, c.Flush) > 1 {
+		errs.Add(errors.New("rebuild, restore and flush are mutually exclusive, please set only one of them"))
+	}
+
+	if c.StorageOperationTimeout <= 0 {
+		errs.Add(fmt.Errorf("backend operation timeout <%s>, must be positive", c.StorageOperationTimeout))
+	}
+
+	c.validateBackend(errs)
+	c.validateArchive(errs)
+	c.validateKeys(errs)
+	c.validateMounts(errs)
+	c.validateLimits(errs)
+
+	return errs.Err()
+}
+
+// validateBackend checks that the backend is known and its required fields are set.
+func (c Config) validateBackend(errs *internal.MultiError) {
+	required := func(field, value string) {
+		if value == "" {
+			errs.Add(fmt.Errorf("%s backend, %s is required", c.Backend, field))
+		}
+	}
+
+	switch c.Backend {
+	case backend.Azure:
+		required("account name", c.Azure.AccountName)
+		required("account key", c.Azure.AccountKey)
+		required("container name", c.Azure.ContainerName)
+	case backend.FileSystem:
+		required("cache root", c.FileSystem.CacheRoot)
+	case backend.GCS:
+		required("bucket", c.GCS.Bucket)
+	case backend.S3:
+		required("bucket", c.S3.Bucket)
+	case backend.SFTP:
+		required("cache root", c.SFTP.CacheRoot)
+		required("host", c.SFTP.Host)
+		required("username", c.SFTP.Username)
+
+		switch c.SFTP.Auth.Method {
+		case sftp.SSHAuthMethodPassword:
+			required("password", c.SFTP.Auth.Password)
+		case sftp.SSHAuthMethodPublicKeyFile:
+			required("public key file", c.SFTP.Auth.PublicKeyFile)
+		default:
+			errs.Add(fmt.Errorf("sftp backend, unknown auth method <%s>, must be one of %s, %s",
+				c.SFTP.Auth.Method, sftp.SSHAuthMethodPassword, sftp.SSHAuthMethodPublicKeyFile))
+		}
+	default:
+		errs.Add(fmt.Errorf("unknown backend <%s>, must be one of %s",
+			c.Backend, strings.Join([]string{backend.Azure, backend.FileSystem, backend.GCS, backend.S3, backend.SFTP}, ", ")))
+	}
+}
+
+// validateArchive checks the archive format and its compression level.
+func (c Config) validateArchive(errs *internal.MultiError) {
+	switch c.ArchiveFormat {
+	case archive.Gzip, archive.Tar, "":
+		errs.Add(archive.ValidCompressionLevel(c.ArchiveFormat, c.CompressionLevel))
+	default:
+		errs.Add(fmt.Errorf("archive format <%s>, must be one of %s, %s, %w",
+			c.ArchiveFormat, archive.Gzip, archive.Tar, archive.ErrUnknownFormat))
+	}
+}
+
+// validateKeys checks the hash algorithm, the fingerprint mode and that the cache key templates parse.
+func (c Config) validateKeys(errs *internal.MultiError) {
+	algorithm, err := keygen.ParseAlgorithm(c.HashAlgorithm)
+	if err != nil {
+		errs.Add(err)
+	}
+
+	if _, err := cache.FingerprintFromMode(c.Fingerprint, "", nil); err != nil {
+		errs.Add(err)
+	}
+
+	for _, tmpl := range append([]string{c.CacheKeyTemplate}, c.RestoreKeyTemplates...) {
+		if tmpl == "" {
+			continue
+		}
+
+		// NOTICE: Templates are executed with empty metadata, so that unknown fields and functions are found.
+		errs.Add(keygen.NewMetadata(log.NewNopLogger(), tmpl, metadata.Metadata{}, algorithm).Check())
+	}
+}
+
+// validateMounts checks that rebuild and restore have mounts, and that mounts are neither empty nor repeated.
+func (c Config) validateMounts(errs *internal.MultiError) {
+	if (c.Rebuild || c.Restore) && len(c.Mount) == 0 {
+		errs.Add(errors.New("at least one mount is required to rebuild or restore"))
+	}
+
+	cleaned := make(map[string]bool, len(c.Mount))
+
+	for _, m := range c.Mount {
+		if strings.TrimSpace(m) == "" {
+			errs.Add(errors.New("mount, empty path"))
+			continue
+		}
+
+		clean := filepath.Clean(m)
+		if cleaned[clean] {
+			errs.Add(fmt.Errorf("mount <%s>, given more than once", m))
+		}
+
+		cleaned[clean] = true
+	}
+
+	// NOTICE: Incremental mounts are matched as they are given, so they must be spelled as the mounts.
+	mounts := make(map[string]bool, len(c.Mount))
+	for _, m := range c.Mount {
+		mounts[m] = true
+	}
+
+	for _, m := range c.Incremental {
+		if !mounts[m] {
+			errs.Add(fmt.Errorf("incremental <%s>, is not a mount", m))
+		}
+	}
+}
+
+// validateLimits checks that limits are not negative.
+func (c Config) validateLimits(errs *internal.MultiError) {
+	for _, l := range []struct {
+		name  string
+		value int64
+	}{
+		{"upload rate limit", c.UploadRateLimit},
+		{"download rate limit", c.DownloadRateLimit},
+		{"rate limit", c.RateLimit},
+		{"max concurrency", int64(c.MaxConcurrency)},
+		{"compression concurrency", int64(c.CompressionConcurrency)},
+	} {
+		if l.value < 0 {
+			errs.Add(fmt.Errorf("%s <%d>, must not be negative", l.name, l.value))
+		}
+	}
+
+	if c.Chunked && c.ChunkSize <= 0 {
+		errs.Add(fmt.Errorf("chunk size <%d>, must be positive", c.ChunkSize))
+	}
+}
@@ -0,0 +1,100 @@
+package plugin
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meltwater/drone-cache/archive"
+	"github.com/meltwater/drone-cache/internal"
+	"github.com/meltwater/drone-cache/storage/backend"
+	"github.com/meltwater/drone-cache/storage/backend/filesystem"
+	"github.com/meltwater/drone-cache/storage/backend/sftp"
+	"github.com/meltwater/drone-cache/test"
+)
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	valid := func() Config {
+		return Config{
+			Backend:                 backend.FileSystem,
+			FileSystem:              filesystem.Config{CacheRoot: "/tmp/cache"},
+			ArchiveFormat:           archive.Gzip,
+			CompressionLevel:        archive.DefaultCompressionLevel,
+			StorageOperationTimeout: time.Minute,
+			CacheKeyTemplate:        `{{ .Commit.Branch }}-{{ checksum "go.sum" }}`,
+			Rebuild:                 true,
+			Mount:                   []string{"vendor", ".cache"},
+			Incremental:             []string{".cache"},
+		}
+	}
+
+	test.Ok(t, valid().Validate())
+
+	for name, tc := range map[string]struct {
+		modify func(*Config)
+		errs   []string
+	}{
+		"modes": {
+			modify: func(c *Config) { c.Restore = true },
+			errs:   []string{"mutually exclusive"},
+		},
+		"backend": {
+			modify: func(c *Config) { c.Backend = "s4" },
+			errs:   []string{"unknown backend <s4>"},
+		},
+		"required fields": {
+			modify: func(c *Config) { c.Backend = backend.S3 },
+			errs:   []string{"s3 backend, bucket is required"},
+		},
+		"sftp auth": {
+			modify: func(c *Config) {
+				c.Backend = backend.SFTP
+				c.SFTP = sftp.Config{CacheRoot: "/cache", Host: "host", Username: "user", Auth: sftp.SSHAuth{Method: sftp.SSHAuthMethodPublicKeyFile}}
+			},
+			errs: []string{"public key file is required"},
+		},
+		"archive format": {
+			modify: func(c *Config) { c.ArchiveFormat = "zip" },
+			errs:   []string{"archive format <zip>"},
+		},
+		"compression level": {
+			modify: func(c *Config) { c.CompressionLevel = 10 },
+			errs:   []string{"compression level <10>"},
+		},
+		"keys": {
+			modify: func(c *Config) {
+				c.HashAlgorithm = "crc32"
+				c.CacheKeyTemplate = "{{ .Commit.Brunch }}"
+				c.RestoreKeyTemplates = []string{"{{ checksum }"}
+			},
+			errs: []string{"unknown hash algorithm", "Brunch", "parse"},
+		},
+		"mounts": {
+			modify: func(c *Config) { c.Mount = []string{"vendor", "vendor/", ""} },
+			errs:   []string{"given more than once", "empty path", "incremental <.cache>, is not a mount"},
+		},
+		"limits": {
+			modify: func(c *Config) {
+				c.MaxConcurrency = -1
+				c.StorageOperationTimeout = 0
+			},
+			errs: []string{"max concurrency <-1>", "backend operation timeout"},
+		},
+	} {
+		cfg := valid()
+		tc.modify(&cfg)
+
+		err := cfg.Validate()
+		test.Assert(t, err != nil, "%s: expected an error", name)
+
+		var me *internal.MultiError
+		test.Assert(t, errors.As(err, &me), "%s: expected all errors at once", name)
+
+		for _, e := range tc.errs {
+			test.Assert(t, strings.Contains(err.Error(), e), "%s: expected <%s> in <%v>", name, e, err)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package ratelimit
+
+// Option overrides behavior of Limiter.
+type Option interface {
+	apply(*Limiter)
+}
+
+type optionFunc func(*Limiter)
+
+func (f optionFunc) apply(l *Limiter) {
+	f(l)
+}
+
+// WithClock sets the clock of the limiter.
+func WithClock(c Clock) Option {
+	return optionFunc(func(l *Limiter) {
+		l.clock = c
+	})
+}
+
+// WithBurst sets the maximum number of bytes allowed at once.
+func WithBurst(n int64) Option {
+	return optionFunc(func(l *Limiter) {
+		l.burst = n
+	})
+}
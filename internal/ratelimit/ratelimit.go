@@ -0,0 +1,183 @@
+// Package ratelimit provides token bucket rate limiting for readers and writers.
+package ratelimit
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Clock provides time to limiters, it can be replaced in tests.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time        { return time.Now() }
+func (realClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+// Limiter is a token bucket that allows given number of bytes per second, it is safe for concurrent use.
+// Limiters can be shared by multiple readers and writers to limit their total rate.
+type Limiter struct {
+	mu sync.Mutex
+
+	clock  Clock
+	rate   float64
+	burst  int64
+	tokens float64
+	last   time.Time
+}
+
+// New creates a limiter that allows rate bytes per second, with a burst of one second worth of bytes.
+func New(rate int64, opts ...Option) *Limiter {
+	l := &Limiter{clock: realClock{}, rate: float64(rate), burst: rate}
+
+	for _, o := range opts {
+		o.apply(l)
+	}
+
+	if l.burst <= 0 {
+		l.burst = 1
+	}
+
+	l.tokens = float64(l.burst)
+	l.last = l.clock.Now()
+
+	return l
+}
+
+// WaitN blocks until n bytes are allowed.
+func (l *Limiter) WaitN(n int) {
+	for n > 0 {
+		take := n
+		if int64(take) > l.burst {
+			take = int(l.burst)
+		}
+
+		l.clock.Sleep(l.reserve(take))
+
+		n -= take
+	}
+}
+
+// reserve takes n tokens from the bucket, returns how long to wait until the taken tokens are refilled.
+// NOTICE: Tokens can go negative, so waiters are served in order without starving large reservations.
+func (l *Limiter) reserve(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > float64(l.burst) {
+		l.tokens = float64(l.burst)
+	}
+
+	l.last = now
+	l.tokens -= float64(n)
+
+	if l.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// NewReader returns a reader that reads from r as fast as all the given limiters allow.
+// Nil limiters are ignored, r is returned as it is when there is no limiter.
+func NewReader(r io.Reader, limiters ...*Limiter) io.Reader {
+	ls, max := active(limiters)
+	if len(ls) == 0 {
+		return r
+	}
+
+	return &reader{r: r, limiters: ls, max: max}
+}
+
+type reader struct {
+	r        io.Reader
+	limiters []*Limiter
+	max      int64
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if int64(len(p)) > r.max {
+		p = p[:r.max]
+	}
+
+	n, err := r.r.Read(p)
+	for _, l := range r.limiters {
+		l.WaitN(n)
+	}
+
+	return n, err
+}
+
+// NewWriter returns a writer that writes to w as fast as all the given limiters allow.
+// Nil limiters are ignored, w is returned as it is when there is no limiter.
+func NewWriter(w io.Writer, limiters ...*Limiter) io.Writer {
+	ls, max := active(limiters)
+	if len(ls) == 0 {
+		return w
+	}
+
+	return &writer{w: w, limiters: ls, max: max}
+}
+
+type writer struct {
+	w        io.Writer
+	limiters []*Limiter
+	max      int64
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	var written int
+
+	for len(p) > 0 {
+		chunk := p
+		if int64(len(chunk)) > w.max {
+			chunk = chunk[:w.max]
+		}
+
+		for _, l := range w.limiters {
+			l.WaitN(len(chunk))
+		}
+
+		n, err := w.w.Write(chunk)
+		written += n
+
+		if err != nil {
+			return written, err
+		}
+
+		p = p[n:]
+	}
+
+	return written, nil
+}
+
+// Helpers
+
+// active returns the non nil limiters and the smallest burst among them.
+func active(limiters []*Limiter) ([]*Limiter, int64) {
+	var (
+		ls  []*Limiter
+		max int64
+	)
+
+	for _, l := range limiters {
+		if l == nil {
+			continue
+		}
+
+		if max == 0 || l.burst < max {
+			max = l.burst
+		}
+
+		ls = append(ls, l)
+	}
+
+	return ls, max
+}
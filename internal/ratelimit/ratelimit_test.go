@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/meltwater/drone-cache/test"
+)
+
+type fakeClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	slept time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	c.slept += d
+}
+
+func TestReader(t *testing.T) {
+	t.Parallel()
+
+	c := &fakeClock{now: time.Unix(0, 0)}
+	data := bytes.Repeat([]byte("a"), 1000)
+
+	b, err := ioutil.ReadAll(NewReader(bytes.NewReader(data), New(100, WithClock(c))))
+	test.Ok(t, err)
+	test.Equals(t, data, b)
+
+	// First second worth of bytes is allowed at once, the rest is paced.
+	test.Equals(t, 9*time.Second, c.slept)
+}
+
+func TestWriter(t *testing.T) {
+	t.Parallel()
+
+	c := &fakeClock{now: time.Unix(0, 0)}
+	data := bytes.Repeat([]byte("a"), 1000)
+
+	var buf bytes.Buffer
+
+	n, err := NewWriter(&buf, New(100, WithClock(c), WithBurst(10))).Write(data)
+	test.Ok(t, err)
+	test.Equals(t, len(data), n)
+	test.Equals(t, data, buf.Bytes())
+	test.Equals(t, 99*time.Second/10, c.slept)
+}
+
+func TestSharedLimiter(t *testing.T) {
+	t.Parallel()
+
+	var (
+		c      = &fakeClock{now: time.Unix(0, 0)}
+		global = New(100, WithClock(c))
+		data   = bytes.Repeat([]byte("a"), 500)
+	)
+
+	// Each stream is within its own limit, but together they exceed the shared one.
+	for i := 0; i < 2; i++ {
+		r := NewReader(bytes.NewReader(data), New(1000, WithClock(c)), global)
+
+		_, err := io.Copy(ioutil.Discard, r)
+		test.Ok(t, err)
+	}
+
+	test.Equals(t, 9*time.Second, c.slept)
+}
+
+func TestNoLimiter(t *testing.T) {
+	t.Parallel()
+
+	r := bytes.NewReader(nil)
+	test.Assert(t, NewReader(r, nil) == io.Reader(r), "reader is wrapped without a limiter")
+
+	var w bytes.Buffer
+	test.Assert(t, NewWriter(&w, nil) == io.Writer(&w), "writer is wrapped without a limiter")
+}
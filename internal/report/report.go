@@ -0,0 +1,167 @@
+// Package report describes a run of the plugin in a structured JSON report,
+// with its configuration, resolved keys and the outcome of each mount.
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/meltwater/drone-cache/cache"
+)
+
+// Stdout is the report path that writes the report to the standard output.
+const Stdout = "-"
+
+// Build describes the pipeline run that the report belongs to.
+type Build struct {
+	Repo   string `json:"repo"`
+	Branch string `json:"branch"`
+	Commit string `json:"commit"`
+	Number int    `json:"number"`
+	Event  string `json:"event"`
+}
+
+// Mount describes the outcome of rebuilding or restoring a single mount.
+type Mount struct {
+	Mount     string `json:"mount"`
+	Operation string `json:"operation"`
+	Key       string `json:"key,omitempty"`
+	Remote    string `json:"remote,omitempty"`
+
+	Hit     bool `json:"hit"`
+	Skipped bool `json:"skipped"`
+	DryRun  bool `json:"dry_run,omitempty"`
+
+	Size             int64   `json:"size_bytes"`
+	Transferred      int64   `json:"transferred_bytes"`
+	CompressionRatio float64 `json:"compression_ratio,omitempty"`
+	Duration         float64 `json:"duration_seconds"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// Report records results of cache operations of a single run, it is safe for concurrent use.
+type Report struct {
+	mu sync.Mutex
+
+	Build   Build       `json:"build"`
+	Backend string      `json:"backend"`
+	Config  interface{} `json:"config"`
+
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Duration float64   `json:"duration_seconds"`
+
+	Keys   []string `json:"keys"`
+	Mounts []Mount  `json:"mounts"`
+
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// New creates a report of a run started now, with the given configuration.
+// Secrets must be redacted from the configuration by the caller.
+func New(b Build, backend string, config interface{}) *Report {
+	return &Report{Build: b, Backend: backend, Config: config, Started: time.Now(), Keys: []string{}, Mounts: []Mount{}}
+}
+
+// Record records the result of a rebuilt or restored mount.
+func (r *Report) Record(res cache.Result) {
+	m := Mount{
+		Mount:       res.Mount,
+		Operation:   res.Operation,
+		Key:         res.Key,
+		Remote:      res.Remote,
+		Hit:         res.Hit,
+		Skipped:     res.Skipped,
+		DryRun:      res.DryRun,
+		Size:        res.Size,
+		Transferred: res.Transferred,
+		Duration:    res.Duration.Seconds(),
+	}
+
+	if res.Size > 0 {
+		m.CompressionRatio = float64(res.Transferred) / float64(res.Size)
+	}
+
+	if res.Err != nil {
+		m.Error = res.Err.Error()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Mounts = append(r.Mounts, m)
+
+	if res.Key != "" && !contains(r.Keys, res.Key) {
+		r.Keys = append(r.Keys, res.Key)
+	}
+}
+
+// Finish marks the run as finished now, with the given error if it failed.
+func (r *Report) Finish(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Finished = time.Now()
+	r.Duration = r.Finished.Sub(r.Started).Seconds()
+	r.Success = err == nil
+
+	if err != nil {
+		r.Error = strings.TrimSpace(err.Error())
+	}
+}
+
+// Write writes the report as indented JSON to the given writer.
+func (r *Report) Write(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode report, %w", err)
+	}
+
+	if _, err := w.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("write report, %w", err)
+	}
+
+	return nil
+}
+
+// WriteFile writes the report to the file at the given path, or to the standard output if the path is Stdout.
+func (r *Report) WriteFile(path string) error {
+	if path == Stdout {
+		return r.Write(os.Stdout)
+	}
+
+	var buf bytes.Buffer
+	if err := r.Write(&buf); err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil { //nolint:gosec
+		return fmt.Errorf("write report to <%s>, %w", path, err)
+	}
+
+	return nil
+}
+
+// Helpers
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
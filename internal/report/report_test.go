@@ -0,0 +1,91 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/meltwater/drone-cache/cache"
+	"github.com/meltwater/drone-cache/test"
+)
+
+func TestReport(t *testing.T) {
+	t.Parallel()
+
+	// Setup
+	r := New(Build{Repo: "meltwater/drone-cache", Number: 42}, "s3", map[string]string{"bucket": "cache"})
+
+	r.Record(cache.Result{
+		Operation: cache.OperationRestore, Mount: "node_modules", Key: "key", Remote: "repo/key/node_modules",
+		Hit: true, Size: 400, Transferred: 100, Duration: 2 * time.Second,
+	})
+	r.Record(cache.Result{
+		Operation: cache.OperationRestore, Mount: "vendor", Key: "fallback", Remote: "repo/fallback/vendor",
+		Err: errors.New("download failed"),
+	})
+	r.Record(cache.Result{Operation: cache.OperationRestore, Mount: ".cache"})
+	r.Finish(errors.New("restore cache, download failed\n"))
+
+	// Run
+	var buf bytes.Buffer
+	test.Ok(t, r.Write(&buf))
+
+	// Test
+	var got struct {
+		Build   Build
+		Backend string
+		Config  map[string]string
+		Keys    []string
+		Mounts  []map[string]interface{}
+		Success bool
+		Error   string
+	}
+
+	test.Ok(t, json.Unmarshal(buf.Bytes(), &got))
+
+	test.Equals(t, 42, got.Build.Number)
+	test.Equals(t, "s3", got.Backend)
+	test.Equals(t, "cache", got.Config["bucket"])
+	test.Equals(t, []string{"key", "fallback"}, got.Keys)
+	test.Equals(t, false, got.Success)
+	test.Equals(t, "restore cache, download failed", got.Error)
+
+	test.Equals(t, 3, len(got.Mounts))
+	test.Equals(t, true, got.Mounts[0]["hit"])
+	test.Equals(t, 0.25, got.Mounts[0]["compression_ratio"])
+	test.Equals(t, 2.0, got.Mounts[0]["duration_seconds"])
+	test.Equals(t, "download failed", got.Mounts[1]["error"])
+	test.Equals(t, false, got.Mounts[2]["hit"])
+
+	_, ok := got.Mounts[2]["key"]
+	test.Assert(t, !ok, "missed mount has a key")
+}
+
+func TestWriteFile(t *testing.T) {
+	t.Parallel()
+
+	// Setup
+	dir, cleanup := test.CreateTempDir(t, "report")
+	t.Cleanup(cleanup)
+
+	path := filepath.Join(dir, "report.json")
+
+	r := New(Build{}, "filesystem", nil)
+	r.Finish(nil)
+
+	// Run
+	test.Ok(t, r.WriteFile(path))
+
+	// Test
+	b, err := ioutil.ReadFile(path)
+	test.Ok(t, err)
+
+	var got Report
+	test.Ok(t, json.Unmarshal(b, &got))
+	test.Equals(t, true, got.Success)
+	test.Equals(t, []Mount{}, got.Mounts)
+}
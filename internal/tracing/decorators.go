@@ -0,0 +1,255 @@
+package tracing
+
+import (
+	"io"
+
+	"github.com/meltwater/drone-cache/archive"
+	"github.com/meltwater/drone-cache/cache"
+	"github.com/meltwater/drone-cache/key"
+	"github.com/meltwater/drone-cache/storage"
+	"github.com/meltwater/drone-cache/storage/common"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Cache decorates the cache with spans of rebuild, restore and flush operations.
+func (t *Tracer) Cache(c cache.Cache) cache.Cache {
+	if t == nil {
+		return c
+	}
+
+	return &tracedCache{c: c, t: t}
+}
+
+type tracedCache struct {
+	c cache.Cache
+	t *Tracer
+}
+
+func (c *tracedCache) Rebuild(srcs []string) error {
+	return c.run("cache.rebuild", srcs, c.c.Rebuild)
+}
+
+func (c *tracedCache) Restore(dsts []string) error {
+	return c.run("cache.restore", dsts, c.c.Restore)
+}
+
+func (c *tracedCache) Flush(srcs []string) error {
+	return c.run("cache.flush", srcs, c.c.Flush)
+}
+
+func (c *tracedCache) run(name string, mounts []string, fn func([]string) error) (err error) {
+	ctx, span := c.t.start(name, trace.WithAttributes(attribute.StringSlice("cache.mounts", mounts)))
+	defer func() { end(span, err) }()
+
+	defer c.t.enter(ctx)()
+
+	return fn(mounts)
+}
+
+// Mounts returns a cache tracer that starts a span for each rebuilt or restored mount,
+// the spans of its archive and storage calls are children of the span.
+func (t *Tracer) Mounts() cache.Tracer {
+	if t == nil {
+		return nil
+	}
+
+	return tracedMounts{t: t}
+}
+
+type tracedMounts struct {
+	t *Tracer
+}
+
+func (m tracedMounts) StartMount(operation, mount string, s storage.Storage, a archive.Archive) (storage.Storage, archive.Archive, func(cache.Result)) {
+	ctx, span := m.t.start("cache."+operation+".mount", trace.WithAttributes(attribute.String("cache.mount", mount)))
+	t := &Tracer{tracer: m.t.tracer, ctx: ctx}
+
+	return t.scopeStorage(s), t.scopeArchive(a), func(res cache.Result) {
+		span.SetAttributes(
+			attribute.String("cache.remote", res.Remote),
+			attribute.Bool("cache.hit", res.Hit),
+			attribute.Bool("cache.skipped", res.Skipped),
+			attribute.Int64("cache.size", res.Size),
+			attribute.Int64("cache.transferred", res.Transferred),
+		)
+		end(span, res.Err)
+	}
+}
+
+// wrapper is implemented by storages on top of another storage, such as chunked.Storage.
+type wrapper interface {
+	// Unwrap returns the underlying storage.
+	Unwrap() storage.Storage
+	// Wrap returns a copy of the storage on top of the given storage.
+	Wrap(storage.Storage) storage.Storage
+}
+
+// scopeStorage returns the storage with its decorators, including the underlying ones, traced by the tracer.
+func (t *Tracer) scopeStorage(s storage.Storage) storage.Storage {
+	switch s := s.(type) {
+	case *tracedStorage:
+		return &tracedStorage{s: s.s, t: t}
+	case wrapper:
+		return s.Wrap(t.scopeStorage(s.Unwrap()))
+	default:
+		return s
+	}
+}
+
+// scopeArchive returns the archive with its decorator traced by the tracer.
+func (t *Tracer) scopeArchive(a archive.Archive) archive.Archive {
+	if a, ok := a.(*tracedArchive); ok {
+		return &tracedArchive{a: a.a, t: t}
+	}
+
+	return a
+}
+
+// Archive decorates the archive with spans of create and extract operations.
+func (t *Tracer) Archive(a archive.Archive) archive.Archive {
+	if t == nil {
+		return a
+	}
+
+	return &tracedArchive{a: a, t: t}
+}
+
+type tracedArchive struct {
+	a archive.Archive
+	t *Tracer
+}
+
+func (a *tracedArchive) Create(srcs []string, w io.Writer) (n int64, err error) {
+	_, span := a.t.start("archive.create", trace.WithAttributes(attribute.StringSlice("archive.sources", srcs)))
+	defer func() {
+		span.SetAttributes(attribute.Int64("archive.bytes", n))
+		end(span, err)
+	}()
+
+	return a.a.Create(srcs, w)
+}
+
+func (a *tracedArchive) Extract(dst string, r io.Reader) (n int64, err error) {
+	_, span := a.t.start("archive.extract", trace.WithAttributes(attribute.String("archive.destination", dst)))
+	defer func() {
+		span.SetAttributes(attribute.Int64("archive.bytes", n))
+		end(span, err)
+	}()
+
+	return a.a.Extract(dst, r)
+}
+
+// Storage decorates the storage with spans of each backend call.
+func (t *Tracer) Storage(s storage.Storage) storage.Storage {
+	if t == nil {
+		return s
+	}
+
+	return &tracedStorage{s: s, t: t}
+}
+
+type tracedStorage struct {
+	s storage.Storage
+	t *Tracer
+}
+
+func (s *tracedStorage) Get(p string, w io.Writer) (err error) {
+	_, span := s.t.start("storage.get", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attribute.String("storage.key", p)))
+
+	cw := &countingWriter{w: w}
+	defer func() {
+		span.SetAttributes(attribute.Int64("storage.bytes", cw.n))
+		end(span, err)
+	}()
+
+	return s.s.Get(p, cw)
+}
+
+func (s *tracedStorage) Put(p string, r io.Reader) (err error) {
+	_, span := s.t.start("storage.put", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attribute.String("storage.key", p)))
+
+	cr := &countingReader{r: r}
+	defer func() {
+		span.SetAttributes(attribute.Int64("storage.bytes", cr.n))
+		end(span, err)
+	}()
+
+	return s.s.Put(p, cr)
+}
+
+func (s *tracedStorage) Exists(p string) (_ bool, err error) {
+	_, span := s.t.start("storage.exists", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attribute.String("storage.key", p)))
+	defer func() { end(span, err) }()
+
+	return s.s.Exists(p)
+}
+
+func (s *tracedStorage) List(p string) (_ []common.FileEntry, err error) {
+	_, span := s.t.start("storage.list", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attribute.String("storage.key", p)))
+	defer func() { end(span, err) }()
+
+	return s.s.List(p)
+}
+
+func (s *tracedStorage) Delete(p string) (err error) {
+	_, span := s.t.start("storage.delete", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attribute.String("storage.key", p)))
+	defer func() { end(span, err) }()
+
+	return s.s.Delete(p)
+}
+
+// Generator decorates the key generator with spans of key generation.
+func (t *Tracer) Generator(g key.Generator) key.Generator {
+	if t == nil || g == nil {
+		return g
+	}
+
+	return &tracedGenerator{g: g, t: t}
+}
+
+type tracedGenerator struct {
+	g key.Generator
+	t *Tracer
+}
+
+func (g *tracedGenerator) Generate(parts ...string) (k string, err error) {
+	_, span := g.t.start("key.generate")
+	defer func() {
+		span.SetAttributes(attribute.String("cache.key", k))
+		end(span, err)
+	}()
+
+	return g.g.Generate(parts...)
+}
+
+func (g *tracedGenerator) Check() error {
+	return g.g.Check()
+}
+
+// Helpers
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+
+	return n, err
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+
+	return n, err
+}
@@ -0,0 +1,84 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+)
+
+// NOTICE: Headers, timeouts, compression and certificates are read from the standard OTEL_EXPORTER_OTLP_* environment
+// variables by the exporters themselves.
+
+const (
+	// ProtocolHTTPProtobuf is the OTLP/HTTP protocol in binary protobuf encoding, the default.
+	ProtocolHTTPProtobuf = "http/protobuf"
+	// ProtocolGRPC is the OTLP/gRPC protocol.
+	ProtocolGRPC = "grpc"
+
+	tracesPath = "/v1/traces"
+)
+
+// NewExporterFromEnv creates an OTLP exporter configured by the standard OTEL_EXPORTER_OTLP_* environment variables.
+func NewExporterFromEnv(ctx context.Context) (*otlptrace.Exporter, error) {
+	if env("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "OTEL_EXPORTER_OTLP_ENDPOINT") == "" {
+		return nil, fmt.Errorf("neither OTEL_EXPORTER_OTLP_TRACES_ENDPOINT nor OTEL_EXPORTER_OTLP_ENDPOINT is set")
+	}
+
+	switch p := env("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", "OTEL_EXPORTER_OTLP_PROTOCOL"); p {
+	case "", ProtocolHTTPProtobuf:
+		opts, err := httpOptions()
+		if err != nil {
+			return nil, err
+		}
+
+		return otlptracehttp.New(ctx, opts...)
+	case ProtocolGRPC:
+		return otlptracegrpc.New(ctx)
+	default:
+		return nil, fmt.Errorf("unsupported OTLP protocol <%s>, only <%s> and <%s> are supported", p, ProtocolHTTPProtobuf, ProtocolGRPC)
+	}
+}
+
+// httpOptions resolves the traces URL of the OTLP/HTTP exporter from the endpoint environment variables.
+// NOTICE: OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is used as is,
+// while the traces path is appended to OTEL_EXPORTER_OTLP_ENDPOINT as the specification requires.
+func httpOptions() ([]otlptracehttp.Option, error) {
+	raw, p := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"), ""
+	if raw == "" {
+		raw = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		p = tracesPath
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint <%s>", raw)
+	}
+
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(u.Host),
+		otlptracehttp.WithURLPath(strings.TrimSuffix(u.Path, "/") + p),
+	}
+
+	if u.Scheme == "http" {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+
+	return opts, nil
+}
+
+// env returns the value of the first environment variable that is set.
+func env(keys ...string) string {
+	for _, k := range keys {
+		if v := os.Getenv(k); v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,115 @@
+// Package tracing instruments cache operations with OpenTelemetry spans,
+// by decorating caches, archives, storages and key generators.
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdkresource "go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// DefaultServiceName is the service name of the spans, unless OTEL_SERVICE_NAME is set.
+	DefaultServiceName = "drone-cache"
+
+	instrumentationName = "github.com/meltwater/drone-cache"
+)
+
+// Enabled reports whether tracing is configured by the environment.
+func Enabled() bool {
+	if disabled, _ := strconv.ParseBool(os.Getenv("OTEL_SDK_DISABLED")); disabled {
+		return false
+	}
+
+	return env("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "OTEL_EXPORTER_OTLP_ENDPOINT") != ""
+}
+
+// Setup creates a tracer that exports spans as configured by the standard OTEL_* environment variables,
+// as children of the trace context of the CI environment if present, and a function to flush the spans.
+func Setup(ctx context.Context) (*Tracer, func(context.Context) error, error) {
+	exp, err := NewExporterFromEnv(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// NOTICE: Later detectors override earlier ones, so OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES take precedence.
+	res, err := sdkresource.New(ctx,
+		sdkresource.WithAttributes(attribute.String("service.name", DefaultServiceName)),
+		sdkresource.WithTelemetrySDK(),
+		sdkresource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp), sdktrace.WithResource(res))
+
+	return New(FromEnvironment(ctx), tp), tp.Shutdown, nil
+}
+
+// FromEnvironment returns a context with the trace context propagated by the CI environment,
+// through the TRACEPARENT and TRACESTATE environment variables.
+func FromEnvironment(ctx context.Context) context.Context {
+	h := http.Header{}
+	h.Set("traceparent", os.Getenv("TRACEPARENT"))
+	h.Set("tracestate", os.Getenv("TRACESTATE"))
+
+	return propagation.TraceContext{}.Extract(ctx, propagation.HeaderCarrier(h))
+}
+
+// Tracer creates spans of cache operations. A nil Tracer does not decorate anything.
+// NOTICE: Archives and storages do not receive a context, so their spans are children of the running cache operation,
+// unless they are scoped to a mount, see Mounts.
+type Tracer struct {
+	tracer trace.Tracer
+
+	mu  sync.RWMutex
+	ctx context.Context
+}
+
+// New creates a tracer with spans that are children of the given context.
+func New(ctx context.Context, tp trace.TracerProvider) *Tracer {
+	return &Tracer{tracer: tp.Tracer(instrumentationName), ctx: ctx}
+}
+
+// start starts a span as a child of the running operation.
+func (t *Tracer) start(name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	t.mu.RLock()
+	parent := t.ctx
+	t.mu.RUnlock()
+
+	return t.tracer.Start(parent, name, opts...)
+}
+
+// enter sets the context of the running operation, returns a function to restore the previous one.
+func (t *Tracer) enter(ctx context.Context) func() {
+	t.mu.Lock()
+	prev := t.ctx
+	t.ctx = ctx
+	t.mu.Unlock()
+
+	return func() {
+		t.mu.Lock()
+		t.ctx = prev
+		t.mu.Unlock()
+	}
+}
+
+// end records the error, if any, and ends the span.
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
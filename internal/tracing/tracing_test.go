@@ -0,0 +1,298 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/meltwater/drone-cache/archive"
+	"github.com/meltwater/drone-cache/cache"
+	"github.com/meltwater/drone-cache/storage"
+	"github.com/meltwater/drone-cache/storage/chunked"
+	"github.com/meltwater/drone-cache/storage/common"
+	"github.com/meltwater/drone-cache/test"
+
+	"github.com/go-kit/kit/log"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	traceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	traceID     = "4bf92f3577b34da6a3ce929d0e0e4736"
+)
+
+func TestDecorators(t *testing.T) {
+	setenv(t, "TRACEPARENT", traceParent)
+
+	var (
+		sr     = tracetest.NewSpanRecorder()
+		tracer = New(FromEnvironment(context.Background()), sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+		s      = tracer.Storage(&fakeStorage{})
+		a      = tracer.Archive(fakeArchive{})
+		mounts = tracer.Mounts()
+	)
+
+	c := tracer.Cache(&fakeCache{rebuild: func(srcs []string) error {
+		s, a, end := mounts.StartMount(cache.OperationRebuild, srcs[0], s, a)
+
+		var buf bytes.Buffer
+		if _, err := a.Create(srcs, &buf); err != nil {
+			return err
+		}
+
+		if err := s.Put("repo/key/mount", &buf); err != nil {
+			return err
+		}
+
+		end(cache.Result{Operation: cache.OperationRebuild, Mount: srcs[0], Transferred: 5})
+
+		return nil
+	}, flush: func([]string) error {
+		_, err := s.Exists("repo/key/missing")
+		return err
+	}})
+
+	// Run
+	test.Ok(t, c.Rebuild([]string{"mount"}))
+	test.NotOk(t, c.Flush(nil))
+
+	// Test
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range sr.Ended() {
+		spans[s.Name()] = s
+	}
+
+	test.Equals(t, 6, len(spans))
+
+	root := spans["cache.rebuild"]
+	test.Equals(t, traceID, root.SpanContext().TraceID().String())
+	test.Equals(t, "00f067aa0ba902b7", root.Parent().SpanID().String())
+
+	mount, ok := spans["cache.rebuild.mount"]
+	test.Assert(t, ok, "mount span is not recorded")
+	test.Equals(t, root.SpanContext().SpanID(), mount.Parent().SpanID())
+
+	for _, name := range []string{"archive.create", "storage.put"} {
+		s, ok := spans[name]
+		test.Assert(t, ok, "span <%s> is not recorded", name)
+		test.Equals(t, mount.SpanContext().SpanID(), s.Parent().SpanID())
+	}
+
+	flush := spans["cache.flush"]
+	test.Equals(t, flush.SpanContext().SpanID(), spans["storage.exists"].Parent().SpanID())
+	test.Equals(t, "Error", spans["storage.exists"].Status().Code.String())
+	test.Equals(t, "Error", flush.Status().Code.String())
+
+	attrs := map[string]int64{}
+	for _, kv := range mount.Attributes() {
+		attrs[string(kv.Key)] = kv.Value.AsInt64()
+	}
+
+	test.Equals(t, int64(5), attrs["cache.transferred"])
+}
+
+func TestChunkedMount(t *testing.T) {
+	t.Parallel()
+
+	var (
+		sr     = tracetest.NewSpanRecorder()
+		tracer = New(context.Background(), sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+		s      = chunked.New(log.NewNopLogger(), tracer.Storage(&fakeStorage{}))
+	)
+
+	// Run
+	ms, _, end := tracer.Mounts().StartMount(cache.OperationRestore, "mount", s, nil)
+	test.NotOk(t, ms.Get("repo/key/mount", ioutil.Discard))
+	end(cache.Result{Operation: cache.OperationRestore, Mount: "mount"})
+
+	// Test
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range sr.Ended() {
+		spans[s.Name()] = s
+	}
+
+	mount, ok := spans["cache.restore.mount"]
+	test.Assert(t, ok, "mount span is not recorded")
+
+	get, ok := spans["storage.get"]
+	test.Assert(t, ok, "storage span under the chunked storage is not recorded")
+	test.Equals(t, mount.SpanContext().SpanID(), get.Parent().SpanID())
+}
+
+func TestNilTracer(t *testing.T) {
+	t.Parallel()
+
+	var tracer *Tracer
+
+	s := &fakeStorage{}
+	test.Assert(t, tracer.Storage(s) == storage.Storage(s), "nil tracer decorates storage")
+	test.Assert(t, tracer.Archive(fakeArchive{}) == archive.Archive(fakeArchive{}), "nil tracer decorates archive")
+	test.Assert(t, tracer.Mounts() == nil, "nil tracer creates mount tracer")
+}
+
+func TestExporter(t *testing.T) {
+	var (
+		req    coltracepb.ExportTraceServiceRequest
+		header http.Header
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		test.Equals(t, "/v1/traces", r.URL.Path)
+
+		b, err := ioutil.ReadAll(r.Body)
+		test.Ok(t, err)
+		test.Ok(t, proto.Unmarshal(b, &req))
+	}))
+	t.Cleanup(srv.Close)
+
+	setenv(t, "OTEL_EXPORTER_OTLP_ENDPOINT", srv.URL+"/")
+	setenv(t, "OTEL_EXPORTER_OTLP_HEADERS", "authorization=Bearer%20token,x-team=ci")
+	setenv(t, "TRACEPARENT", traceParent)
+
+	exp, err := NewExporterFromEnv(context.Background())
+	test.Ok(t, err)
+
+	var (
+		sr     = tracetest.NewSpanRecorder()
+		tracer = New(FromEnvironment(context.Background()), sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	)
+
+	test.NotOk(t, tracer.Storage(&fakeStorage{}).Put("key", strings.NewReader("data")))
+	test.Ok(t, exp.ExportSpans(context.Background(), sr.Ended()))
+	test.Ok(t, exp.Shutdown(context.Background()))
+
+	test.Equals(t, "Bearer token", header.Get("Authorization"))
+	test.Equals(t, "ci", header.Get("X-Team"))
+	test.Equals(t, "application/x-protobuf", header.Get("Content-Type"))
+
+	test.Equals(t, 1, len(req.ResourceSpans))
+	test.Equals(t, 1, len(req.ResourceSpans[0].InstrumentationLibrarySpans))
+
+	spans := req.ResourceSpans[0].InstrumentationLibrarySpans[0].Spans
+	test.Equals(t, 1, len(spans))
+
+	s := spans[0]
+	test.Equals(t, "storage.put", s.Name)
+	test.Equals(t, traceID, hex.EncodeToString(s.TraceId))
+	test.Equals(t, "00f067aa0ba902b7", hex.EncodeToString(s.ParentSpanId))
+	test.Equals(t, tracepb.Span_SPAN_KIND_CLIENT, s.Kind)
+	test.Equals(t, tracepb.Status_STATUS_CODE_ERROR, s.Status.Code)
+
+	attrs := map[string]*commonpb.AnyValue{}
+	for _, kv := range s.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+
+	test.Equals(t, "key", attrs["storage.key"].GetStringValue())
+	test.Equals(t, int64(4), attrs["storage.bytes"].GetIntValue())
+}
+
+func TestExporterFromEnv(t *testing.T) {
+	setenv(t, "OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	setenv(t, "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	setenv(t, "OTEL_EXPORTER_OTLP_PROTOCOL", "")
+
+	test.Assert(t, !Enabled(), "tracing is enabled without an endpoint")
+
+	_, err := NewExporterFromEnv(context.Background())
+	test.NotOk(t, err)
+
+	setenv(t, "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "http://collector:4318/custom")
+	test.Assert(t, Enabled(), "tracing is not enabled with an endpoint")
+
+	for protocol, ok := range map[string]bool{
+		"":                   true,
+		ProtocolHTTPProtobuf: true,
+		ProtocolGRPC:         true,
+		"http/json":          false,
+	} {
+		setenv(t, "OTEL_EXPORTER_OTLP_PROTOCOL", protocol)
+
+		exp, err := NewExporterFromEnv(context.Background())
+		if !ok {
+			test.NotOk(t, err)
+			continue
+		}
+
+		test.Ok(t, err)
+		test.Ok(t, exp.Shutdown(context.Background()))
+	}
+
+	setenv(t, "OTEL_SDK_DISABLED", "true")
+	test.Assert(t, !Enabled(), "tracing is enabled when SDK is disabled")
+}
+
+// Helpers
+
+func setenv(t *testing.T, k, v string) {
+	t.Helper()
+
+	prev, ok := os.LookupEnv(k)
+	test.Ok(t, os.Setenv(k, v))
+
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(k, prev)
+			return
+		}
+
+		os.Unsetenv(k)
+	})
+}
+
+type fakeCache struct {
+	rebuild func([]string) error
+	flush   func([]string) error
+}
+
+func (c *fakeCache) Rebuild(srcs []string) error { return c.rebuild(srcs) }
+func (c *fakeCache) Restore(dsts []string) error { return nil }
+func (c *fakeCache) Flush(srcs []string) error   { return c.flush(srcs) }
+
+type fakeArchive struct{}
+
+func (fakeArchive) Create(srcs []string, w io.Writer) (int64, error) {
+	n, err := w.Write([]byte(strings.Join(srcs, ",")))
+	return int64(n), err
+}
+
+func (fakeArchive) Extract(dst string, r io.Reader) (int64, error) {
+	return io.Copy(ioutil.Discard, r)
+}
+
+// fakeStorage keeps the last put object, everything else fails.
+type fakeStorage struct {
+	data []byte
+}
+
+func (s *fakeStorage) Get(p string, w io.Writer) error {
+	_, err := w.Write(s.data)
+	return err
+}
+
+func (s *fakeStorage) Put(p string, r io.Reader) (err error) {
+	s.data, err = ioutil.ReadAll(r)
+	if err == nil && p == "key" {
+		err = errors.New("put failed")
+	}
+
+	return err
+}
+
+func (s *fakeStorage) Exists(p string) (bool, error)             { return false, errors.New("exists failed") }
+func (s *fakeStorage) List(p string) ([]common.FileEntry, error) { return nil, nil }
+func (s *fakeStorage) Delete(p string) error                     { return nil }
@@ -8,17 +8,18 @@ import (
 
 // Hash TODO
 type Hash struct {
+	algorithm    Algorithm
 	defaultParts []string
 }
 
-// NewHash TODO
-func NewHash(defaultParts ...string) *Hash {
-	return &Hash{defaultParts: defaultParts}
+// NewHash creates a new Key Generator that uses the digest of given parts with the given algorithm.
+func NewHash(algorithm Algorithm, defaultParts ...string) *Hash {
+	return &Hash{algorithm: algorithm, defaultParts: defaultParts}
 }
 
 // Generate generates key from given parts or templates as parameter.
 func (h *Hash) Generate(parts ...string) (string, error) {
-	key, err := hash(append(parts, h.defaultParts...)...)
+	key, err := hash(h.algorithm, append(parts, h.defaultParts...)...)
 	if err != nil {
 		return "", fmt.Errorf("generate hash key for mounted, %w", err)
 	}
@@ -30,11 +31,11 @@ func (h *Hash) Generate(parts ...string) (string, error) {
 func (h *Hash) Check() error { return nil }
 
 // hash generates a key based on given strings (ie. filename paths and branch).
-func hash(parts ...string) (string, error) {
+func hash(a Algorithm, parts ...string) (string, error) {
 	readers := make([]io.Reader, len(parts))
 	for i, p := range parts {
 		readers[i] = strings.NewReader(p)
 	}
 
-	return readerHasher(readers...)
+	return readerHasher(a, readers...)
 }
@@ -9,9 +9,36 @@ import (
 func TestGenerateHash(t *testing.T) {
 	t.Parallel()
 
-	actual, err := NewHash().Generate("hash")
+	for _, tt := range []struct {
+		algorithm Algorithm
+		expected  string
+	}{
+		{MD5, "0800fc577294c34e0b28ad2839435945"},
+		{SHA256, "sha256-d04b98f48e8f8bcc15c6ae5ac050801cd6dcfd428fb5f9e65c4e16e7807340fa"},
+		{BLAKE3, "blake3-b6716efe6829269249e48a93798c6e40058255c268f21566431b8e7ea7da3b15"},
+	} {
+		tt := tt
+		t.Run(string(tt.algorithm), func(t *testing.T) {
+			t.Parallel()
+
+			actual, err := NewHash(tt.algorithm).Generate("hash")
+			test.Ok(t, err)
+			test.Equals(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestParseAlgorithm(t *testing.T) {
+	t.Parallel()
+
+	a, err := ParseAlgorithm("")
+	test.Ok(t, err)
+	test.Equals(t, DefaultAlgorithm, a)
+
+	a, err = ParseAlgorithm("blake3")
 	test.Ok(t, err)
+	test.Equals(t, BLAKE3, a)
 
-	expected := "0800fc577294c34e0b28ad2839435945"
-	test.Equals(t, actual, expected)
+	_, err = ParseAlgorithm("crc32")
+	test.NotOk(t, err)
 }
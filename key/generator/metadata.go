@@ -4,6 +4,7 @@ import (
 	// #nosec
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -22,23 +23,20 @@ import (
 type Metadata struct {
 	logger log.Logger
 
-	tmpl    string
-	data    metadata.Metadata
-	funcMap template.FuncMap
+	tmpl      string
+	data      metadata.Metadata
+	algorithm Algorithm
+	now       func() time.Time
 }
 
-// NewMetadata creates a new Key Generator.
-func NewMetadata(logger log.Logger, tmpl string, data metadata.Metadata) *Metadata {
+// NewMetadata creates a new Key Generator, checksum function of the template uses the given algorithm.
+func NewMetadata(logger log.Logger, tmpl string, data metadata.Metadata, algorithm Algorithm) *Metadata {
 	return &Metadata{
-		logger: logger,
-		tmpl:   tmpl,
-		data:   data,
-		funcMap: template.FuncMap{
-			"checksum": checksumFunc(logger),
-			"epoch":    func() string { return strconv.FormatInt(time.Now().Unix(), 10) },
-			"arch":     func() string { return runtime.GOARCH },
-			"os":       func() string { return runtime.GOOS },
-		},
+		logger:    logger,
+		tmpl:      tmpl,
+		data:      data,
+		algorithm: algorithm,
+		now:       time.Now,
 	}
 }
 
@@ -66,19 +64,47 @@ func (g *Metadata) Generate(_ ...string) (string, error) {
 	return b.String(), nil
 }
 
-// Check checks if template is parsable.
+// Check checks if template is parsable and can be executed with the current metadata.
 func (g *Metadata) Check() error {
-	_, err := g.parseTemplate()
-	return err
+	t, err := g.parseTemplate()
+	if err != nil {
+		return fmt.Errorf("parse, <%s> as cache key template, %w", g.tmpl, err)
+	}
+
+	if err := t.Execute(ioutil.Discard, g.data); err != nil {
+		return fmt.Errorf("execute, <%s> as cache key template, %w", g.tmpl, err)
+	}
+
+	return nil
 }
 
 // Helpers
 
 func (g *Metadata) parseTemplate() (*template.Template, error) {
-	return template.New("cacheKey").Funcs(g.funcMap).Parse(g.tmpl)
+	return template.New("cacheKey").Funcs(g.funcMap()).Parse(g.tmpl)
+}
+
+// funcMap returns the functions available to cache key templates.
+func (g *Metadata) funcMap() template.FuncMap {
+	return template.FuncMap{
+		"checksum":   checksumFunc(g.logger, g.algorithm),
+		"epoch":      func() string { return strconv.FormatInt(g.now().Unix(), 10) },
+		"arch":       func() string { return runtime.GOARCH },
+		"os":         func() string { return runtime.GOOS },
+		"env":        os.Getenv,
+		"lower":      strings.ToLower,
+		"upper":      strings.ToUpper,
+		"trimPrefix": trimPrefixFunc,
+		"trimSuffix": trimSuffixFunc,
+		"replace":    replaceFunc,
+		"truncate":   truncateFunc,
+		"date":       dateFunc(g.now),
+		"weekOf":     weekOfFunc,
+		"sanitize":   sanitizeFunc,
+	}
 }
 
-func checksumFunc(logger log.Logger) func(string) string {
+func checksumFunc(logger log.Logger, algorithm Algorithm) func(string) string {
 	return func(p string) string {
 		path, err := filepath.Abs(filepath.Clean(p))
 		if err != nil {
@@ -94,7 +120,7 @@ func checksumFunc(logger log.Logger) func(string) string {
 
 		defer internal.CloseWithErrLogf(logger, f, "checksum close defer")
 
-		str, err := readerHasher(f)
+		str, err := readerHasher(algorithm, f)
 		if err != nil {
 			level.Error(logger).Log("cache key template/checksum could not generate hash")
 			return ""
@@ -103,3 +129,61 @@ func checksumFunc(logger log.Logger) func(string) string {
 		return str
 	}
 }
+
+// NOTICE: Arguments of string helpers are ordered to work with template pipelines,
+// e.g. {{ .Commit.Branch | trimPrefix "feature/" }}.
+
+func trimPrefixFunc(prefix, s string) string { return strings.TrimPrefix(s, prefix) }
+
+func trimSuffixFunc(suffix, s string) string { return strings.TrimSuffix(s, suffix) }
+
+func replaceFunc(old, repl, s string) string { return strings.ReplaceAll(s, old, repl) }
+
+// truncateFunc keeps the first n characters of the string, so that multi-byte characters are never split.
+func truncateFunc(n int, s string) string {
+	if n < 0 {
+		return s
+	}
+
+	for i := range s {
+		if n == 0 {
+			return s[:i]
+		}
+
+		n--
+	}
+
+	return s
+}
+
+func dateFunc(now func() time.Time) func(string) string {
+	return func(layout string) string {
+		return now().UTC().Format(layout)
+	}
+}
+
+// weekOfFunc returns ISO 8601 year and week of the given Unix epoch, e.g. 2020-W09.
+func weekOfFunc(epoch string) (string, error) {
+	sec, err := strconv.ParseInt(epoch, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("parse epoch <%s>, %w", epoch, err)
+	}
+
+	year, week := time.Unix(sec, 0).UTC().ISOWeek()
+
+	return fmt.Sprintf("%d-W%02d", year, week), nil
+}
+
+// sanitizeFunc replaces every character that is not safe to use in an object key with a dash.
+func sanitizeFunc(s string) string {
+	return strings.Trim(strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r == '-', r == '_', r == '.':
+			return r
+		default:
+			return '-'
+		}
+	}, s), "-.")
+}
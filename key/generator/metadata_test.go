@@ -1,8 +1,10 @@
 package generator
 
 import (
+	"os"
+	"runtime"
 	"testing"
-	"text/template"
+	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/meltwater/drone-cache/internal/metadata"
@@ -10,7 +12,8 @@ import (
 )
 
 func TestGenerate(t *testing.T) {
-	t.Parallel()
+	test.Ok(t, os.Setenv("DRONE_CACHE_TEST_GOVERSION", "go1.14"))
+	t.Cleanup(func() { os.Unsetenv("DRONE_CACHE_TEST_GOVERSION") })
 
 	l := log.NewNopLogger()
 
@@ -21,23 +24,32 @@ func TestGenerate(t *testing.T) {
 		{`{{ .Repo.Name }}`, "RepoName"},
 		{`{{ checksum "checksum_file_test.txt"}}`, "04a29c732ecbce101c1be44c948a50c6"},
 		{`{{ checksum "../../docs/drone_env_vars.md"}}`, "f8b5b7f96f3ffaa828e4890aab290e59"},
+		{`{{ checksum "checksum_file_test.txt" | trimPrefix "04a29c" }}`, "732ecbce101c1be44c948a50c6"},
 		{`{{ epoch }}`, "1550563151"},
-		{`{{ arch }}`, "amd64"},
-		{`{{ os }}`, "darwin"},
+		{`{{ arch }}`, runtime.GOARCH},
+		{`{{ os }}`, runtime.GOOS},
+		{`{{ env "DRONE_CACHE_TEST_GOVERSION" }}`, "go1.14"},
+		{`{{ .Commit.Branch | lower }}`, "feature/cache-keys"},
+		{`{{ .Commit.Branch | upper }}`, "FEATURE/CACHE-KEYS"},
+		{`{{ .Commit.Branch | trimPrefix "Feature/" }}`, "Cache-Keys"},
+		{`{{ .Commit.Branch | trimSuffix "-Keys" }}`, "Feature/Cache"},
+		{`{{ .Commit.Branch | replace "/" "_" }}`, "Feature_Cache-Keys"},
+		{`{{ .Commit.Sha | truncate 7 }}`, "0800fc5"},
+		{`{{ "größe" | truncate 3 }}`, "grö"},
+		{`{{ "日本語" | truncate 2 }}`, "日本"},
+		{`{{ "日本語" | truncate 5 }}`, "日本語"},
+		{`{{ date "2006-01" }}`, "2019-02"},
+		{`{{ weekOf epoch }}`, "2019-W08"},
+		{`{{ .Commit.Branch | sanitize }}`, "Feature-Cache-Keys"},
+		{`{{ sanitize "../other repo/" }}`, "other-repo"},
 	} {
 		tt := tt
 		t.Run(tt.given, func(t *testing.T) {
-			g := Metadata{
-				logger: l,
-				tmpl:   tt.given,
-				data:   metadata.Metadata{Repo: metadata.Repo{Name: "RepoName"}},
-				funcMap: template.FuncMap{
-					"checksum": checksumFunc(l),
-					"epoch":    func() string { return "1550563151" },
-					"arch":     func() string { return "amd64" },
-					"os":       func() string { return "darwin" },
-				},
-			}
+			g := NewMetadata(l, tt.given, metadata.Metadata{
+				Repo:   metadata.Repo{Name: "RepoName"},
+				Commit: metadata.Commit{Branch: "Feature/Cache-Keys", Sha: "0800fc577294c34e0b28ad2839435945"},
+			}, MD5)
+			g.now = func() time.Time { return time.Unix(1550563151, 0) }
 
 			actual, err := g.Generate(tt.given)
 			test.Ok(t, err)
@@ -59,23 +71,47 @@ func TestParseTemplate(t *testing.T) {
 		{`{{ epoch }}`},
 		{`{{ arch }}`},
 		{`{{ os }}`},
+		{`{{ env "GOVERSION" }}`},
+		{`{{ .Repo.Name | lower | truncate 4 }}`},
+		{`{{ weekOf epoch }}-{{ date "2006-01" }}`},
+		{`{{ .Repo.Name | sanitize }}`},
 	} {
 		tt := tt
 		t.Run(tt.given, func(t *testing.T) {
-			g := Metadata{
-				logger: l,
-				tmpl:   tt.given,
-				data:   metadata.Metadata{Repo: metadata.Repo{Name: "RepoName"}},
-				funcMap: template.FuncMap{
-					"checksum": checksumFunc(l),
-					"epoch":    func() string { return "1550563151" },
-					"arch":     func() string { return "amd64" },
-					"os":       func() string { return "darwin" },
-				},
-			}
+			g := NewMetadata(l, tt.given, metadata.Metadata{Repo: metadata.Repo{Name: "RepoName"}}, MD5)
 
 			_, err := g.parseTemplate()
 			test.Ok(t, err)
 		})
 	}
 }
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	l := log.NewNopLogger()
+
+	for _, tt := range []struct {
+		given string
+		ok    bool
+	}{
+		{`{{ .Repo.Name | sanitize }}`, true},
+		{`{{ weekOf epoch }}`, true},
+		{`{{ unknown }}`, false},
+		{`{{ .Repo.Unknown }}`, false},
+		{`{{ weekOf "not-an-epoch" }}`, false},
+	} {
+		tt := tt
+		t.Run(tt.given, func(t *testing.T) {
+			g := NewMetadata(l, tt.given, metadata.Metadata{Repo: metadata.Repo{Name: "RepoName"}}, MD5)
+
+			err := g.Check()
+			if tt.ok {
+				test.Ok(t, err)
+				return
+			}
+
+			test.NotOk(t, err)
+		})
+	}
+}
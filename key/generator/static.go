@@ -1,7 +1,13 @@
 package generator
 
-import "path/filepath"
+import (
+	"fmt"
+	"path/filepath"
 
+	"github.com/meltwater/drone-cache/key"
+)
+
+// Static TODO
 type Static struct {
 	defaultParts []string
 }
@@ -12,8 +18,20 @@ func NewStatic(defaultParts ...string) *Static {
 }
 
 // Generate generates key from given parts or templates as parameter.
+// Parts are validated individually, so that a part like a branch name can not escape its namespace.
 func (s *Static) Generate(parts ...string) (string, error) {
-	return filepath.Join(append(parts, s.defaultParts...)...), nil
+	all := append(parts, s.defaultParts...)
+	for _, p := range all {
+		if p == "" {
+			continue
+		}
+
+		if _, err := key.Sanitize(p); err != nil {
+			return "", fmt.Errorf("generate static key, %w", err)
+		}
+	}
+
+	return filepath.Join(all...), nil
 }
 
 // Check checks if generator functional.
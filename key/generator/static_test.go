@@ -0,0 +1,19 @@
+package generator
+
+import (
+	"testing"
+
+	"github.com/meltwater/drone-cache/key"
+	"github.com/meltwater/drone-cache/test"
+)
+
+func TestGenerateStatic(t *testing.T) {
+	t.Parallel()
+
+	actual, err := NewStatic("feature/cache").Generate("static")
+	test.Ok(t, err)
+	test.Equals(t, "static/feature/cache", actual)
+
+	_, err = NewStatic("feature/../../other-repo").Generate()
+	test.Expected(t, err, key.ErrInvalidKey)
+}
@@ -2,14 +2,58 @@ package generator
 
 import (
 	"crypto/md5" // #nosec
+	"crypto/sha256"
 	"fmt"
+	gohash "hash"
 	"io"
+
+	"lukechampine.com/blake3"
 )
 
-// readerHasher generic md5 hash generater from io.Reader.
-func readerHasher(readers ...io.Reader) (string, error) {
-	// Use go1.14 new hashmap functions.
-	h := md5.New() // #nosec
+// Algorithm is a digest algorithm used to generate keys.
+type Algorithm string
+
+const (
+	// MD5 is the legacy digest algorithm, its keys are not prefixed to keep existing keys valid.
+	MD5 Algorithm = "md5"
+	// SHA256 is the recommended digest algorithm for new configurations.
+	SHA256 Algorithm = "sha256"
+	// BLAKE3 is a fast digest algorithm, useful for huge files.
+	BLAKE3 Algorithm = "blake3"
+
+	// DefaultAlgorithm is used when no algorithm is specified.
+	DefaultAlgorithm = SHA256
+
+	blake3Size = 32
+)
+
+// ParseAlgorithm parses given digest algorithm name, empty name means the default algorithm.
+func ParseAlgorithm(s string) (Algorithm, error) {
+	switch a := Algorithm(s); a {
+	case "":
+		return DefaultAlgorithm, nil
+	case MD5, SHA256, BLAKE3:
+		return a, nil
+	default:
+		return "", fmt.Errorf("unknown hash algorithm <%s>", s)
+	}
+}
+
+func (a Algorithm) new() gohash.Hash {
+	switch a {
+	case SHA256:
+		return sha256.New()
+	case BLAKE3:
+		return blake3.New(blake3Size, nil)
+	default:
+		return md5.New() // #nosec
+	}
+}
+
+// readerHasher generic hash generator from io.Reader.
+// Digests other than MD5 are prefixed with the algorithm name, so that keys from different algorithms never collide.
+func readerHasher(a Algorithm, readers ...io.Reader) (string, error) {
+	h := a.new()
 
 	for _, r := range readers {
 		if _, err := io.Copy(h, r); err != nil {
@@ -17,5 +61,9 @@ func readerHasher(readers ...io.Reader) (string, error) {
 		}
 	}
 
-	return fmt.Sprintf("%x", h.Sum(nil)), nil
+	if a == MD5 || a == "" {
+		return fmt.Sprintf("%x", h.Sum(nil)), nil
+	}
+
+	return fmt.Sprintf("%s-%x", a, h.Sum(nil)), nil
 }
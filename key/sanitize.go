@@ -0,0 +1,83 @@
+package key
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+var (
+	// ErrInvalidKey is returned when a key can not be safely used as a storage path.
+	ErrInvalidKey = errors.New("invalid key")
+	// ErrKeyTooLong is returned when a key exceeds the limits of a storage backend.
+	ErrKeyTooLong = errors.New("key too long")
+)
+
+// Limits defines restrictions of a storage backend on object keys.
+// A zero value means no restriction.
+type Limits struct {
+	// MaxLength is the maximum length of a whole key in bytes.
+	MaxLength int
+	// MaxSegmentLength is the maximum length of a single slash separated segment in bytes.
+	MaxSegmentLength int
+}
+
+// Check checks if the given key is within the limits.
+func (l Limits) Check(k string) error {
+	if l.MaxLength > 0 && len(k) > l.MaxLength {
+		return fmt.Errorf("<%s> is %d bytes, maximum allowed is %d, %w", k, len(k), l.MaxLength, ErrKeyTooLong)
+	}
+
+	if l.MaxSegmentLength > 0 {
+		for _, s := range strings.Split(k, "/") {
+			if len(s) > l.MaxSegmentLength {
+				return fmt.Errorf("segment <%s> is %d bytes, maximum allowed is %d, %w",
+					s, len(s), l.MaxSegmentLength, ErrKeyTooLong)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Sanitize normalizes separators of the given key and rejects keys that could escape their namespace.
+// Backslashes are converted to slashes, empty and "." segments as well as leading and trailing slashes are removed.
+// Leading and trailing whitespace is removed and any other whitespace is replaced with underscores,
+// since backends treat it differently. Keys with ".." segments or control characters are rejected.
+func Sanitize(k string) (string, error) {
+	k = strings.TrimSpace(strings.ReplaceAll(k, `\`, "/"))
+
+	for _, r := range k {
+		if unicode.IsControl(r) {
+			return "", fmt.Errorf("<%q> contains control character, %w", k, ErrInvalidKey)
+		}
+	}
+
+	k = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return '_'
+		}
+
+		return r
+	}, k)
+
+	var segments []string
+
+	for _, s := range strings.Split(k, "/") {
+		switch s {
+		case "", ".":
+			continue
+		case "..":
+			return "", fmt.Errorf("<%s> contains parent directory segment, %w", k, ErrInvalidKey)
+		}
+
+		segments = append(segments, s)
+	}
+
+	if len(segments) == 0 {
+		return "", fmt.Errorf("<%s> is empty, %w", k, ErrInvalidKey)
+	}
+
+	return strings.Join(segments, "/"), nil
+}
@@ -0,0 +1,57 @@
+package key
+
+import (
+	"testing"
+
+	"github.com/meltwater/drone-cache/test"
+)
+
+func TestSanitize(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		given    string
+		expected string
+		err      error
+	}{
+		{"master", "master", nil},
+		{"feature/cache", "feature/cache", nil},
+		{"/leading/slash/", "leading/slash", nil},
+		{`windows\separator`, "windows/separator", nil},
+		{"double//./slash", "double/slash", nil},
+		{" spaces around ", "spaces_around", nil},
+		{"feature/with space", "feature/with_space", nil},
+		{"no\u00a0break\u2003space", "no_break_space", nil},
+		{"tab\tinside", "", ErrInvalidKey},
+		{"feature/../../other-repo", "", ErrInvalidKey},
+		{"..", "", ErrInvalidKey},
+		{"new\nline", "", ErrInvalidKey},
+		{"/./", "", ErrInvalidKey},
+		{"", "", ErrInvalidKey},
+	} {
+		tt := tt
+		t.Run(tt.given, func(t *testing.T) {
+			t.Parallel()
+
+			actual, err := Sanitize(tt.given)
+			if tt.err != nil {
+				test.Expected(t, err, tt.err)
+				return
+			}
+
+			test.Ok(t, err)
+			test.Equals(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestLimitsCheck(t *testing.T) {
+	t.Parallel()
+
+	l := Limits{MaxLength: 10, MaxSegmentLength: 4}
+
+	test.Ok(t, l.Check("abcd/efgh"))
+	test.Expected(t, l.Check("abcd/efgh/i"), ErrKeyTooLong)
+	test.Expected(t, l.Check("abcde"), ErrKeyTooLong)
+	test.Ok(t, Limits{}.Check("no limits at all"))
+}
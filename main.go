@@ -2,12 +2,15 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	stdlog "log"
 	"os"
 
 	"github.com/meltwater/drone-cache/archive"
+	"github.com/meltwater/drone-cache/cache"
 	"github.com/meltwater/drone-cache/internal"
 	"github.com/meltwater/drone-cache/internal/metadata"
+	"github.com/meltwater/drone-cache/internal/metrics"
 	"github.com/meltwater/drone-cache/internal/plugin"
 	"github.com/meltwater/drone-cache/storage"
 	"github.com/meltwater/drone-cache/storage/backend"
@@ -16,6 +19,7 @@ import (
 	"github.com/meltwater/drone-cache/storage/backend/gcs"
 	"github.com/meltwater/drone-cache/storage/backend/s3"
 	"github.com/meltwater/drone-cache/storage/backend/sftp"
+	"github.com/meltwater/drone-cache/storage/chunked"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
@@ -31,7 +35,8 @@ func main() {
 	app.Usage = "Drone cache plugin"
 	app.Action = run
 	app.Version = version
-	app.Flags = []cli.Flag{
+
+	flags := []cli.Flag{
 		// Logger flags
 
 		&cli.StringFlag{
@@ -47,6 +52,15 @@ func main() {
 			EnvVars: []string{"PLUGIN_LOG_FORMAT", "LOG_FORMAT"},
 		},
 
+		// Config file flags
+
+		&cli.StringFlag{
+			Name:    "config, cfg",
+			Usage:   "path of the YAML or JSON config file, flags and environment variables override its settings",
+			Value:   defaultConfigFile,
+			EnvVars: []string{"PLUGIN_CONFIG"},
+		},
+
 		// Repo flags
 
 		&cli.StringFlag{
@@ -119,6 +133,21 @@ func main() {
 			Usage:   "git commit branch",
 			EnvVars: []string{"DRONE_COMMIT_BRANCH"},
 		},
+		&cli.StringFlag{
+			Name:    "commit.source-branch, csb",
+			Usage:   "git source branch of the pull request",
+			EnvVars: []string{"DRONE_SOURCE_BRANCH"},
+		},
+		&cli.StringFlag{
+			Name:    "commit.target-branch, ctb",
+			Usage:   "git target branch of the pull request",
+			EnvVars: []string{"DRONE_TARGET_BRANCH"},
+		},
+		&cli.IntFlag{
+			Name:    "commit.pull-request, cpr",
+			Usage:   "pull request number",
+			EnvVars: []string{"DRONE_PULL_REQUEST"},
+		},
 		&cli.StringFlag{
 			Name:    "commit.message, cm",
 			Usage:   "git commit message",
@@ -217,6 +246,11 @@ func main() {
 			Usage:   "previous build sha",
 			EnvVars: []string{"DRONE_PREV_COMMIT_SHA"},
 		},
+		&cli.StringFlag{
+			Name:    "ci",
+			Usage:   "CI system to read metadata from outside of Drone (github-actions, gitlab, woodpecker, jenkins, buildkite, git), detected unless it is set",
+			EnvVars: []string{"PLUGIN_CI"},
+		},
 
 		// Config flags
 
@@ -231,6 +265,21 @@ func main() {
 			Usage:   "cache directories, an array of folders to cache",
 			EnvVars: []string{"PLUGIN_MOUNT"},
 		},
+		&cli.StringSliceFlag{
+			Name:    "exclude, exc",
+			Usage:   "gitignore style patterns, relative to local root, of the paths to exclude from cache",
+			EnvVars: []string{"PLUGIN_EXCLUDE"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "include, inc",
+			Usage:   "gitignore style patterns, relative to local root, of the excluded paths to include in cache",
+			EnvVars: []string{"PLUGIN_INCLUDE"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "incremental, inl",
+			Usage:   "mounts to cache file by file instead of as an archive, restore only downloads the files that differ",
+			EnvVars: []string{"PLUGIN_INCREMENTAL"},
+		},
 		&cli.BoolFlag{
 			Name:    "rebuild, reb",
 			Usage:   "rebuild the cache directories",
@@ -241,11 +290,37 @@ func main() {
 			Usage:   "restore the cache directories",
 			EnvVars: []string{"PLUGIN_RESTORE"},
 		},
+		&cli.BoolFlag{
+			Name:    "flush, fl",
+			Usage:   "remove caches of the namespace that are not modified for flush-ttl",
+			EnvVars: []string{"PLUGIN_FLUSH"},
+		},
+		&cli.DurationFlag{
+			Name:    "flush-ttl, ft",
+			Usage:   "age after which flush removes caches",
+			Value:   cache.DefaultFlushTTL,
+			EnvVars: []string{"PLUGIN_FLUSH_TTL"},
+		},
+		&cli.BoolFlag{
+			Name:    "dry-run, dry",
+			Usage:   "generate keys and look up caches, printing what would be restored, uploaded or flushed without writing anything",
+			EnvVars: []string{"PLUGIN_DRY_RUN"},
+		},
 		&cli.StringFlag{
 			Name:    "cache-key, chk",
-			Usage:   "cache key to use for the cache directories",
+			Usage:   "cache key template to use for the cache directories",
 			EnvVars: []string{"PLUGIN_CACHE_KEY"},
 		},
+		&cli.StringSliceFlag{
+			Name:    "restore-keys, rk",
+			Usage:   "fallback cache key templates to restore from in order, when no cache exists for the cache key",
+			EnvVars: []string{"PLUGIN_RESTORE_KEYS"},
+		},
+		&cli.StringFlag{
+			Name:    "hash-algorithm, ha",
+			Usage:   "digest algorithm to use for generated keys and checksums (md5, sha256, blake3), sha256 if unset, which also restores caches of md5 keys",
+			EnvVars: []string{"PLUGIN_HASH_ALGORITHM"},
+		},
 		&cli.StringFlag{
 			Name:    "remote-root, rr",
 			Usage:   "remote root directory to contain all the cache files created (default repo.name)",
@@ -262,6 +337,111 @@ func main() {
 			Value:   true,
 			EnvVars: []string{"PLUGIN_OVERRIDE"},
 		},
+		&cli.BoolFlag{
+			Name:    "hash-long-keys, hlk",
+			Usage:   "use hash of the cache key if it exceeds key length limits of the backend",
+			EnvVars: []string{"PLUGIN_HASH_LONG_KEYS"},
+		},
+		&cli.BoolFlag{
+			Name:    "skip-unchanged, su",
+			Usage:   "skip upload if fingerprint of the mount matches the stored one, refreshes changed caches regardless of override",
+			EnvVars: []string{"PLUGIN_SKIP_UNCHANGED"},
+		},
+		&cli.StringFlag{
+			Name:    "fingerprint, fp",
+			Usage:   "fingerprint mode to detect changes of the mounts, metadata (paths, sizes, modification times) or content",
+			Value:   cache.FingerprintMetadata,
+			EnvVars: []string{"PLUGIN_FINGERPRINT"},
+		},
+		&cli.BoolFlag{
+			Name:    "chunked, ch",
+			Usage:   "store archives as content-defined chunks shared by all keys, only missing chunks are uploaded and downloaded",
+			EnvVars: []string{"PLUGIN_CHUNKED"},
+		},
+		&cli.IntFlag{
+			Name:    "chunk-size, chs",
+			Usage:   "average size of the chunks in bytes when chunked is enabled",
+			Value:   chunked.DefaultAverageChunkSize,
+			EnvVars: []string{"PLUGIN_CHUNK_SIZE"},
+		},
+		&cli.StringFlag{
+			Name:    "chunk-cache, chc",
+			Usage:   "local directory to keep chunks in when chunked is enabled, chunks found in it are not downloaded",
+			EnvVars: []string{"PLUGIN_CHUNK_CACHE"},
+		},
+		&cli.StringSliceFlag{
+			Name: "archive-encryption-keys, aek",
+			Usage: `base64 encoded 32 bytes keys to encrypt archives with before upload, the first key encrypts,
+			all keys decrypt, which allows rotating keys (generate one with: openssl rand -base64 32)`,
+			EnvVars: []string{"PLUGIN_ARCHIVE_ENCRYPTION_KEYS"},
+		},
+		&cli.StringFlag{
+			Name:    "signing-key, sk",
+			Usage:   "base64 encoded ed25519 private key or seed to sign rebuilt caches with, only give it to trusted builds",
+			EnvVars: []string{"PLUGIN_SIGNING_KEY"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "trusted-keys, tk",
+			Usage:   "base64 encoded ed25519 public keys that restored caches must be signed by, unsigned or invalid caches are treated as a miss",
+			EnvVars: []string{"PLUGIN_TRUSTED_KEYS"},
+		},
+		&cli.BoolFlag{
+			Name:    "branch-scope, brs",
+			Usage:   "rebuild caches only for the current branch, restore from the current branch first then the default branch",
+			EnvVars: []string{"PLUGIN_BRANCH_SCOPE"},
+		},
+		&cli.Int64Flag{
+			Name:    "upload-rate-limit, url",
+			Usage:   "maximum upload rate of each mount in bytes per second, 0 means unlimited",
+			EnvVars: []string{"PLUGIN_UPLOAD_RATE_LIMIT"},
+		},
+		&cli.Int64Flag{
+			Name:    "download-rate-limit, drl",
+			Usage:   "maximum download rate of each mount in bytes per second, 0 means unlimited",
+			EnvVars: []string{"PLUGIN_DOWNLOAD_RATE_LIMIT"},
+		},
+		&cli.Int64Flag{
+			Name:    "rate-limit, trl",
+			Usage:   "maximum total transfer rate of all mounts in bytes per second, 0 means unlimited",
+			EnvVars: []string{"PLUGIN_RATE_LIMIT"},
+		},
+		&cli.IntFlag{
+			Name:    "max-concurrency, mc",
+			Usage:   "maximum number of mounts to rebuild or restore concurrently, 0 means all mounts at once",
+			EnvVars: []string{"PLUGIN_MAX_CONCURRENCY"},
+		},
+		&cli.IntFlag{
+			Name:    "compression-concurrency, cc",
+			Usage:   "maximum number of archives to compress or decompress concurrently across all mounts, 0 means unlimited",
+			EnvVars: []string{"PLUGIN_COMPRESSION_CONCURRENCY"},
+		},
+		&cli.DurationFlag{
+			Name:    "progress-interval, pi",
+			Usage:   "interval between progress logs of uploads and downloads, 0 disables progress logs",
+			Value:   cache.DefaultProgressInterval,
+			EnvVars: []string{"PLUGIN_PROGRESS_INTERVAL"},
+		},
+		&cli.StringFlag{
+			Name:    "metrics.textfile, mtf",
+			Usage:   "file to write metrics of the run to, in the format of the node exporter textfile collector",
+			EnvVars: []string{"PLUGIN_METRICS_TEXTFILE"},
+		},
+		&cli.StringFlag{
+			Name:    "metrics.pushgateway, mpg",
+			Usage:   "url of the Prometheus Pushgateway to push metrics of the run to",
+			EnvVars: []string{"PLUGIN_METRICS_PUSHGATEWAY"},
+		},
+		&cli.StringFlag{
+			Name:    "metrics.job, mj",
+			Usage:   "job name to push metrics with",
+			Value:   metrics.DefaultJob,
+			EnvVars: []string{"PLUGIN_METRICS_JOB"},
+		},
+		&cli.StringFlag{
+			Name:    "report, rep",
+			Usage:   "file to write a JSON report of the run to, with redacted config, keys and outcome of each mount, `-` for stdout",
+			EnvVars: []string{"PLUGIN_REPORT"},
+		},
 		// CACHE-KEYS
 		// REBUILD-KEYS
 		// RESTORE-KEYS
@@ -283,6 +463,32 @@ func main() {
 			Usage:   "skip symbolic links in archive",
 			EnvVars: []string{"PLUGIN_SKIP_SYMLINKS", "SKIP_SYMLINKS"},
 		},
+		&cli.BoolFlag{
+			Name:    "preserve-times, pt",
+			Usage:   "restore modification and access times of the files on extract",
+			Value:   true,
+			EnvVars: []string{"PLUGIN_PRESERVE_TIMES"},
+		},
+		&cli.BoolFlag{
+			Name:    "preserve-owner, po",
+			Usage:   "restore owner and group of the files on extract, only effective when running as root",
+			EnvVars: []string{"PLUGIN_PRESERVE_OWNER"},
+		},
+		&cli.BoolFlag{
+			Name:    "preserve-xattrs, px",
+			Usage:   "archive and restore extended attributes of the files (linux only)",
+			EnvVars: []string{"PLUGIN_PRESERVE_XATTRS"},
+		},
+		&cli.BoolFlag{
+			Name:    "reproducible, rpr",
+			Usage:   "create identical archives from identical sources, normalizes order, owner and modification times of the files",
+			EnvVars: []string{"PLUGIN_REPRODUCIBLE"},
+		},
+		&cli.Int64Flag{
+			Name:    "source-date-epoch, sde",
+			Usage:   "unix timestamp that modification times of the files are clamped to when reproducible is enabled",
+			EnvVars: []string{"PLUGIN_SOURCE_DATE_EPOCH", "SOURCE_DATE_EPOCH"},
+		},
 		&cli.BoolFlag{
 			Name:    "debug, d",
 			Usage:   "debug",
@@ -453,13 +659,51 @@ func main() {
 		},
 	}
 
+	app.Flags = flags
+	app.Commands = commands(flags)
+
 	if err := app.Run(os.Args); err != nil {
-		stdlog.Fatalf("%#v", err)
+		stdlog.Fatalf("%v", err)
 	}
 }
 
-//nolint:funlen
 func run(c *cli.Context) error {
+	plg, logger, err := newPlugin(c)
+	if err != nil {
+		return err
+	}
+
+	err = plg.Exec()
+	if err == nil {
+		return nil
+	}
+
+	if c.Bool("exit-code") {
+		// If it is exit-code enabled, always exit with error.
+		level.Warn(logger).Log("msg", "silent fails disabled, exiting with status code on error")
+
+		return err
+	}
+
+	var e plugin.Error
+	if errors.As(err, &e) {
+		// If it is an expected error log it, handle it gracefully,
+		level.Error(logger).Log("err", err)
+
+		return nil
+	}
+
+	return err
+}
+
+// newPlugin creates the plugin and its logger, configured by the config file and the flags.
+//
+//nolint:funlen
+func newPlugin(c *cli.Context) (*plugin.Plugin, log.Logger, error) {
+	if err := loadConfigFile(c); err != nil {
+		return nil, nil, err
+	}
+
 	var logLevel = c.String("log.level")
 	if c.Bool("debug") {
 		logLevel = internal.LogLevelDebug
@@ -490,12 +734,15 @@ func run(c *cli.Context) error {
 			Link:     c.String("build.link"),
 		},
 		Commit: metadata.Commit{
-			Remote:  c.String("remote.url"),
-			Sha:     c.String("commit.sha"),
-			Ref:     c.String("commit.sha"),
-			Link:    c.String("commit.link"),
-			Branch:  c.String("commit.branch"),
-			Message: c.String("commit.message"),
+			Remote:       c.String("remote.url"),
+			Sha:          c.String("commit.sha"),
+			Ref:          c.String("commit.sha"),
+			Link:         c.String("commit.link"),
+			Branch:       c.String("commit.branch"),
+			SourceBranch: c.String("commit.source-branch"),
+			TargetBranch: c.String("commit.target-branch"),
+			PullRequest:  c.Int("commit.pull-request"),
+			Message:      c.String("commit.message"),
 			Author: metadata.Author{
 				Name:   c.String("commit.author.name"),
 				Email:  c.String("commit.author.email"),
@@ -504,18 +751,54 @@ func run(c *cli.Context) error {
 		},
 	}
 
+	m, err := ciMetadata(c, logger, plg.Metadata)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	plg.Metadata = m
+
 	plg.Config = plugin.Config{
-		ArchiveFormat:    c.String("archive-format"),
-		Backend:          c.String("backend"),
-		CacheKeyTemplate: c.String("cache-key"),
-		CompressionLevel: c.Int("compression-level"),
-		Debug:            c.Bool("debug"),
-		Mount:            c.StringSlice("mount"),
-		Rebuild:          c.Bool("rebuild"),
-		Restore:          c.Bool("restore"),
-		RemoteRoot:       c.String("remote-root"),
-		LocalRoot:        c.String("local-root"),
-		Override:         c.Bool("override"),
+		ArchiveFormat:          c.String("archive-format"),
+		Backend:                c.String("backend"),
+		CacheKeyTemplate:       c.String("cache-key"),
+		RestoreKeyTemplates:    c.StringSlice("restore-keys"),
+		HashAlgorithm:          c.String("hash-algorithm"),
+		CompressionLevel:       c.Int("compression-level"),
+		Debug:                  c.Bool("debug"),
+		Mount:                  c.StringSlice("mount"),
+		Exclude:                c.StringSlice("exclude"),
+		Include:                c.StringSlice("include"),
+		Incremental:            c.StringSlice("incremental"),
+		Rebuild:                c.Bool("rebuild"),
+		Restore:                c.Bool("restore"),
+		Flush:                  c.Bool("flush"),
+		FlushTTL:               c.Duration("flush-ttl"),
+		DryRun:                 c.Bool("dry-run"),
+		RemoteRoot:             c.String("remote-root"),
+		LocalRoot:              c.String("local-root"),
+		Override:               c.Bool("override"),
+		HashLongKeys:           c.Bool("hash-long-keys"),
+		SkipUnchanged:          c.Bool("skip-unchanged"),
+		Fingerprint:            c.String("fingerprint"),
+		Chunked:                c.Bool("chunked"),
+		ChunkSize:              c.Int("chunk-size"),
+		ChunkCache:             c.String("chunk-cache"),
+		EncryptionKeys:         c.StringSlice("archive-encryption-keys"),
+		SigningKey:             c.String("signing-key"),
+		TrustedKeys:            c.StringSlice("trusted-keys"),
+		BranchScope:            c.Bool("branch-scope"),
+		UploadRateLimit:        c.Int64("upload-rate-limit"),
+		DownloadRateLimit:      c.Int64("download-rate-limit"),
+		RateLimit:              c.Int64("rate-limit"),
+		MaxConcurrency:         c.Int("max-concurrency"),
+		CompressionConcurrency: c.Int("compression-concurrency"),
+		ProgressInterval:       c.Duration("progress-interval"),
+
+		MetricsTextfile:    c.String("metrics.textfile"),
+		MetricsPushgateway: c.String("metrics.pushgateway"),
+		MetricsJob:         c.String("metrics.job"),
+		Report:             c.String("report"),
 
 		StorageOperationTimeout: c.Duration("backend.operation-timeout"),
 		FileSystem: filesystem.Config{
@@ -534,7 +817,7 @@ func run(c *cli.Context) error {
 		Azure: azure.Config{
 			AccountName:    c.String("azure.account-name"),
 			AccountKey:     c.String("azure.account-key"),
-			ContainerName:  c.String("azure.container-name"),
+			ContainerName:  c.String("azure.blob-container-name"),
 			BlobStorageURL: c.String("azure.blob-storage-url"),
 			Azurite:        false,
 			Timeout:        c.Duration("backend.operation-timeout"),
@@ -555,33 +838,41 @@ func run(c *cli.Context) error {
 			Bucket:     c.String("bucket"),
 			Endpoint:   c.String("endpoint"),
 			APIKey:     c.String("gcs.api-key"),
-			JSONKey:    c.String("gcsjson-key"),
+			JSONKey:    c.String("gcs.json-key"),
 			Encryption: c.String("gcs.encryption-key"),
 			Timeout:    c.Duration("backend.operation-timeout"),
 		},
 
-		SkipSymlinks: c.Bool("skip-symlinks"),
+		SkipSymlinks:    c.Bool("skip-symlinks"),
+		PreserveTimes:   c.Bool("preserve-times"),
+		PreserveOwner:   c.Bool("preserve-owner"),
+		PreserveXattrs:  c.Bool("preserve-xattrs"),
+		Reproducible:    c.Bool("reproducible"),
+		SourceDateEpoch: c.Int64("source-date-epoch"),
 	}
 
-	err := plg.Exec()
-	if err == nil {
-		return nil
-	}
-
-	if c.Bool("exit-code") {
-		// If it is exit-code enabled, always exit with error.
-		level.Warn(logger).Log("msg", "silent fails disabled, exiting with status code on error")
+	return plg, logger, nil
+}
 
-		return err
+// ciMetadata fills the metadata that is not given by Drone from the environment of the CI system that is set or detected,
+// or from the git repository of the workspace otherwise.
+func ciMetadata(c *cli.Context, logger log.Logger, m metadata.Metadata) (metadata.Metadata, error) {
+	ci := c.String("ci")
+	if ci == "" && m.Repo.Name != "" {
+		return m, nil
 	}
 
-	var e plugin.Error
-	if errors.As(err, &e) {
-		// If it is an expected error log it, handle it gracefully,
-		level.Error(logger).Log("err", err)
+	detected, provider, err := metadata.FromEnvironment(ci, os.Getenv, c.String("local-root"))
+	if errors.Is(err, metadata.ErrNotDetected) {
+		level.Warn(logger).Log("msg", "no CI system detected, cache keys are generated without metadata", "err", err)
+		return m, nil
+	}
 
-		return nil
+	if err != nil {
+		return m, fmt.Errorf("read metadata, %w", err)
 	}
 
-	return err
+	level.Info(logger).Log("msg", "metadata read from CI system", "ci", provider)
+
+	return metadata.Merge(m, detected), nil
 }
@@ -11,6 +11,7 @@ import (
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/meltwater/drone-cache/internal"
+	"github.com/meltwater/drone-cache/storage/common"
 )
 
 const (
@@ -136,3 +137,47 @@ func (b *Backend) Exists(ctx context.Context, p string) (bool, error) {
 	}
 	return get.StatusCode() == http.StatusOK, nil
 }
+
+// List lists the object at the given path and the objects under it.
+func (b *Backend) List(ctx context.Context, p string) ([]common.FileEntry, error) {
+	var entries []common.FileEntry
+
+	for marker := (azblob.Marker{}); marker.NotDone(); {
+		resp, err := b.containerURL.ListBlobsFlatSegment(ctx, marker, azblob.ListBlobsSegmentOptions{Prefix: p})
+		if err != nil {
+			return nil, fmt.Errorf("list the objects, %w", err)
+		}
+
+		for _, blob := range resp.Segment.BlobItems {
+			// NOTICE: Prefix also matches siblings that share it, such as "key-2" for "key".
+			if !common.IsUnder(blob.Name, p) {
+				continue
+			}
+
+			var size int64
+			if blob.Properties.ContentLength != nil {
+				size = *blob.Properties.ContentLength
+			}
+
+			entries = append(entries, common.FileEntry{Path: blob.Name, Size: size, LastModified: blob.Properties.LastModified})
+		}
+
+		marker = resp.NextMarker
+	}
+
+	return entries, nil
+}
+
+// Delete deletes the object at the given path.
+func (b *Backend) Delete(ctx context.Context, p string) error {
+	blobURL := b.containerURL.NewBlockBlobURL(p)
+	if _, err := blobURL.Delete(ctx, azblob.DeleteSnapshotsOptionInclude, azblob.BlobAccessConditions{}); err != nil {
+		if serr, ok := err.(azblob.StorageError); ok && serr.ServiceCode() == azblob.ServiceCodeBlobNotFound {
+			return nil
+		}
+
+		return fmt.Errorf("delete the object, %w", err)
+	}
+
+	return nil
+}
@@ -5,11 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 
+	"github.com/meltwater/drone-cache/key"
+	"github.com/meltwater/drone-cache/storage/common"
 	"github.com/meltwater/drone-cache/storage/backend/azure"
 	"github.com/meltwater/drone-cache/storage/backend/filesystem"
 	"github.com/meltwater/drone-cache/storage/backend/gcs"
@@ -30,14 +31,13 @@ const (
 	SFTP = "sftp"
 )
 
-// MOTICE: FileEntry needs a better place.
-
-// FileEntry defines a single cache item.
-type FileEntry struct {
-	Path         string
-	Size         int64
-	LastModified time.Time
-}
+const (
+	// maxObjectKeyLength is the maximum length of object keys in S3 and GCS, and blob names in Azure.
+	maxObjectKeyLength = 1024
+	// maxPathLength and maxNameLength are common PATH_MAX and NAME_MAX limits of file systems.
+	maxPathLength = 4096
+	maxNameLength = 255
+)
 
 // Backend implements operations for caching files.
 type Backend interface {
@@ -50,11 +50,11 @@ type Backend interface {
 	// Exists checks if path already exists.
 	Exists(ctx context.Context, p string) (bool, error)
 
-	// Implement me!
-	// List(ctx context.Context, p string) ([]FileEntry, error)
+	// List lists the object at the given path and the objects under it, with paths as they are given to Get.
+	List(ctx context.Context, p string) ([]common.FileEntry, error)
 
-	// Implement me!
-	// Delete(ctx context.Context, p string) error
+	// Delete deletes the object at the given path, deleting a missing object is not an error.
+	Delete(ctx context.Context, p string) error
 }
 
 // FromConfig creates new Backend by initializing  using given configuration.
@@ -90,3 +90,15 @@ func FromConfig(l log.Logger, backedType string, cfg Config) (Backend, error) {
 
 	return b, nil
 }
+
+// KeyLimits returns the restrictions of given backend type on object keys.
+func KeyLimits(backendType string) key.Limits {
+	switch backendType {
+	case Azure, GCS, S3:
+		return key.Limits{MaxLength: maxObjectKeyLength}
+	case FileSystem, SFTP:
+		return key.Limits{MaxLength: maxPathLength, MaxSegmentLength: maxNameLength}
+	default:
+		return key.Limits{}
+	}
+}
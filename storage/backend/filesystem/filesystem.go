@@ -12,6 +12,7 @@ import (
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/meltwater/drone-cache/internal"
+	"github.com/meltwater/drone-cache/storage/common"
 )
 
 const defaultFileMode = 0755
@@ -129,3 +130,55 @@ func (b *Backend) Exists(ctx context.Context, p string) (bool, error) {
 	}
 	return err == nil, nil
 }
+
+// List lists the object at the given path and the objects under it.
+func (b *Backend) List(ctx context.Context, p string) ([]common.FileEntry, error) {
+	root, err := filepath.Abs(filepath.Clean(b.cacheRoot))
+	if err != nil {
+		return nil, fmt.Errorf("absolute path, %w", err)
+	}
+
+	var entries []common.FileEntry
+
+	err = filepath.Walk(filepath.Join(root, p), func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return fmt.Errorf("relative path, %w", err)
+		}
+
+		entries = append(entries, common.FileEntry{Path: filepath.ToSlash(rel), Size: fi.Size(), LastModified: fi.ModTime()})
+
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("list the objects, %w", err)
+	}
+
+	return entries, nil
+}
+
+// Delete deletes the object at the given path.
+func (b *Backend) Delete(ctx context.Context, p string) error {
+	path, err := filepath.Abs(filepath.Clean(filepath.Join(b.cacheRoot, p)))
+	if err != nil {
+		return fmt.Errorf("absolute path, %w", err)
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("delete the object, %w", err)
+	}
+
+	return nil
+}
@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/go-kit/kit/log"
+	"github.com/meltwater/drone-cache/storage/common"
 	"github.com/meltwater/drone-cache/test"
 )
 
@@ -37,8 +38,51 @@ func TestRoundTrip(t *testing.T) {
 	test.Equals(t, true, exists)
 }
 
+func TestListDelete(t *testing.T) {
+	t.Parallel()
+
+	backend, cleanUp := setup(t)
+	t.Cleanup(cleanUp)
+
+	for _, p := range []string{"repo/key/mount", "repo/key/mount.sig", "repo/key-2/mount", "repo/other/nested/file"} {
+		test.Ok(t, backend.Put(context.TODO(), p, strings.NewReader(p)))
+	}
+
+	// Test List
+	entries, err := backend.List(context.TODO(), "repo/key")
+	test.Ok(t, err)
+	test.Equals(t, []string{"repo/key/mount", "repo/key/mount.sig"}, paths(entries))
+	test.Equals(t, int64(len("repo/key/mount")), entries[0].Size)
+
+	entries, err = backend.List(context.TODO(), "repo/key/mount")
+	test.Ok(t, err)
+	test.Equals(t, []string{"repo/key/mount"}, paths(entries))
+
+	entries, err = backend.List(context.TODO(), "missing")
+	test.Ok(t, err)
+	test.Equals(t, 0, len(entries))
+
+	// Test Delete
+	test.Ok(t, backend.Delete(context.TODO(), "repo/key/mount"))
+	test.Ok(t, backend.Delete(context.TODO(), "repo/key/mount"))
+
+	entries, err = backend.List(context.TODO(), "repo")
+	test.Ok(t, err)
+	test.Equals(t, []string{"repo/key/mount.sig", "repo/key-2/mount", "repo/other/nested/file"}, paths(entries))
+}
+
 // Helpers
 
+func paths(entries []common.FileEntry) []string {
+	ps := make([]string, 0, len(entries))
+	for _, e := range entries {
+		ps = append(ps, e.Path)
+	}
+
+	return ps
+}
+
+
 func setup(t *testing.T) (*Backend, func()) {
 	dir, cleanUp := test.CreateTempDir(t, "filesystem-test")
 
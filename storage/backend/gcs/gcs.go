@@ -9,11 +9,13 @@ import (
 	"strings"
 
 	"github.com/meltwater/drone-cache/internal"
+	"github.com/meltwater/drone-cache/storage/common"
 
 	gcstorage "cloud.google.com/go/storage"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"golang.org/x/oauth2/google"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
 
@@ -176,6 +178,42 @@ func (b *Backend) Exists(ctx context.Context, p string) (bool, error) {
 	}
 }
 
+// List lists the object at the given path and the objects under it.
+func (b *Backend) List(ctx context.Context, p string) ([]common.FileEntry, error) {
+	var (
+		entries []common.FileEntry
+		it      = b.client.Bucket(b.bucket).Objects(ctx, &gcstorage.Query{Prefix: p})
+	)
+
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return entries, nil
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("list the objects, %w", err)
+		}
+
+		// NOTICE: Prefix also matches siblings that share it, such as "key-2" for "key".
+		if !common.IsUnder(attrs.Name, p) {
+			continue
+		}
+
+		entries = append(entries, common.FileEntry{Path: attrs.Name, Size: attrs.Size, LastModified: attrs.Updated})
+	}
+}
+
+// Delete deletes the object at the given path.
+func (b *Backend) Delete(ctx context.Context, p string) error {
+	err := b.client.Bucket(b.bucket).Object(p).Delete(ctx)
+	if err != nil && err != gcstorage.ErrObjectNotExist {
+		return fmt.Errorf("delete the object, %w", err)
+	}
+
+	return nil
+}
+
 // Helpers
 
 func setAuthenticationMethod(l log.Logger, c Config, opts []option.ClientOption) []option.ClientOption {
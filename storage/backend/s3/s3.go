@@ -15,6 +15,7 @@ import (
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/meltwater/drone-cache/internal"
+	"github.com/meltwater/drone-cache/storage/common"
 )
 
 // Backend TODO
@@ -136,3 +137,49 @@ func (b *Backend) Exists(ctx context.Context, p string) (bool, error) {
 	// Minio can return success status for without ETag, detect that here.
 	return *out.ETag != "", nil
 }
+
+// List lists the object at the given path and the objects under it.
+func (b *Backend) List(ctx context.Context, p string) ([]common.FileEntry, error) {
+	in := &s3.ListObjectsV2Input{
+		Bucket: aws.String(b.bucket),
+		Prefix: aws.String(p),
+	}
+
+	var entries []common.FileEntry
+
+	err := b.client.ListObjectsV2PagesWithContext(ctx, in, func(out *s3.ListObjectsV2Output, last bool) bool {
+		for _, obj := range out.Contents {
+			// NOTICE: Prefix also matches siblings that share it, such as "key-2" for "key".
+			if !common.IsUnder(*obj.Key, p) {
+				continue
+			}
+
+			entries = append(entries, common.FileEntry{
+				Path:         *obj.Key,
+				Size:         aws.Int64Value(obj.Size),
+				LastModified: aws.TimeValue(obj.LastModified),
+			})
+		}
+
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list the objects, %w", err)
+	}
+
+	return entries, nil
+}
+
+// Delete deletes the object at the given path.
+func (b *Backend) Delete(ctx context.Context, p string) error {
+	in := &s3.DeleteObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(p),
+	}
+
+	if _, err := b.client.DeleteObjectWithContext(ctx, in); err != nil {
+		return fmt.Errorf("delete the object, %w", err)
+	}
+
+	return nil
+}
@@ -15,6 +15,7 @@ import (
 	"golang.org/x/crypto/ssh"
 
 	"github.com/meltwater/drone-cache/internal"
+	"github.com/meltwater/drone-cache/storage/common"
 )
 
 // Backend TODO
@@ -166,6 +167,69 @@ func (b *Backend) Exists(ctx context.Context, p string) (bool, error) {
 	}
 }
 
+// List lists the object at the given path and the objects under it.
+func (b *Backend) List(ctx context.Context, p string) ([]common.FileEntry, error) {
+	root, err := filepath.Abs(filepath.Clean(b.cacheRoot))
+	if err != nil {
+		return nil, fmt.Errorf("generate absolute path, %w", err)
+	}
+
+	var entries []common.FileEntry
+
+	for w := b.client.Walk(filepath.Join(root, p)); w.Step(); {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if err := w.Err(); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return nil, fmt.Errorf("list the objects, %w", err)
+		}
+
+		fi := w.Stat()
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+
+		rel, err := filepath.Rel(root, w.Path())
+		if err != nil {
+			return nil, fmt.Errorf("relative path, %w", err)
+		}
+
+		entries = append(entries, common.FileEntry{Path: filepath.ToSlash(rel), Size: fi.Size(), LastModified: fi.ModTime()})
+	}
+
+	return entries, nil
+}
+
+// Delete deletes the object at the given path.
+func (b *Backend) Delete(ctx context.Context, p string) error {
+	path, err := filepath.Abs(filepath.Clean(filepath.Join(b.cacheRoot, p)))
+	if err != nil {
+		return fmt.Errorf("generate absolute path, %w", err)
+	}
+
+	errCh := make(chan error)
+
+	go func() {
+		defer close(errCh)
+
+		if err := b.client.Remove(path); err != nil && !os.IsNotExist(err) {
+			errCh <- fmt.Errorf("delete the object, %w", err)
+		}
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // Helpers
 
 func authMethod(c Config) ([]ssh.AuthMethod, error) {
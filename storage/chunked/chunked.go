@@ -0,0 +1,383 @@
+// Package chunked provides a storage that splits objects into content-defined chunks,
+// and stores each chunk once by its digest, so similar objects share their common chunks.
+package chunked
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/meltwater/drone-cache/storage"
+	"github.com/meltwater/drone-cache/storage/common"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+const (
+	// DefaultNamespace is the default path that chunks are stored under.
+	DefaultNamespace = ".chunks"
+	// DefaultAverageChunkSize is the default average size of the chunks.
+	DefaultAverageChunkSize = 1 << 20 // 1 MiB
+	// MinAverageChunkSize is the smallest allowed average size of the chunks, smaller sizes are raised to it.
+	MinAverageChunkSize = 1 << 10 // 1 KiB
+
+	manifestVersion = 1
+	// maxManifestSize limits the size of the manifests, objects that are not manifests are not read further.
+	maxManifestSize = 16 << 20 // 16 MiB
+)
+
+var (
+	// ErrNotManifest is returned when the object stored under the given path is not a chunk manifest.
+	ErrNotManifest = errors.New("not a chunk manifest")
+	// ErrInvalidDigest is returned when a chunk manifest has a chunk whose digest is not a hex encoded sha256 digest.
+	ErrInvalidDigest = errors.New("invalid chunk digest")
+)
+
+// manifest lists the chunks of an object in order.
+type manifest struct {
+	Version int     `json:"version"`
+	Size    int64   `json:"size"`
+	Chunks  []chunk `json:"chunks"`
+}
+
+type chunk struct {
+	Digest string `json:"digest"`
+	Size   int64  `json:"size"`
+}
+
+// Storage stores objects as manifests of content-addressed chunks in the underlying storage.
+type Storage struct {
+	logger log.Logger
+
+	s storage.Storage
+
+	namespace        string
+	averageChunkSize int
+	localCache       string
+}
+
+// New creates a chunked storage on top of the given storage.
+func New(l log.Logger, s storage.Storage, opts ...Option) *Storage {
+	options := options{
+		namespace:        DefaultNamespace,
+		averageChunkSize: DefaultAverageChunkSize,
+	}
+
+	for _, o := range opts {
+		o.apply(&options)
+	}
+
+	if options.averageChunkSize < MinAverageChunkSize {
+		options.averageChunkSize = MinAverageChunkSize
+	}
+
+	return &Storage{
+		logger:           l,
+		s:                s,
+		namespace:        options.namespace,
+		averageChunkSize: options.averageChunkSize,
+		localCache:       options.localCache,
+	}
+}
+
+// Unwrap returns the underlying storage.
+func (s *Storage) Unwrap() storage.Storage {
+	return s.s
+}
+
+// Wrap returns a copy of the chunked storage on top of the given storage.
+func (s *Storage) Wrap(u storage.Storage) storage.Storage {
+	c := *s
+	c.s = u
+
+	return &c
+}
+
+// Get writes contents of the object with given key to io.Writer, fetching only the chunks missing in local cache.
+func (s *Storage) Get(p string, w io.Writer) error {
+	m, err := s.manifest(p)
+	if err != nil {
+		return err
+	}
+
+	var fetched, cached int
+
+	for _, c := range m.Chunks {
+		b, ok := s.readLocal(c.Digest)
+		if ok {
+			cached++
+		} else {
+			if b, err = s.fetch(c); err != nil {
+				return err
+			}
+
+			fetched++
+		}
+
+		if _, err := w.Write(b); err != nil {
+			return fmt.Errorf("write chunk <%s>, %w", c.Digest, err)
+		}
+	}
+
+	level.Debug(s.logger).Log("msg", "chunked object downloaded", "path", p, "fetched chunks", fetched, "cached chunks", cached)
+
+	return nil
+}
+
+// Put splits contents of io.Reader into chunks, uploads the chunks that do not exist yet and the manifest.
+func (s *Storage) Put(p string, r io.Reader) error {
+	var (
+		m        = manifest{Version: manifestVersion, Chunks: []chunk{}}
+		c        = newChunker(r, s.averageChunkSize)
+		uploaded int
+	)
+
+	for {
+		b, err := c.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return fmt.Errorf("read chunk, %w", err)
+		}
+
+		ch := chunk{Digest: digest(b), Size: int64(len(b))}
+
+		ok, err := s.store(ch, b)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			uploaded++
+		}
+
+		m.Size += ch.Size
+		m.Chunks = append(m.Chunks, ch)
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("encode manifest, %w", err)
+	}
+
+	if err := s.s.Put(p, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("put manifest <%s>, %w", p, err)
+	}
+
+	level.Debug(s.logger).Log("msg", "chunked object uploaded", "path", p, "chunks", len(m.Chunks), "uploaded chunks", uploaded)
+
+	return nil
+}
+
+// Exists checks if the manifest with given key exists in remote storage.
+func (s *Storage) Exists(p string) (bool, error) {
+	return s.s.Exists(p)
+}
+
+// List lists contents of the given directory by given key from remote storage.
+func (s *Storage) List(p string) ([]common.FileEntry, error) {
+	return s.s.List(p)
+}
+
+// Delete deletes the manifest from remote storage, chunks are kept since other manifests might share them.
+func (s *Storage) Delete(p string) error {
+	return s.s.Delete(p)
+}
+
+// References returns the paths of the chunks that the object with given key refers to,
+// none if the object is not a chunk manifest.
+func (s *Storage) References(p string) ([]string, error) {
+	m, err := s.manifest(p)
+	if errors.Is(err, ErrNotManifest) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	refs := make([]string, 0, len(m.Chunks))
+	for _, c := range m.Chunks {
+		refs = append(refs, s.chunkPath(c.Digest))
+	}
+
+	return refs, nil
+}
+
+// Shared reports whether the given path is a chunk, that might be shared by many objects.
+func (s *Storage) Shared(p string) bool {
+	return common.IsUnder(p, s.namespace) && p != s.namespace
+}
+
+// manifest downloads and decodes the manifest with given key.
+func (s *Storage) manifest(p string) (*manifest, error) {
+	var buf bytes.Buffer
+	if err := s.s.Get(p, &limitedWriter{w: &buf, n: maxManifestSize}); err != nil {
+		if errors.Is(err, ErrNotManifest) {
+			return nil, fmt.Errorf("object <%s> exceeds manifest size, %w", p, err)
+		}
+
+		return nil, fmt.Errorf("get manifest <%s>, %w", p, err)
+	}
+
+	var m manifest
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil || m.Version != manifestVersion {
+		return nil, fmt.Errorf("decode manifest <%s>, %w", p, ErrNotManifest)
+	}
+
+	// NOTICE: Digests name the chunks in remote storage and local cache, so they are validated before any path is built.
+	for _, c := range m.Chunks {
+		if !validDigest(c.Digest) {
+			return nil, fmt.Errorf("manifest <%s> has chunk <%s>, %w", p, c.Digest, ErrInvalidDigest)
+		}
+	}
+
+	return &m, nil
+}
+
+// store uploads the chunk if it does not exist in remote storage, reports whether it is uploaded.
+func (s *Storage) store(c chunk, b []byte) (bool, error) {
+	s.writeLocal(c.Digest, b)
+
+	p := s.chunkPath(c.Digest)
+
+	exists, err := s.s.Exists(p)
+	if err != nil {
+		return false, fmt.Errorf("chunk <%s> existence check, %w", c.Digest, err)
+	}
+
+	if exists {
+		return false, nil
+	}
+
+	if err := s.s.Put(p, bytes.NewReader(b)); err != nil {
+		return false, fmt.Errorf("put chunk <%s>, %w", c.Digest, err)
+	}
+
+	return true, nil
+}
+
+// fetch downloads the chunk and verifies its digest.
+func (s *Storage) fetch(c chunk) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Grow(int(c.Size))
+
+	if err := s.s.Get(s.chunkPath(c.Digest), &buf); err != nil {
+		return nil, fmt.Errorf("get chunk <%s>, %w", c.Digest, err)
+	}
+
+	b := buf.Bytes()
+	if d := digest(b); d != c.Digest {
+		return nil, fmt.Errorf("chunk <%s> is corrupted, digest <%s>", c.Digest, d)
+	}
+
+	s.writeLocal(c.Digest, b)
+
+	return b, nil
+}
+
+// chunkPath returns the remote path of the chunk, digests are fanned out by their prefix.
+// The digest must be valid, see validDigest.
+func (s *Storage) chunkPath(d string) string {
+	return path.Join(s.namespace, d[:2], d)
+}
+
+// readLocal reads the chunk from local cache, if enabled and the chunk is intact.
+func (s *Storage) readLocal(d string) ([]byte, bool) {
+	if s.localCache == "" || !validDigest(d) {
+		return nil, false
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(s.localCache, d[:2], d))
+	if err != nil || digest(b) != d {
+		return nil, false
+	}
+
+	return b, true
+}
+
+// writeLocal writes the chunk to local cache, if enabled. Failures are only logged, since local cache is best effort.
+func (s *Storage) writeLocal(d string, b []byte) {
+	if s.localCache == "" || !validDigest(d) {
+		return
+	}
+
+	if err := writeFile(filepath.Join(s.localCache, d[:2], d), b); err != nil {
+		level.Warn(s.logger).Log("msg", "write chunk to local cache", "digest", d, "err", err)
+	}
+}
+
+// writeFile writes the file atomically, so concurrent readers never see partial chunks.
+func writeFile(name string, b []byte) error {
+	if _, err := os.Stat(name); err == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil { //nolint:gomnd
+		return fmt.Errorf("create directory, %w", err)
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(name), ".tmp-")
+	if err != nil {
+		return fmt.Errorf("create temporary file, %w", err)
+	}
+
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("write temporary file, %w", err)
+	}
+
+	return os.Rename(f.Name(), name)
+}
+
+func digest(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// validDigest checks if the digest is a lowercase hex encoded sha256 digest.
+func validDigest(d string) bool {
+	if len(d) != hex.EncodedLen(sha256.Size) {
+		return false
+	}
+
+	for _, c := range d {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// limitedWriter fails with ErrNotManifest when more than n bytes written.
+type limitedWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > l.n {
+		return 0, ErrNotManifest
+	}
+
+	l.n -= int64(len(p))
+
+	return l.w.Write(p)
+}
@@ -0,0 +1,175 @@
+package chunked
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meltwater/drone-cache/storage"
+	"github.com/meltwater/drone-cache/storage/backend/filesystem"
+	"github.com/meltwater/drone-cache/test"
+
+	"github.com/go-kit/kit/log"
+)
+
+const testAverageChunkSize = 16 << 10 // 16 KiB
+
+func TestRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	s, _ := setup(t)
+	content := randomBytes(t, 1<<20)
+
+	// Test Put
+	test.Ok(t, s.Put("key/mount", bytes.NewReader(content)))
+
+	// Test Get
+	var buf bytes.Buffer
+	test.Ok(t, s.Get("key/mount", &buf))
+	test.Assert(t, bytes.Equal(content, buf.Bytes()), "restored content differs")
+
+	exists, err := s.Exists("key/mount")
+	test.Ok(t, err)
+	test.Equals(t, true, exists)
+}
+
+func TestDeduplication(t *testing.T) {
+	t.Parallel()
+
+	s, root := setup(t)
+	content := randomBytes(t, 1<<20)
+
+	// NOTICE: Insert a few bytes in the middle, only the chunks around the insertion should differ.
+	modified := append(append(append([]byte{}, content[:len(content)/2]...), []byte("drone")...), content[len(content)/2:]...)
+
+	test.Ok(t, s.Put("main/mount", bytes.NewReader(content)))
+	first := countFiles(t, filepath.Join(root, DefaultNamespace))
+
+	test.Ok(t, s.Put("branch/mount", bytes.NewReader(modified)))
+	second := countFiles(t, filepath.Join(root, DefaultNamespace))
+
+	test.Assert(t, second-first <= 3, "got %d new chunks out of %d, want at most 3", second-first, first)
+
+	var buf bytes.Buffer
+	test.Ok(t, s.Get("branch/mount", &buf))
+	test.Assert(t, bytes.Equal(modified, buf.Bytes()), "restored content differs")
+}
+
+func TestLocalCache(t *testing.T) {
+	t.Parallel()
+
+	s, root := setup(t)
+
+	local, localClean := test.CreateTempDir(t, "chunked-local-cache")
+	t.Cleanup(localClean)
+
+	s.localCache = local
+	content := randomBytes(t, 256<<10)
+
+	test.Ok(t, s.Put("key/mount", bytes.NewReader(content)))
+
+	// NOTICE: Remove remote chunks, restore should only use the local ones.
+	test.Ok(t, os.RemoveAll(filepath.Join(root, DefaultNamespace)))
+
+	var buf bytes.Buffer
+	test.Ok(t, s.Get("key/mount", &buf))
+	test.Assert(t, bytes.Equal(content, buf.Bytes()), "restored content differs")
+}
+
+func TestGetNotManifest(t *testing.T) {
+	t.Parallel()
+
+	s, _ := setup(t)
+
+	test.Ok(t, s.s.Put("key/mount", strings.NewReader("not a manifest")))
+
+	var buf bytes.Buffer
+	test.Expected(t, s.Get("key/mount", &buf), ErrNotManifest)
+}
+
+func TestGetInvalidDigest(t *testing.T) {
+	t.Parallel()
+
+	for _, digest := range []string{"", "a", strings.Repeat("A", 64), "../../" + strings.Repeat("a", 58)} {
+		s, _ := setup(t)
+
+		local, localClean := test.CreateTempDir(t, "chunked-local-cache")
+		t.Cleanup(localClean)
+
+		s.localCache = local
+
+		data, err := json.Marshal(manifest{Version: manifestVersion, Size: 1, Chunks: []chunk{{Digest: digest, Size: 1}}})
+		test.Ok(t, err)
+		test.Ok(t, s.s.Put("key/mount", bytes.NewReader(data)))
+
+		var buf bytes.Buffer
+		test.Expected(t, s.Get("key/mount", &buf), ErrInvalidDigest)
+	}
+}
+
+func TestChunker(t *testing.T) {
+	t.Parallel()
+
+	content := randomBytes(t, 1<<20)
+	c := newChunker(bytes.NewReader(content), testAverageChunkSize)
+
+	var restored []byte
+
+	for {
+		b, err := c.Next()
+		if err != nil {
+			break
+		}
+
+		test.Assert(t, len(b) <= c.max, "chunk size %d exceeds max %d", len(b), c.max)
+
+		restored = append(restored, b...)
+		if len(restored) < len(content) {
+			test.Assert(t, len(b) >= c.min, "chunk size %d is below min %d", len(b), c.min)
+		}
+	}
+
+	test.Assert(t, bytes.Equal(content, restored), "chunks differ from content")
+}
+
+// Helpers
+
+func setup(t *testing.T) (*Storage, string) {
+	dir, cleanUp := test.CreateTempDir(t, "chunked-test")
+	t.Cleanup(cleanUp)
+
+	b, err := filesystem.New(log.NewNopLogger(), filesystem.Config{CacheRoot: dir})
+	test.Ok(t, err)
+
+	s := storage.New(log.NewNopLogger(), b, time.Minute)
+
+	return New(log.NewNopLogger(), s, WithAverageChunkSize(testAverageChunkSize)), dir
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	b := make([]byte, n)
+
+	_, err := rand.New(rand.NewSource(42)).Read(b) //nolint:gosec
+	test.Ok(t, err)
+
+	return b
+}
+
+func countFiles(t *testing.T, dir string) int {
+	var n int
+
+	test.Ok(t, filepath.Walk(dir, func(_ string, fi os.FileInfo, err error) error {
+		if err == nil && fi.Mode().IsRegular() {
+			n++
+		}
+
+		return err
+	}))
+
+	return n
+}
@@ -0,0 +1,112 @@
+package chunked
+
+import (
+	"errors"
+	"io"
+	"math/bits"
+)
+
+// gear is the table of random values used by the rolling hash, generated from a fixed seed so chunk
+// boundaries are stable across releases.
+var gear = func() (table [256]uint64) {
+	// NOTICE: splitmix64, https://prng.di.unimi.it/splitmix64.c
+	seed := uint64(0x64726f6e65636163) // "dronecac"
+
+	for i := range table {
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+
+	return table
+}()
+
+// chunker splits a stream into content-defined chunks using gear hash based FastCDC.
+// Boundaries depend only on the content around them, so an insertion only changes the chunks around it.
+type chunker struct {
+	r io.Reader
+
+	buf []byte
+	n   int
+	eof bool
+
+	min, avg, max int
+	maskS, maskL  uint64
+}
+
+func newChunker(r io.Reader, avg int) *chunker {
+	// NOTICE: Normalized chunking, boundaries are harder to find before the average size and easier after it.
+	b := bits.Len(uint(avg)) - 1
+
+	return &chunker{
+		r:     r,
+		buf:   make([]byte, avg*8), //nolint:gomnd
+		min:   avg / 4,             //nolint:gomnd
+		avg:   avg,
+		max:   avg * 8, //nolint:gomnd
+		maskS: ^uint64(0) << (64 - (b + 1)),
+		maskL: ^uint64(0) << (64 - (b - 1)),
+	}
+}
+
+// Next returns the next chunk, or io.EOF when the stream is consumed.
+func (c *chunker) Next() ([]byte, error) {
+	if !c.eof && c.n < c.max {
+		m, err := io.ReadFull(c.r, c.buf[c.n:])
+		c.n += m
+
+		switch {
+		case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+			c.eof = true
+		case err != nil:
+			return nil, err
+		}
+	}
+
+	if c.n == 0 {
+		return nil, io.EOF
+	}
+
+	cut := c.cut(c.buf[:c.n])
+
+	chunk := make([]byte, cut)
+	copy(chunk, c.buf[:cut])
+	c.n = copy(c.buf, c.buf[cut:c.n])
+
+	return chunk, nil
+}
+
+// cut returns the length of the first chunk of the given data.
+func (c *chunker) cut(data []byte) int {
+	if len(data) <= c.min {
+		return len(data)
+	}
+
+	normal := c.avg
+	if normal > len(data) {
+		normal = len(data)
+	}
+
+	var (
+		h uint64
+		i = c.min
+	)
+
+	for ; i < normal; i++ {
+		h = (h << 1) + gear[data[i]]
+		if h&c.maskS == 0 {
+			return i + 1
+		}
+	}
+
+	for ; i < len(data); i++ {
+		h = (h << 1) + gear[data[i]]
+		if h&c.maskL == 0 {
+			return i + 1
+		}
+	}
+
+	return len(data)
+}
@@ -0,0 +1,39 @@
+package chunked
+
+type options struct {
+	namespace        string
+	averageChunkSize int
+	localCache       string
+}
+
+// Option overrides behavior of Storage.
+type Option interface {
+	apply(*options)
+}
+
+type optionFunc func(*options)
+
+func (f optionFunc) apply(o *options) {
+	f(o)
+}
+
+// WithNamespace sets the path that chunks are stored under, shared by all keys.
+func WithNamespace(s string) Option {
+	return optionFunc(func(o *options) {
+		o.namespace = s
+	})
+}
+
+// WithAverageChunkSize sets the average size of the chunks, chunks are between a quarter and eight times of it.
+func WithAverageChunkSize(i int) Option {
+	return optionFunc(func(o *options) {
+		o.averageChunkSize = i
+	})
+}
+
+// WithLocalCache sets the local directory to keep chunks in, chunks found in it are not downloaded.
+func WithLocalCache(dir string) Option {
+	return optionFunc(func(o *options) {
+		o.localCache = dir
+	})
+}
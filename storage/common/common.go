@@ -0,0 +1,25 @@
+// Package common provides types and helpers shared by storage backends.
+package common
+
+import (
+	"strings"
+	"time"
+)
+
+// FileEntry defines a single cache item.
+type FileEntry struct {
+	Path         string
+	Size         int64
+	LastModified time.Time
+}
+
+// IsUnder reports whether the object with the given key is the object at the given path, or under it as a directory.
+// Every key is under the empty path.
+func IsUnder(key, p string) bool {
+	p = strings.TrimSuffix(p, "/")
+	if p == "" {
+		return true
+	}
+
+	return key == p || strings.HasPrefix(key, p+"/")
+}